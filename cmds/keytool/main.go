@@ -0,0 +1,48 @@
+// Command keytool manages master keys for the key management providers.
+//
+//	keytool generate
+//		prints a new random master key for BANQUETTE_MASTER_KEYS or a key file
+//	keytool softtoken-add -file token.json
+//		adds a new master key to a soft token, which is created if it does
+//		not exist, the PIN is read from BANQUETTE_SOFTTOKEN_PIN
+//
+// After adding a key, re-encrypt the stored passwords with cmds/rekey.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/svenbs/banquette/pkg/secrets"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: keytool generate | softtoken-add -file <path>")
+	}
+
+	switch cmd := os.Args[1]; cmd {
+	case "generate":
+		key := make([]byte, secrets.KeySize)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("could not generate key: %v", err)
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(key))
+	case "softtoken-add":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		file := fs.String("file", os.Getenv("BANQUETTE_SOFTTOKEN"), "sets the path of the soft token.")
+		fs.Parse(os.Args[2:])
+
+		v, err := secrets.AddSoftTokenKey(*file, os.Getenv("BANQUETTE_SOFTTOKEN_PIN"))
+		if err != nil {
+			log.Fatalf("could not add key to soft token %v: %v", *file, err)
+		}
+		log.Printf("added master key version %v to %v", v, *file)
+	default:
+		log.Fatalf("unknown command %q", cmd)
+	}
+}
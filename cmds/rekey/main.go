@@ -0,0 +1,81 @@
+// Command rekey re-encrypts the stored admin passwords of all registered
+// databases with the current master key, so older master keys can be
+// removed afterwards, e.g. from BANQUETTE_MASTER_KEYS.
+//
+// Passwords are re-encrypted in batches. Passwords that already use the
+// current key are skipped, so an interrupted run is resumed by running
+// rekey again. -after skips the registrations up to an id, e.g. one that fails.
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/secrets"
+)
+
+var (
+	batch = flag.Int("batch", 100, "sets the number of passwords re-encrypted per batch.")
+	after = flag.Int("after", 0, "skips the registrations with an id up to this one.")
+
+	dbaddr   = os.Getenv("DB_ADDR")
+	dbuser   = os.Getenv("DB_USER")
+	dbpass   = os.Getenv("DB_PASSWORD")
+	dbsecret = os.Getenv("DB_SECRET")
+	database = os.Getenv("DB_DATABASE")
+)
+
+func main() {
+	flag.Parse()
+	if *batch < 1 {
+		log.Fatalf("invalid batch size %v", *batch)
+	}
+
+	keys, err := secrets.ProviderFromEnv()
+	if err != nil {
+		log.Fatalf("could not load master keys: %v", err)
+	}
+	tokenKey, err := secrets.TokenKeyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := models.NewDB("mysql", dbsecret, dbuser+":"+dbpass+"@("+dbaddr+")"+"/"+database+"?parseTime=true", keys, tokenKey)
+	if err != nil {
+		log.Fatalf("could not connect to database (@(%v)/%v): %v", dbaddr, database, err)
+	}
+	defer db.Close()
+
+	total, err := db.StalePasswords()
+	if err != nil {
+		log.Fatal(err)
+	}
+	current, err := keys.CurrentVersion()
+	if err != nil {
+		log.Fatalf("could not get the current master key version: %v", err)
+	}
+	log.Printf("re-encrypting %v passwords with master key version %v", total, current)
+
+	done := 0
+	for last := *after; ; {
+		rekeyed, next, err := db.Rekey(last, *batch)
+		done += rekeyed
+		var failed *models.RekeyError
+		if errors.As(err, &failed) {
+			log.Fatalf("stopped after registration %v (%v/%v done): %v, run rekey again to resume or skip the registration with -after %v", next, done, total, err, failed.RegistrationID)
+		}
+		if err != nil {
+			log.Fatalf("stopped after registration %v (%v/%v done): %v, run rekey again to resume", next, done, total, err)
+		}
+		if next == last {
+			break
+		}
+		last = next
+		log.Printf("re-encrypted %v/%v passwords, up to registration %v", done, total, last)
+	}
+	log.Printf("done, re-encrypted %v passwords", done)
+}
@@ -1,48 +1,296 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/databases/mysql"
+	_ "github.com/svenbs/banquette/pkg/databases/oracle"
+	"github.com/svenbs/banquette/pkg/databases/plugin"
+	_ "github.com/svenbs/banquette/pkg/databases/postgres"
 	"github.com/svenbs/banquette/pkg/handler"
+	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/oidc"
+	"github.com/svenbs/banquette/pkg/reaper"
+	"github.com/svenbs/banquette/pkg/secrets"
 )
 
 var (
 	addr     = flag.String("addr", ":8000", "sets the IP and Port to listen on.")
+	reap     = flag.Duration("reap-interval", time.Minute, "sets how often expired users are dropped, 0 disables it.")
+	leaseTTL = flag.Duration("lease-ttl", time.Hour, "sets the duration of leases requested without a ttl.")
+	leaseMax = flag.Duration("lease-max-ttl", 24*time.Hour, "sets the longest lifetime of a lease including renewals.")
+	tlsCert  = flag.String("tls-cert", "", "sets the certificate file to serve TLS with.")
+	tlsKey   = flag.String("tls-key", "", "sets the key file of -tls-cert.")
+	clientCA = flag.String("tls-client-ca", "", "sets the CA file verifying client certificates of admins, needs -tls-cert.")
 	dbaddr   = os.Getenv("DB_ADDR")
 	dbuser   = os.Getenv("DB_USER")
 	dbpass   = os.Getenv("DB_PASSWORD")
 	dbsecret = os.Getenv("DB_SECRET")
 	database = os.Getenv("DB_DATABASE")
+
+	mysqlUserHost = os.Getenv("MYSQL_USER_HOST")
+	mysqlGrants   = os.Getenv("MYSQL_GRANTS")
+
+	// type=/path/to/plugin,other=/path/to/other
+	plugins = os.Getenv("BANQUETTE_PLUGINS")
+
+	// name:key,other:key
+	adminKeys = os.Getenv("BANQUETTE_ADMIN_KEYS")
+	// CN=ops,O=Example;CN=other,O=Example
+	adminSubjects = os.Getenv("BANQUETTE_ADMIN_SUBJECTS")
+
+	// JWTs of the issuer are accepted if it is set
+	oidcIssuer   = os.Getenv("BANQUETTE_OIDC_ISSUER")
+	oidcAudience = os.Getenv("BANQUETTE_OIDC_AUDIENCE")
+	// https://issuer/.well-known/jwks.json or /path/to/jwks.json
+	oidcJWKS  = os.Getenv("BANQUETTE_OIDC_JWKS")
+	oidcRules = os.Getenv("BANQUETTE_OIDC_RULES")
 )
 
 func main() {
 	flag.Parse()
 
-	h, err := handler.InitDB("mysql", dbsecret, dbuser+":"+dbpass+"@("+dbaddr+")"+"/"+database)
+	if mysqlUserHost != "" {
+		mysql.UserHost = mysqlUserHost
+	}
+	if mysqlGrants != "" {
+		mysql.Grants = strings.Split(mysqlGrants, ",")
+		for i := range mysql.Grants {
+			mysql.Grants[i] = strings.TrimSpace(mysql.Grants[i])
+		}
+	}
+
+	for _, entry := range strings.Split(plugins, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 {
+			fatalf("invalid plugin entry %q, expected type=/path/to/plugin", entry)
+		}
+		typ := strings.TrimSpace(kv[0])
+		if databases.Registered(typ) {
+			fatalf("could not register plugin for type %v: the type is already registered, choose another name", typ)
+		}
+		p, err := plugin.Start(strings.TrimSpace(kv[1]))
+		if err != nil {
+			fatalf("could not start plugin for type %v: %v", typ, err)
+		}
+		running = append(running, p)
+		databases.Register(typ, p.Factory())
+		log.Printf("registered plugin %v as database type %v", p.Name(), typ)
+	}
+
+	keys, err := secrets.ProviderFromEnv()
+	if err != nil {
+		fatalf("could not load master keys: %v", err)
+	}
+	tokenKey, err := secrets.TokenKeyFromEnv()
+	if err != nil {
+		fatalf("%v", err)
+	}
+
+	db, err := models.NewDB("mysql", dbsecret, dbuser+":"+dbpass+"@("+dbaddr+")"+"/"+database+"?parseTime=true", keys, tokenKey)
 	if err != nil {
-		log.Fatalf("could not connect to database (@(%v)/%v): %v", dbaddr, database, err)
+		fatalf("could not connect to database (@(%v)/%v): %v", dbaddr, database, err)
+	}
+	if n, err := db.EncryptLegacyPasswords(); err != nil {
+		fatalf("could not encrypt legacy passwords: %v", err)
+	} else if n > 0 {
+		log.Printf("encrypted %v passwords stored with AES_ENCRYPT", n)
+	}
+	if n, err := db.BindLegacyPasswords(); err != nil {
+		fatalf("could not bind passwords to their registration: %v", err)
+	} else if n > 0 {
+		log.Printf("bound %v passwords to the id of their registration", n)
+	}
+	if n, err := db.HashLegacyTokens(); err != nil {
+		fatalf("could not hash legacy tokens: %v", err)
+	} else if n > 0 {
+		log.Printf("replaced %v tokens stored in plaintext with their hash", n)
 	}
+	h := handler.NewEnv(db)
 	defer h.Close()
+	h.Leases.TTL = *leaseTTL
+	h.Leases.MaxTTL = *leaseMax
+	if h.Admins, err = admins(); err != nil {
+		fatalf("%v", err)
+	}
+	if oidcIssuer != "" {
+		if h.Verifier, h.Rules, err = jwtAuth(); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	if *reap > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r := reaper.New(db)
+		r.Interval = *reap
+		go r.Run(ctx)
+	}
 
 	loggedRouter := handlers.LoggingHandler(os.Stdout, serveHandler(h))
 
+	srv := &http.Server{Addr: *addr, Handler: loggedRouter}
+	if *clientCA != "" {
+		if *tlsCert == "" {
+			fatalf("-tls-client-ca needs -tls-cert")
+		}
+		pem, err := ioutil.ReadFile(*clientCA)
+		if err != nil {
+			fatalf("could not read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			fatalf("no certificates found in %v", *clientCA)
+		}
+		// only admins need a client certificate
+		srv.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		srv.Shutdown(context.Background())
+	}()
+
 	log.Println("starting server on ", *addr)
-	log.Fatal(http.ListenAndServe(*addr, loggedRouter))
+	if *tlsCert != "" {
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		fatalf("%v", err)
+	}
 	log.Println("Stopping...")
+	closePlugins()
+}
+
+// running are the started plugins, they are closed on shutdown
+var running []*plugin.Plugin
+
+// closePlugins stops the running plugins
+func closePlugins() {
+	for _, p := range running {
+		if err := p.Close(); err != nil {
+			log.Printf("could not close plugin %v: %v", p.Name(), err)
+		}
+	}
+	running = nil
+}
+
+// fatalf stops the running plugins, which log.Fatalf would leave
+// behind, and exits like log.Fatalf
+func fatalf(format string, v ...interface{}) {
+	closePlugins()
+	log.Fatalf(format, v...)
+}
+
+// admins returns the admins configured by BANQUETTE_ADMIN_KEYS
+// and BANQUETTE_ADMIN_SUBJECTS
+func admins() (*handler.Admins, error) {
+	keys := map[string]string{}
+	for _, entry := range strings.Split(adminKeys, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || len(strings.TrimSpace(kv[1])) < 16 {
+			return nil, fmt.Errorf("invalid admin key entry, expected name:key with a key of at least 16 characters")
+		}
+		keys[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	var subjects []string
+	for _, s := range strings.Split(adminSubjects, ";") {
+		if s = strings.TrimSpace(s); s != "" {
+			subjects = append(subjects, s)
+		}
+	}
+	if len(subjects) > 0 && *clientCA == "" {
+		return nil, fmt.Errorf("BANQUETTE_ADMIN_SUBJECTS needs -tls-client-ca")
+	}
+	if len(keys) == 0 && len(subjects) == 0 {
+		log.Println("no admins configured, databases cannot be registered")
+	}
+	return handler.NewAdmins(keys, subjects), nil
+}
+
+// jwtAuth returns the verifier of the JWTs of BANQUETTE_OIDC_ISSUER
+// and the rules authorizing their callers
+func jwtAuth() (handler.Verifier, *oidc.Rules, error) {
+	if oidcAudience == "" || oidcJWKS == "" {
+		return nil, nil, fmt.Errorf("BANQUETTE_OIDC_ISSUER needs BANQUETTE_OIDC_AUDIENCE and BANQUETTE_OIDC_JWKS")
+	}
+	var keys oidc.KeySource
+	if strings.HasPrefix(oidcJWKS, "https://") || strings.HasPrefix(oidcJWKS, "http://") {
+		keys = oidc.NewRemoteKeySet(oidcJWKS)
+	} else {
+		set, err := oidc.LoadKeySet(oidcJWKS)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = set
+	}
+	// without rules, callers only have the roles of their teams
+	rules := &oidc.Rules{}
+	if oidcRules != "" {
+		var err error
+		if rules, err = oidc.LoadRules(oidcRules); err != nil {
+			return nil, nil, err
+		}
+	}
+	return oidc.NewVerifier(keys, oidcIssuer, oidcAudience), rules, nil
 }
 
 func serveHandler(env *handler.Env) http.Handler {
 
 	r := mux.NewRouter()
-	// sha256-token, username, [password]
-	r.HandleFunc("/api/v1/oracle", env.OracleMethodRouter).Methods("POST", "DELETE")
-	// dbtype, user, password, connectstring
+	// username, [password]
+	r.HandleFunc("/api/v1/users", env.UserMethodRouter).Methods("POST", "PATCH", "DELETE")
+	r.HandleFunc("/api/v1/users", env.ListUsers).Methods("GET")
+	r.HandleFunc("/api/v1/users/{username}", env.GetUser).Methods("GET")
+	r.HandleFunc("/api/v1/users/{action:lock|unlock|expire}", env.AccountActionRouter).Methods("POST")
+	// leases of users created with "lease": true are dropped on expiry by the reaper
+	r.HandleFunc("/api/v1/leases/{action:renew|revoke}", env.LeaseActionRouter).Methods("POST")
+	r.HandleFunc("/api/v1/leases/{id}", env.GetLease).Methods("GET")
+	// GET reports drift between bookmarks and database users, POST repairs it
+	r.HandleFunc("/api/v1/reconcile", env.Reconcile).Methods("GET", "POST")
+	// kept for clients predating /api/v1/users
+	r.HandleFunc("/api/v1/oracle", env.UserMethodRouter).Methods("POST", "DELETE")
+	// dbtype, user, password, connectstring, POST and PATCH need an admin
 	r.HandleFunc("/api/v1/token", env.TokenMethodRouter).Methods("POST", "PATCH", "DELETE")
+	// tokens with scopes for the registration of a token with the scope registration:admin
+	r.HandleFunc("/api/v1/tokens", env.TokensMethodRouter).Methods("GET", "POST", "DELETE")
+	// tokens of all registrations that expired or were not used for ?unused=720h, needs an admin
+	r.HandleFunc("/api/v1/tokens/stale", env.StaleTokens).Methods("GET")
+	// needs an admin
+	r.HandleFunc("/api/v1/databases", env.ListDatabases).Methods("GET")
+	// teams owning registrations and the roles of their members, these need an admin
+	r.HandleFunc("/api/v1/teams", env.TeamsMethodRouter).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/teams/{id}", env.DeleteTeam).Methods("DELETE")
+	r.HandleFunc("/api/v1/teams/{id}/members", env.TeamMembersMethodRouter).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/api/v1/registrations/{id}/team", env.SetRegistrationTeam).Methods("PUT")
+	// tokens are sent as "Authorization: Bearer <token>"
+	r.Use(env.Authenticate)
 	return r
 }
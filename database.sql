@@ -1,21 +1,92 @@
-CREATE TABLE tokens (
+CREATE TABLE teams (
+    id MEDIUMINT NOT NULL AUTO_INCREMENT,
+    name varchar(100) NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(id),
+    UNIQUE INDEX name_ind(name)
+    ) ENGINE=INNODB;
+
+CREATE TABLE registrations (
     id MEDIUMINT NOT NULL AUTO_INCREMENT, 
-    token char(65) NOT NULL,
     type varchar(50) NOT NULL, 
     dbaddr varchar(100) NOT NULL, 
     dbname varchar(30) NOT NULL, 
     username varchar(100) NOT NULL, 
     password blob NOT NULL,
+    key_version INT NOT NULL DEFAULT 0,
+    data_key VARBINARY(255) NULL,
+    password_bound BOOLEAN NOT NULL DEFAULT FALSE,
+    template TEXT NULL,
+    quota TEXT NULL,
+    created_by varchar(255) NULL,
+    updated_by varchar(255) NULL,
+    team_id MEDIUMINT NULL,
+    PRIMARY KEY(id),
+    INDEX key_version_ind(key_version),
+    FOREIGN KEY (team_id)
+        REFERENCES teams(id)
+        ON DELETE SET NULL
+    ) ENGINE=INNODB;
+
+CREATE TABLE team_members (
+    team_id MEDIUMINT NOT NULL,
+    principal varchar(255) NOT NULL,
+    role varchar(20) NOT NULL,
+    PRIMARY KEY(team_id, principal),
+    FOREIGN KEY (team_id)
+        REFERENCES teams(id)
+        ON DELETE CASCADE
+    ) ENGINE=INNODB;
+
+CREATE TABLE tokens (
+    id INT NOT NULL AUTO_INCREMENT,
+    registration_id MEDIUMINT NOT NULL,
+    token char(65) NULL,
+    token_hash char(64) NULL,
+    scopes varchar(255) NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NULL,
+    revoked_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    last_used_ip varchar(45) NULL,
+    quota TEXT NULL,
     PRIMARY KEY(id),
     UNIQUE KEY (token),
-    INDEX token_ind(token, id)
+    UNIQUE KEY (token_hash),
+    INDEX registration_ind(registration_id),
+    FOREIGN KEY (registration_id)
+        REFERENCES registrations(id)
+        ON DELETE CASCADE
     ) ENGINE=INNODB;
 
 CREATE TABLE bookmarks (
-    token_id MEDIUMINT NOT NULL,
+    id INT NOT NULL AUTO_INCREMENT,
+    registration_id MEDIUMINT NOT NULL,
     dbname varchar(100) NOT NULL,
-    INDEX token_ind(token_id),
-    FOREIGN KEY (token_id)
-        REFERENCES tokens(id)
+    state varchar(20) NOT NULL DEFAULT 'OPEN',
+    tablespace varchar(100) NOT NULL DEFAULT '',
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires DATETIME NULL,
+    created_by varchar(255) NULL,
+    size BIGINT NULL,
+    PRIMARY KEY(id),
+    INDEX registration_ind(registration_id),
+    UNIQUE INDEX registration_dbname_ind(registration_id, dbname),
+    INDEX expires_ind(expires),
+    FOREIGN KEY (registration_id)
+        REFERENCES registrations(id)
         ON DELETE CASCADE
-    ) ENGINE=INNODB;
\ No newline at end of file
+    ) ENGINE=INNODB;
+
+CREATE TABLE leases (
+    id char(32) NOT NULL,
+    bookmark_id INT NOT NULL,
+    issued DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires DATETIME NOT NULL,
+    max_expires DATETIME NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE KEY (bookmark_id),
+    FOREIGN KEY (bookmark_id)
+        REFERENCES bookmarks(id)
+        ON DELETE CASCADE
+    ) ENGINE=INNODB;
@@ -0,0 +1,2 @@
+-- user templates are stored as JSON, NULL means the default template
+ALTER TABLE tokens ADD COLUMN template TEXT NULL;
@@ -0,0 +1,2 @@
+-- account state of bookmarked users, see the State constants in pkg/models
+ALTER TABLE bookmarks ADD COLUMN state varchar(20) NOT NULL DEFAULT 'OPEN';
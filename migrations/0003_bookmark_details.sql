@@ -0,0 +1,7 @@
+-- tablespace and creation time of bookmarked users
+ALTER TABLE bookmarks
+    ADD COLUMN tablespace varchar(100) NOT NULL DEFAULT '',
+    ADD COLUMN created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- banquette has always named tablespaces after their user
+UPDATE bookmarks SET tablespace = dbname;
@@ -0,0 +1,4 @@
+-- users with an expiry are dropped by the reaper once it has passed
+ALTER TABLE bookmarks
+    ADD COLUMN expires DATETIME NULL,
+    ADD INDEX expires_ind(expires);
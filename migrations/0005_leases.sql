@@ -0,0 +1,16 @@
+-- leases reference their bookmark by id
+ALTER TABLE bookmarks
+    ADD COLUMN id INT NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST;
+
+CREATE TABLE leases (
+    id char(32) NOT NULL,
+    bookmark_id INT NOT NULL,
+    issued DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires DATETIME NOT NULL,
+    max_expires DATETIME NOT NULL,
+    PRIMARY KEY(id),
+    UNIQUE KEY (bookmark_id),
+    FOREIGN KEY (bookmark_id)
+        REFERENCES bookmarks(id)
+        ON DELETE CASCADE
+    ) ENGINE=INNODB;
@@ -0,0 +1,7 @@
+-- passwords are encrypted by banquette with a data key wrapped by a
+-- master key. key_version 0 marks passwords stored with AES_ENCRYPT,
+-- they are encrypted with the master key when the server starts.
+ALTER TABLE tokens
+    ADD COLUMN key_version INT NOT NULL DEFAULT 0,
+    ADD COLUMN data_key VARBINARY(255) NULL,
+    ADD INDEX key_version_ind(key_version);
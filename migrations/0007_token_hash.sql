@@ -0,0 +1,8 @@
+-- tokens are stored as their HMAC-SHA256 keyed with BANQUETTE_TOKEN_KEY.
+-- token only holds tokens stored in plaintext before, the server
+-- replaces them with their hash when it starts.
+ALTER TABLE tokens
+    MODIFY token char(65) NULL,
+    ADD COLUMN token_hash char(64) NULL,
+    ADD UNIQUE KEY (token_hash),
+    DROP INDEX token_ind;
@@ -0,0 +1,31 @@
+-- a registered database can have several tokens with different scopes.
+-- tokens is split into registrations and their tokens, existing
+-- tokens keep all scopes.
+RENAME TABLE tokens TO registrations;
+
+CREATE TABLE tokens (
+    id INT NOT NULL AUTO_INCREMENT,
+    registration_id MEDIUMINT NOT NULL,
+    token char(65) NULL,
+    token_hash char(64) NULL,
+    scopes varchar(255) NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(id),
+    UNIQUE KEY (token),
+    UNIQUE KEY (token_hash),
+    INDEX registration_ind(registration_id),
+    FOREIGN KEY (registration_id)
+        REFERENCES registrations(id)
+        ON DELETE CASCADE
+    ) ENGINE=INNODB;
+
+INSERT INTO tokens (registration_id, token, token_hash, scopes)
+    SELECT id, token, token_hash, 'users:create,users:read,users:update,users:drop,registration:admin' FROM registrations;
+
+ALTER TABLE registrations
+    DROP COLUMN token,
+    DROP COLUMN token_hash;
+
+ALTER TABLE bookmarks
+    RENAME COLUMN token_id TO registration_id,
+    RENAME INDEX token_ind TO registration_ind;
@@ -0,0 +1,7 @@
+-- tokens can expire and are revoked without deleting them,
+-- the last authenticated call of a token is recorded.
+ALTER TABLE tokens
+    ADD COLUMN expires_at DATETIME NULL,
+    ADD COLUMN revoked_at DATETIME NULL,
+    ADD COLUMN last_used_at DATETIME NULL,
+    ADD COLUMN last_used_ip varchar(45) NULL;
@@ -0,0 +1,6 @@
+-- registering and updating databases needs an admin,
+-- the principal of the admin is recorded. Existing
+-- registrations have none.
+ALTER TABLE registrations
+    ADD COLUMN created_by varchar(255) NULL,
+    ADD COLUMN updated_by varchar(255) NULL;
@@ -0,0 +1,4 @@
+-- bookmarks record the principal that created the user,
+-- "token:<id>" or "jwt:<subject>". Existing bookmarks have none.
+ALTER TABLE bookmarks
+    ADD COLUMN created_by varchar(255) NULL;
@@ -0,0 +1,24 @@
+-- registrations are owned by teams, the members of a team have
+-- a role (viewer, provisioner or admin) on its registrations.
+-- Existing registrations have no team.
+CREATE TABLE teams (
+    id MEDIUMINT NOT NULL AUTO_INCREMENT,
+    name varchar(100) NOT NULL,
+    created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(id),
+    UNIQUE INDEX name_ind(name)
+    ) ENGINE=INNODB;
+
+CREATE TABLE team_members (
+    team_id MEDIUMINT NOT NULL,
+    principal varchar(255) NOT NULL,
+    role varchar(20) NOT NULL,
+    PRIMARY KEY(team_id, principal),
+    FOREIGN KEY (team_id)
+        REFERENCES teams(id)
+        ON DELETE CASCADE
+    ) ENGINE=INNODB;
+
+ALTER TABLE registrations
+    ADD COLUMN team_id MEDIUMINT NULL,
+    ADD FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE SET NULL;
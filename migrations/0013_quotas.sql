@@ -0,0 +1,12 @@
+-- registrations and tokens can have a quota limiting the number
+-- of users and the size of their tablespaces, bookmarks record
+-- the size the tablespace of their user can grow to.
+-- Existing registrations and tokens have no quota.
+ALTER TABLE registrations
+    ADD COLUMN quota TEXT NULL;
+
+ALTER TABLE tokens
+    ADD COLUMN quota TEXT NULL;
+
+ALTER TABLE bookmarks
+    ADD COLUMN size BIGINT NULL;
@@ -0,0 +1,5 @@
+-- passwords are encrypted with the id of their registration as additional
+-- data, so they cannot be moved to another registration. Existing passwords
+-- are not bound yet, they are re-encrypted when the server starts.
+ALTER TABLE registrations
+    ADD COLUMN password_bound BOOLEAN NOT NULL DEFAULT FALSE;
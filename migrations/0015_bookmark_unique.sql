@@ -0,0 +1,5 @@
+-- a user can only be bookmarked once for a registration, so rolling back
+-- a failed creation cannot remove the bookmark of an existing user.
+-- Duplicate bookmarks have to be removed before the index is added.
+ALTER TABLE bookmarks
+    ADD UNIQUE INDEX registration_dbname_ind(registration_id, dbname);
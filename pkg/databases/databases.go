@@ -0,0 +1,192 @@
+// Package databases provides a registry of provisioners for the database
+// types banquette can create users in. Backends register themselves under
+// their type name, usually from an init function, in the same way
+// database/sql drivers do.
+package databases
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/saga"
+)
+
+var (
+	// ErrUnknownType is returned by Open if no provisioner
+	// is registered for the type of a database.
+	ErrUnknownType = errors.New("unsupported database type")
+
+	// ErrInvalid is wrapped by provisioners into errors about
+	// usernames or passwords they refuse to use.
+	ErrInvalid = errors.New("invalid input")
+
+	// ErrConflict is matched by errors about objects that already exist.
+	ErrConflict = errors.New("already exists")
+
+	// ErrNotSupported is returned for optional operations
+	// a provisioner does not implement.
+	ErrNotSupported = errors.New("not supported")
+
+	// ErrNotFound is matched by errors of DropUser
+	// if the user to drop does not exist.
+	ErrNotFound = errors.New("does not exist")
+)
+
+// Provisioner is an interface to a registered database to create or drop users.
+// DropUser returns an error matching ErrNotFound if the user and its objects do
+// not exist, and drops the remaining objects of a partly dropped user.
+type Provisioner interface {
+	Close()
+	CreateUser(username, password string) error
+	DropUser(username string) error
+}
+
+// Planner is implemented by provisioners that can report the statements
+// CreateUser would run without running them. Passwords are redacted.
+type Planner interface {
+	PlanCreateUser(username, password string) ([]string, error)
+}
+
+// Stepper is implemented by provisioners that can split CreateUser
+// into steps which undo themselves if a later step fails.
+type Stepper interface {
+	CreateUserSteps(username, password string) ([]saga.Step, error)
+}
+
+// Sizer is implemented by provisioners that allocate storage for each
+// user, e.g. a tablespace, so quotas can limit it.
+type Sizer interface {
+	// UserSize returns the bytes the storage of a created user can
+	// grow to, or -1 if it is not limited.
+	UserSize() (int64, error)
+}
+
+// PasswordChanger is implemented by provisioners that can
+// change the password of an existing user.
+type PasswordChanger interface {
+	ChangePassword(username, password string) error
+}
+
+// AccountLocker is implemented by provisioners that can suspend users
+// without dropping them and force them to change their password.
+type AccountLocker interface {
+	LockUser(username string) error
+	UnlockUser(username string) error
+	ExpirePassword(username string) error
+}
+
+// Inventory is implemented by provisioners that can list the users in their
+// database, so bookmarks can be reconciled with what actually exists.
+type Inventory interface {
+	// Inventory returns the users that look like they were created by the
+	// provisioner and the objects named after a user, e.g. tablespaces.
+	// Users are returned as objects of kind "user".
+	Inventory() ([]Object, error)
+}
+
+// Object is a database object such as a user or a tablespace.
+type Object struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// QueryObjects returns the names selected by query as objects of kind.
+// It is used by provisioners to implement Inventory.
+func QueryObjects(db *sql.DB, kind, query string, args ...interface{}) ([]Object, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query %vs: %v", kind, err)
+	}
+	defer rows.Close()
+
+	var objects []Object
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("could not read %v: %v", kind, err)
+		}
+		objects = append(objects, Object{Kind: kind, Name: name})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not query %vs: %v", kind, err)
+	}
+	return objects, nil
+}
+
+// ConflictError is returned if objects that should be created already exist.
+type ConflictError struct {
+	Objects []Object
+}
+
+func (e *ConflictError) Error() string {
+	names := make([]string, len(e.Objects))
+	for i, o := range e.Objects {
+		names[i] = o.Kind + " " + o.Name
+	}
+	return strings.Join(names, ", ") + " already exists"
+}
+
+// Is reports whether target is ErrConflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Factory connects to a registered database and
+// returns a Provisioner to manage its users.
+type Factory func(data *models.Database) (Provisioner, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a provisioner available under the database type name.
+// If Register is called twice with the same name or if factory is nil, it panics.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("databases: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("databases: Register called twice for type " + name)
+	}
+	factories[name] = factory
+}
+
+// Registered reports whether a provisioner is registered for the database type name.
+func Registered(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Types returns a sorted list of the registered database types.
+func Types() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	var list []string
+	for name := range factories {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Open connects to a registered database using
+// the provisioner registered for its type.
+func Open(data *models.Database) (Provisioner, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[data.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, data.Type)
+	}
+	return factory(data)
+}
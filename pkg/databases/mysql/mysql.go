@@ -0,0 +1,242 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+var (
+	// UserHost is the host part of created 'user'@'host' accounts.
+	UserHost = "%"
+
+	// Grants are the privileges a created user gets on its own schema.
+	Grants = []string{"ALL PRIVILEGES"}
+
+	validGrant = regexp.MustCompile(`^[A-Za-z]+( [A-Za-z]+)*$`)
+)
+
+// maxUsernameLength is the longest user name MySQL accepts
+const maxUsernameLength = 32
+
+func init() {
+	databases.Register("mysql", func(data *models.Database) (databases.Provisioner, error) {
+		db, err := Open(data)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+}
+
+// DB is a database handle representing a pool of zero or more underlying connections.
+// It's safe for concurrent use by multiple goroutines.
+type DB struct {
+	*sql.DB
+	// noBackslashEscapes is set if the server runs with the NO_BACKSLASH_ESCAPES
+	// sql_mode and takes backslashes in string literals literally
+	noBackslashEscapes bool
+}
+
+// NewDB connects to the database of the registration with id registrationID
+func NewDB(registrationID int, store models.Datastore) (*DB, error) {
+	data, err := store.GetDatabase(registrationID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get database: %v", err)
+	}
+	return Open(data)
+}
+
+// Open connects to the registered database described by data.
+func Open(data *models.Database) (*DB, error) {
+	cfg := driver.NewConfig()
+	cfg.User = data.Username
+	cfg.Passwd = data.Password
+	cfg.Net = "tcp"
+	cfg.Addr = data.DBAddr
+	cfg.DBName = data.DBName
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to database (%v/%v): %v", data.DBAddr, data.DBName, err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	var mode string
+	if err := db.QueryRow("SELECT @@SESSION.sql_mode").Scan(&mode); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not get sql_mode: %v", err)
+	}
+	return &DB{DB: db, noBackslashEscapes: strings.Contains(mode, "NO_BACKSLASH_ESCAPES")}, nil
+}
+
+// Close closes the database, releasing any open resources.
+func (db *DB) Close() {
+	db.DB.Close()
+}
+
+// CreateUser creates a user account and a schema
+// of the same name the account is granted access to
+func (db *DB) CreateUser(username, password string) error {
+	if err := notEmpty(map[string]string{
+		"username": username,
+		"password": password,
+	}); err != nil {
+		return err
+	}
+	if utf8.RuneCountInString(username) > maxUsernameLength {
+		return fmt.Errorf("%w: username must not be longer than %v characters", databases.ErrInvalid, maxUsernameLength)
+	}
+	for _, grant := range Grants {
+		if !validGrant.MatchString(grant) {
+			return fmt.Errorf("invalid grant configured: %q", grant)
+		}
+	}
+
+	account := db.account(username)
+	schema := quoteIdentifier(username)
+	if _, err := db.Exec("CREATE USER " + account + " IDENTIFIED BY " + db.quoteLiteral(password)); err != nil {
+		return fmt.Errorf("could not create user (%v): %v", username, err)
+	}
+
+	if _, err := db.Exec("CREATE DATABASE " + schema); err != nil {
+		if _, err := db.Exec("DROP USER " + account); err != nil {
+			return fmt.Errorf("could not drop user (%v) after schema creation failed: %v", username, err)
+		}
+		return fmt.Errorf("could not create schema (%v): %v", username, err)
+	}
+
+	if _, err := db.Exec("GRANT " + strings.Join(Grants, ", ") + " ON " + schema + ".* TO " + account); err != nil {
+		if err := db.DropUser(username); err != nil {
+			return fmt.Errorf("could not clean up after grant failed: %v", err)
+		}
+		return fmt.Errorf("could not grant %v to %v: %v", strings.Join(Grants, ", "), username, err)
+	}
+	return nil
+}
+
+// ChangePassword sets a new password for the account of username
+func (db *DB) ChangePassword(username, password string) error {
+	if err := notEmpty(map[string]string{
+		"username": username,
+		"password": password,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("ALTER USER " + db.account(username) + " IDENTIFIED BY " + db.quoteLiteral(password)); err != nil {
+		return fmt.Errorf("could not change password of user (%v): %v", username, err)
+	}
+	return nil
+}
+
+// LockUser locks the account of username
+func (db *DB) LockUser(username string) error {
+	return db.alterUser(username, "ACCOUNT LOCK", "lock user")
+}
+
+// UnlockUser unlocks the account of username
+func (db *DB) UnlockUser(username string) error {
+	return db.alterUser(username, "ACCOUNT UNLOCK", "unlock user")
+}
+
+// ExpirePassword expires the password of username
+func (db *DB) ExpirePassword(username string) error {
+	return db.alterUser(username, "PASSWORD EXPIRE", "expire password of user")
+}
+
+// alterUser runs ALTER USER for the account of username with clause
+func (db *DB) alterUser(username, clause, desc string) error {
+	if _, err := db.Exec("ALTER USER " + db.account(username) + " " + clause); err != nil {
+		return fmt.Errorf("could not %v (%v): %v", desc, username, err)
+	}
+	return nil
+}
+
+// Inventory returns the accounts at UserHost with a schema named after
+// them, as created by CreateUser, and the schemas that are not system schemas.
+func (db *DB) Inventory() ([]databases.Object, error) {
+	users, err := databases.QueryObjects(db.DB, "user", "SELECT u.user FROM mysql.user u JOIN information_schema.schemata s ON s.schema_name = u.user WHERE u.host = ?", UserHost)
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := databases.QueryObjects(db.DB, "database", "SELECT schema_name FROM information_schema.schemata WHERE schema_name NOT IN ('mysql', 'information_schema', 'performance_schema', 'sys')")
+	if err != nil {
+		return nil, err
+	}
+	return append(users, schemas...), nil
+}
+
+// DropUser drops the user account and schema matching username.
+// Objects that do not exist are skipped, if neither exists
+// it returns an error matching databases.ErrNotFound.
+func (db *DB) DropUser(username string) error {
+	userExists, err := db.exists("user", "SELECT count(*) FROM mysql.user WHERE user = ? AND host = ?", username, UserHost)
+	if err != nil {
+		return err
+	}
+	schemaExists, err := db.exists("schema", "SELECT count(*) FROM information_schema.schemata WHERE schema_name = ?", username)
+	if err != nil {
+		return err
+	}
+	if !userExists && !schemaExists {
+		return fmt.Errorf("user %v: %w", username, databases.ErrNotFound)
+	}
+
+	if userExists {
+		if _, err := db.Exec("DROP USER " + db.account(username)); err != nil {
+			return fmt.Errorf("could not drop user (%v): %v", username, err)
+		}
+	}
+	if schemaExists {
+		if _, err := db.Exec("DROP DATABASE " + quoteIdentifier(username)); err != nil {
+			return fmt.Errorf("could not drop schema (%v): %v", username, err)
+		}
+	}
+	return nil
+}
+
+// exists reports whether the count(*) query of kind counts any rows
+func (db *DB) exists(kind, query string, args ...interface{}) (bool, error) {
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		return false, fmt.Errorf("could not query %vs: %v", kind, err)
+	}
+	return n > 0, nil
+}
+
+// account returns the quoted 'user'@'host' form of username
+func (db *DB) account(username string) string {
+	return db.quoteLiteral(username) + "@" + db.quoteLiteral(UserHost)
+}
+
+// quoteIdentifier quotes name as a backtick delimited identifier
+func quoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// quoteLiteral quotes s as a single quoted string literal,
+// escaping backslashes unless the server treats them literally
+func (db *DB) quoteLiteral(s string) string {
+	if !db.noBackslashEscapes {
+		s = strings.Replace(s, `\`, `\\`, -1)
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// notEmpty checks if a string inside a map is empty or not
+func notEmpty(args map[string]string) error {
+	for key, value := range args {
+		if len(value) <= 0 {
+			return fmt.Errorf("%v is missing", key)
+		}
+	}
+	return nil
+}
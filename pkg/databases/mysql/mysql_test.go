@@ -0,0 +1,292 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/internal/sqltest"
+)
+
+func TestDB_CreateUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		grants   []string
+		fail     string
+		// noBackslashEscapes sets the sql_mode of the server
+		noBackslashEscapes bool
+		wantStmts          []string
+		wantErr            error
+	}{
+		{name: "create user", username: "testuser", password: "test pw", wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'test pw'`,
+			"CREATE DATABASE `testuser`",
+			"GRANT ALL PRIVILEGES ON `testuser`.* TO 'testuser'@'%'",
+		}},
+		{name: "configured grants", username: "testuser", password: "testpw", grants: []string{"SELECT", "INSERT", "CREATE TEMPORARY TABLES"}, wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'testpw'`,
+			"CREATE DATABASE `testuser`",
+			"GRANT SELECT, INSERT, CREATE TEMPORARY TABLES ON `testuser`.* TO 'testuser'@'%'",
+		}},
+		{name: "quotes in username", username: "x'`y", password: "testpw", wantStmts: []string{
+			`CREATE USER 'x''` + "`" + `y'@'%' IDENTIFIED BY 'testpw'`,
+			"CREATE DATABASE `x'``y`",
+			"GRANT ALL PRIVILEGES ON `x'``y`.* TO 'x''`y'@'%'",
+		}},
+		{name: "backslash in password", username: "testuser", password: `pw\' OR 1 --`, wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'pw\\'' OR 1 --'`,
+			"CREATE DATABASE `testuser`",
+			"GRANT ALL PRIVILEGES ON `testuser`.* TO 'testuser'@'%'",
+		}},
+		{name: "backslash in password without backslash escapes", username: "testuser", password: `pw\' OR 1 --`, noBackslashEscapes: true, wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'pw\'' OR 1 --'`,
+			"CREATE DATABASE `testuser`",
+			"GRANT ALL PRIVILEGES ON `testuser`.* TO 'testuser'@'%'",
+		}},
+		{name: "user creation fails", username: "testuser", password: "testpw", fail: "CREATE USER", wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'testpw'`,
+		}, wantErr: errors.New("could not create user (testuser): simulated failure")},
+		{name: "schema creation fails", username: "testuser", password: "testpw", fail: "CREATE DATABASE", wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'testpw'`,
+			"CREATE DATABASE `testuser`",
+			`DROP USER 'testuser'@'%'`,
+		}, wantErr: errors.New("could not create schema (testuser): simulated failure")},
+		{name: "grant fails", username: "testuser", password: "testpw", fail: "GRANT", wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'testpw'`,
+			"CREATE DATABASE `testuser`",
+			"GRANT ALL PRIVILEGES ON `testuser`.* TO 'testuser'@'%'",
+			`DROP USER 'testuser'@'%'`,
+			"DROP DATABASE `testuser`",
+		}, wantErr: errors.New("could not grant ALL PRIVILEGES to testuser: simulated failure")},
+		{name: "grant and cleanup fail", username: "testuser", password: "testpw", fail: "GRANT|DROP USER", wantStmts: []string{
+			`CREATE USER 'testuser'@'%' IDENTIFIED BY 'testpw'`,
+			"CREATE DATABASE `testuser`",
+			"GRANT ALL PRIVILEGES ON `testuser`.* TO 'testuser'@'%'",
+			`DROP USER 'testuser'@'%'`,
+		}, wantErr: errors.New("could not clean up after grant failed: could not drop user (testuser): simulated failure")},
+		{name: "invalid grant configured", username: "testuser", password: "testpw", grants: []string{"ALL; DROP DATABASE mysql"}, wantErr: errors.New(`invalid grant configured: "ALL; DROP DATABASE mysql"`)},
+		{name: "empty grant configured", username: "testuser", password: "testpw", grants: []string{""}, wantErr: errors.New(`invalid grant configured: ""`)},
+		{name: "missing username", password: "testpw", wantErr: errors.New("username is missing")},
+		{name: "missing password", username: "testuser", wantErr: errors.New("password is missing")},
+		{name: "username too long", username: strings.Repeat("u", 33), password: "testpw", wantErr: databases.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.grants != nil {
+				defer func(grants []string) { Grants = grants }(Grants)
+				Grants = tt.grants
+			}
+			db, rec := newTestDB(t)
+			db.noBackslashEscapes = tt.noBackslashEscapes
+			rec.Fail = sqltest.Failing(tt.fail)
+			rec.Count = func(query string, args []driver.Value) int64 { return 1 }
+
+			err := db.CreateUser(tt.username, tt.password)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestDB_DropUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		existing  string
+		fail      string
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "drop user", username: "testuser", existing: "mysql.user|information_schema.schemata", wantStmts: []string{
+			`DROP USER 'testuser'@'%'`,
+			"DROP DATABASE `testuser`",
+		}},
+		{name: "schema left over", username: "testuser", existing: "information_schema.schemata", wantStmts: []string{
+			"DROP DATABASE `testuser`",
+		}},
+		{name: "user without schema", username: "testuser", existing: "mysql.user", wantStmts: []string{
+			`DROP USER 'testuser'@'%'`,
+		}},
+		{name: "quotes in username", username: "x'; DROP USER root --`", existing: "mysql.user|information_schema.schemata", wantStmts: []string{
+			`DROP USER 'x''; DROP USER root --` + "`" + `'@'%'`,
+			"DROP DATABASE `x'; DROP USER root --```",
+		}},
+		{name: "user drop fails", username: "testuser", existing: "mysql.user|information_schema.schemata", fail: "DROP USER", wantStmts: []string{
+			`DROP USER 'testuser'@'%'`,
+		}, wantErr: errors.New("could not drop user (testuser): simulated failure")},
+		{name: "user does not exist", username: "testuser", wantErr: databases.ErrNotFound},
+		{name: "existence check fails", username: "testuser", fail: "SELECT count(*) FROM mysql.user", wantErr: errors.New("could not query users: simulated failure")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+			rec.Fail = sqltest.Failing(tt.fail)
+			rec.Count = func(query string, args []driver.Value) int64 {
+				if len(args) == 0 || args[0] != tt.username {
+					t.Errorf("expected the username as first argument of %q; got %v", query, args)
+				}
+				for _, table := range strings.Split(tt.existing, "|") {
+					if table != "" && strings.Contains(query, table) {
+						return 1
+					}
+				}
+				return 0
+			}
+
+			err := db.DropUser(tt.username)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestDB_AlterUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		alter     func(db *DB) error
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "change password", alter: func(db *DB) error { return db.ChangePassword("testuser", "new pw") }, wantStmts: []string{
+			`ALTER USER 'testuser'@'%' IDENTIFIED BY 'new pw'`,
+		}},
+		{name: "quote in password", alter: func(db *DB) error { return db.ChangePassword("x'y", `pw' ACCOUNT UNLOCK --`) }, wantStmts: []string{
+			`ALTER USER 'x''y'@'%' IDENTIFIED BY 'pw'' ACCOUNT UNLOCK --'`,
+		}},
+		{name: "missing password", alter: func(db *DB) error { return db.ChangePassword("testuser", "") }, wantErr: errors.New("password is missing")},
+		{name: "lock", alter: func(db *DB) error { return db.LockUser("testuser") }, wantStmts: []string{
+			`ALTER USER 'testuser'@'%' ACCOUNT LOCK`,
+		}},
+		{name: "unlock", alter: func(db *DB) error { return db.UnlockUser("testuser") }, wantStmts: []string{
+			`ALTER USER 'testuser'@'%' ACCOUNT UNLOCK`,
+		}},
+		{name: "expire password", alter: func(db *DB) error { return db.ExpirePassword(`x\'`) }, wantStmts: []string{
+			`ALTER USER 'x\\'''@'%' PASSWORD EXPIRE`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+
+			err := tt.alter(db)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in             string
+		wantIdentifier string
+		wantLiteral    string
+		// wantRawLiteral is the literal with NO_BACKSLASH_ESCAPES
+		wantRawLiteral string
+	}{
+		{in: "plain", wantIdentifier: "`plain`", wantLiteral: `'plain'`, wantRawLiteral: `'plain'`},
+		{in: "back`tick", wantIdentifier: "`back``tick`", wantLiteral: "'back`tick'", wantRawLiteral: "'back`tick'"},
+		{in: "it's", wantIdentifier: "`it's`", wantLiteral: `'it''s'`, wantRawLiteral: `'it''s'`},
+		{in: `back\slash`, wantIdentifier: "`back\\slash`", wantLiteral: `'back\\slash'`, wantRawLiteral: `'back\slash'`},
+		{in: `\'`, wantIdentifier: "`\\'`", wantLiteral: `'\\'''`, wantRawLiteral: `'\'''`},
+		{in: "", wantIdentifier: "``", wantLiteral: `''`, wantRawLiteral: `''`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := quoteIdentifier(tt.in); got != tt.wantIdentifier {
+				t.Errorf("expected identifier %v; got %v", tt.wantIdentifier, got)
+			}
+			if got := (&DB{}).quoteLiteral(tt.in); got != tt.wantLiteral {
+				t.Errorf("expected literal %v; got %v", tt.wantLiteral, got)
+			}
+			if got := (&DB{noBackslashEscapes: true}).quoteLiteral(tt.in); got != tt.wantRawLiteral {
+				t.Errorf("expected literal without backslash escapes %v; got %v", tt.wantRawLiteral, got)
+			}
+		})
+	}
+}
+
+func TestValidGrant(t *testing.T) {
+	tests := []struct {
+		grant string
+		want  bool
+	}{
+		{grant: "ALL PRIVILEGES", want: true},
+		{grant: "SELECT", want: true},
+		{grant: "CREATE TEMPORARY TABLES", want: true},
+		{grant: "", want: false},
+		{grant: "SELECT, INSERT", want: false},
+		{grant: "ALL ON *.* TO root", want: false},
+		{grant: "SELECT; DROP DATABASE mysql", want: false},
+		{grant: "SELECT ", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.grant, func(t *testing.T) {
+			if got := validGrant.MatchString(tt.grant); got != tt.want {
+				t.Errorf("expected %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_Inventory(t *testing.T) {
+	db, rec := newTestDB(t)
+	rec.Rows = func(query string) []string {
+		if strings.HasPrefix(query, "SELECT u.user") {
+			return []string{"alice", "bob"}
+		}
+		return []string{"alice", "orphan"}
+	}
+
+	got, err := db.Inventory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []databases.Object{
+		{Kind: "user", Name: "alice"},
+		{Kind: "user", Name: "bob"},
+		{Kind: "database", Name: "alice"},
+		{Kind: "database", Name: "orphan"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected objects %v; got %v", want, got)
+	}
+}
+
+// checkErr fails the test if err does not match want. databases.ErrNotFound
+// and databases.ErrInvalid are compared with errors.Is, other errors by message.
+func checkErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want == nil:
+	case err == nil:
+		t.Fatalf("expected error %v; got nil", want)
+	case want == databases.ErrNotFound || want == databases.ErrInvalid:
+		if !errors.Is(err, want) {
+			t.Fatalf("expected error %v; got %v", want, err)
+		}
+	case err.Error() != want.Error():
+		t.Fatalf("expected error %v; got %v", want, err)
+	}
+}
+
+// newTestDB returns a DB backed by a recorder
+func newTestDB(t *testing.T) (*DB, *sqltest.Recorder) {
+	db, rec := sqltest.Open(t, "fakemysql")
+	return &DB{DB: db}, rec
+}
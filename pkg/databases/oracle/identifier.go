@@ -0,0 +1,106 @@
+package oracle
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/svenbs/banquette/pkg/databases"
+)
+
+const (
+	// maxIdentifierLength is the identifier limit of Oracle releases before 12.2
+	maxIdentifierLength = 30
+	// maxPasswordLength is the longest password Oracle accepts
+	maxPasswordLength = 30
+
+	// redactedPassword replaces passwords in planned statements
+	redactedPassword = `"********"`
+)
+
+var (
+	validIdentifierChars = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]*$`)
+
+	// reservedWords are the Oracle reserved words, which cannot be used as
+	// unquoted identifiers, and accounts maintained by Oracle itself.
+	// Usernames must not match any of them.
+	reservedWords = map[string]bool{}
+)
+
+func init() {
+	for _, word := range strings.Fields(`
+		ACCESS ADD ALL ALTER AND ANY AS ASC AUDIT BETWEEN BY CHAR CHECK CLUSTER
+		COLUMN COMMENT COMPRESS CONNECT CREATE CURRENT DATE DECIMAL DEFAULT DELETE
+		DESC DISTINCT DROP ELSE EXCLUSIVE EXISTS FILE FLOAT FOR FROM GRANT GROUP
+		HAVING IDENTIFIED IMMEDIATE IN INCREMENT INDEX INITIAL INSERT INTEGER
+		INTERSECT INTO IS LEVEL LIKE LOCK LONG MAXEXTENTS MINUS MLSLABEL MODE MODIFY
+		NOAUDIT NOCOMPRESS NOT NOWAIT NULL NUMBER OF OFFLINE ON ONLINE OPTION OR
+		ORDER PCTFREE PRIOR PRIVILEGES PUBLIC RAW RENAME RESOURCE REVOKE ROW ROWID
+		ROWNUM ROWS SELECT SESSION SET SHARE SIZE SMALLINT START SUCCESSFUL SYNONYM
+		SYSDATE TABLE THEN TO TRIGGER UID UNION UNIQUE UPDATE USER VALIDATE VALUES
+		VARCHAR VARCHAR2 VIEW WHENEVER WHERE WITH
+
+		ANONYMOUS APPQOSSYS AUDSYS CTXSYS DBSNMP DIP DVSYS GSMADMIN_INTERNAL LBACSYS
+		MDSYS OJVMSYS OLAPSYS ORACLE_OCM ORDDATA ORDSYS OUTLN SYS SYSBACKUP SYSDG
+		SYSKM SYSRAC SYSTEM WMSYS XDB XS$NULL
+	`) {
+		reservedWords[word] = true
+	}
+}
+
+// validUsername checks that name can be used as the name of a created user
+// and its tablespace. Besides the rules of validIdentifier it must not be a
+// reserved word or the name of an Oracle maintained account.
+func validUsername(name string) error {
+	if err := validIdentifier("username", name); err != nil {
+		return err
+	}
+	if reservedWords[strings.ToUpper(name)] {
+		return fmt.Errorf("%w: username %q is reserved", databases.ErrInvalid, name)
+	}
+	return nil
+}
+
+// validIdentifier checks that name is a valid nonquoted Oracle identifier.
+// kind names the identifier in the returned error.
+func validIdentifier(kind, name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("%w: %v is missing", databases.ErrInvalid, kind)
+	}
+	if len(name) > maxIdentifierLength {
+		return fmt.Errorf("%w: %v must not be longer than %v characters", databases.ErrInvalid, kind, maxIdentifierLength)
+	}
+	if !validIdentifierChars.MatchString(name) {
+		return fmt.Errorf("%w: %v %q must start with a letter and contain only letters, digits, _, $ and #", databases.ErrInvalid, kind, name)
+	}
+	return nil
+}
+
+// validPassword checks that password can be used as a quoted Oracle password
+func validPassword(password string) error {
+	if len(password) == 0 {
+		return fmt.Errorf("%w: password is missing", databases.ErrInvalid)
+	}
+	if len(password) > maxPasswordLength {
+		return fmt.Errorf("%w: password must not be longer than %v characters", databases.ErrInvalid, maxPasswordLength)
+	}
+	for _, r := range password {
+		if r == '"' || r < ' ' || r == 0x7f {
+			return fmt.Errorf("%w: password must not contain double quotes or control characters", databases.ErrInvalid)
+		}
+	}
+	return nil
+}
+
+// quoteIdentifier returns name as a quoted identifier. Names are upper
+// cased so they refer to the same object as the nonquoted name would.
+// name must have been checked by validIdentifier.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ToUpper(name) + `"`
+}
+
+// quotePassword returns password quoted for an identified by clause.
+// password must have been checked by validPassword.
+func quotePassword(password string) string {
+	return `"` + password + `"`
+}
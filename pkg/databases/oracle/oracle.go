@@ -3,41 +3,60 @@ package oracle
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
+	"github.com/svenbs/banquette/pkg/databases"
 	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/saga"
 
 	// oracle connection
 	_ "github.com/mattn/go-oci8"
 )
 
 // OraDB is an interface to a registered database to create or drop users.
-type OraDB interface {
-	Close()
-	CreateUser(username, password string) error
-	DropUser(username string) error
+type OraDB = databases.Provisioner
+
+func init() {
+	databases.Register("oracle", func(data *models.Database) (databases.Provisioner, error) {
+		db, err := Open(data)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
 }
 
 // DB is a database handle representing a pool of zero or more underlying connections.
 // It's safe for concurrent use by multiple goroutines.
 type DB struct {
 	*sql.DB
+	template *models.UserTemplate
 }
 
-// NewDB creates a new DB object
-func NewDB(token string, tokenstore models.Datastore) (*DB, error) {
-	data, err := tokenstore.Get(token)
+// NewDB connects to the database of the registration with id registrationID
+func NewDB(registrationID int, store models.Datastore) (*DB, error) {
+	data, err := store.GetDatabase(registrationID)
 	if err != nil {
-		return nil, fmt.Errorf("could not get database for token (%v): %v", token, err)
+		return nil, fmt.Errorf("could not get database: %v", err)
 	}
+	return Open(data)
+}
 
+// Open connects to the registered database described by data.
+func Open(data *models.Database) (*DB, error) {
 	db, err := sql.Open("oci8", data.Username+":"+data.Password+"@"+data.DBAddr+"/"+data.DBName)
 	if err != nil {
-		return nil, fmt.Errorf("could not connect to database matching token (%v): %v", token, err)
+		return nil, fmt.Errorf("could not connect to database (%v/%v): %v", data.DBAddr, data.DBName, err)
 	}
 	if err := db.Ping(); err != nil {
 		return nil, err
 	}
-	return &DB{db}, nil
+
+	template := data.Template
+	if template == nil {
+		template = models.DefaultUserTemplate()
+	}
+	return &DB{DB: db, template: template}, nil
 }
 
 // Close closes the database, releasing any open resources.
@@ -45,76 +64,304 @@ func (db *DB) Close() {
 	db.DB.Close()
 }
 
+// statement is a DDL statement run by CreateUser
+type statement struct {
+	name string
+	sql  string
+	// redacted is sql without the password
+	redacted string
+	// desc describes the statement in errors
+	desc string
+	// undo reverts sql during a rollback
+	undo string
+}
+
 // CreateUser creates a user and a tablespace
+// as described by the user template of the registered database.
+// username and password are validated and the user and tablespace
+// are checked to not exist before any statement is run.
+// If a statement fails, the ones that already ran are undone.
 func (db *DB) CreateUser(username, password string) error {
-	if err := notEmpty(map[string]string{
-		"username": username,
-		"password": password,
-	}); err != nil {
+	steps, err := db.CreateUserSteps(username, password)
+	if err != nil {
 		return err
 	}
+	_, err = saga.Run(steps)
+	return err
+}
 
-	tablespace := username
-	if _, err := db.Exec("CREATE bigfile tablespace " + tablespace + " datafile size 100M autoextend on next 100M"); err != nil {
-		return fmt.Errorf("could not create tablespace (%v): %v", tablespace, err)
+// CreateUserSteps returns the steps of CreateUser, so callers
+// can run them as part of a larger saga.
+func (db *DB) CreateUserSteps(username, password string) ([]saga.Step, error) {
+	stmts, err := db.plan(username, password)
+	if err != nil {
+		return nil, err
 	}
 
-	_, err := db.Exec("CREATE user " + username + " profile APPUSERS default tablespace " + tablespace + " identified by " + password + " account unlock quota unlimited on " + tablespace)
+	steps := make([]saga.Step, len(stmts))
+	for i, stmt := range stmts {
+		stmt := stmt
+		steps[i] = saga.Step{
+			Name: stmt.name,
+			Do: func() error {
+				if _, err := db.Exec(stmt.sql); err != nil {
+					return fmt.Errorf("could not %v: %v", stmt.desc, err)
+				}
+				return nil
+			},
+		}
+		if stmt.undo != "" {
+			steps[i].Undo = func() error {
+				if _, err := db.Exec(stmt.undo); err != nil {
+					return fmt.Errorf("could not undo %v: %v", stmt.desc, err)
+				}
+				return nil
+			}
+		}
+	}
+	return steps, nil
+}
+
+// PlanCreateUser returns the statements CreateUser would run
+// for username with the password redacted.
+func (db *DB) PlanCreateUser(username, password string) ([]string, error) {
+	stmts, err := db.plan(username, password)
 	if err != nil {
-		if _, err := db.Exec("DROP tablespace " + tablespace); err != nil {
-			return fmt.Errorf("could not drop tablespace (%v) after user creation failed: %v", tablespace, err)
+		return nil, err
+	}
+	plan := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		plan[i] = stmt.redacted
+	}
+	return plan, nil
+}
+
+// plan validates its arguments, runs the pre-flight checks
+// and returns the statements to create username.
+func (db *DB) plan(username, password string) ([]statement, error) {
+	if err := validUsername(username); err != nil {
+		return nil, err
+	}
+	if err := validPassword(password); err != nil {
+		return nil, err
+	}
+	t := db.template
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid user template: %v", err)
+	}
+	if err := db.preflight(username); err != nil {
+		return nil, err
+	}
+
+	user := quoteIdentifier(username)
+	tablespace := user
+	create := "CREATE bigfile tablespace " + tablespace + " datafile " + datafileClause(t)
+	stmts := []statement{{
+		name:     "create tablespace",
+		sql:      create,
+		redacted: create,
+		desc:     fmt.Sprintf("create tablespace (%v)", username),
+		undo:     "DROP tablespace " + tablespace + " including contents and datafiles",
+	}}
+
+	stmt := "CREATE user " + user
+	if t.Profile != "" {
+		stmt += " profile " + quoteIdentifier(t.Profile)
+	}
+	stmt += " default tablespace " + tablespace
+	if t.TemporaryTablespace != "" {
+		stmt += " temporary tablespace " + quoteIdentifier(t.TemporaryTablespace)
+	}
+	quota := " account unlock quota " + sizeOr(t.Quota, "UNLIMITED") + " on " + tablespace
+	stmts = append(stmts, statement{
+		name:     "create user",
+		sql:      stmt + " identified by " + quotePassword(password) + quota,
+		redacted: stmt + " identified by " + redactedPassword + quota,
+		desc:     fmt.Sprintf("create user (%v)", username),
+		undo:     "DROP user " + user + " cascade",
+	})
+
+	if len(t.Roles) > 0 {
+		roles := make([]string, len(t.Roles))
+		for i, role := range t.Roles {
+			roles[i] = quoteIdentifier(role)
 		}
-		return fmt.Errorf("could not create user (%v): %v", username, err)
+		grant := "GRANT " + strings.Join(roles, ", ") + " to " + user
+		stmts = append(stmts, statement{
+			name:     "grant roles",
+			sql:      grant,
+			redacted: grant,
+			desc:     fmt.Sprintf("grant role %v to %v", strings.Join(t.Roles, ", "), username),
+		})
+	}
+	if len(t.Privileges) > 0 {
+		privileges := strings.Join(t.Privileges, ", ")
+		grant := "GRANT " + privileges + " to " + user
+		stmts = append(stmts, statement{
+			name:     "grant privileges",
+			sql:      grant,
+			redacted: grant,
+			desc:     fmt.Sprintf("grant privileges %v to %v", privileges, username),
+		})
+	}
+	return stmts, nil
+}
+
+// preflight checks that neither the user nor the tablespace for username exist
+func (db *DB) preflight(username string) error {
+	var conflicts []databases.Object
+	exists, err := db.userExists(username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		conflicts = append(conflicts, databases.Object{Kind: "user", Name: strings.ToUpper(username)})
+	}
+
+	exists, err = db.tablespaceExists(username)
+	if err != nil {
+		return err
+	}
+	if exists {
+		conflicts = append(conflicts, databases.Object{Kind: "tablespace", Name: strings.ToUpper(username)})
 	}
 
-	if _, err := db.Exec("GRANT GSB to " + username); err != nil {
-		return fmt.Errorf("could not grant role GSB to %v: %v", username, err)
+	if len(conflicts) > 0 {
+		return &databases.ConflictError{Objects: conflicts}
 	}
 	return nil
 }
 
-func (db *DB) checkUser(name string) error {
+// UserSize returns the size the tablespace of a created user can grow to
+func (db *DB) UserSize() (int64, error) {
+	return db.template.Size()
+}
+
+// datafileClause returns the size and autoextend clause of a datafile for t
+func datafileClause(t *models.UserTemplate) string {
+	def := models.DefaultUserTemplate()
+	clause := "size " + sizeOr(t.InitialSize, def.InitialSize)
+	if t.Increment == "" {
+		return clause + " autoextend off"
+	}
+	clause += " autoextend on next " + t.Increment
+	if t.MaxSize != "" {
+		clause += " maxsize " + t.MaxSize
+	}
+	return clause
+}
+
+// sizeOr returns size or def if size is empty
+func sizeOr(size, def string) string {
+	if size == "" {
+		return def
+	}
+	return size
+}
+
+func (db *DB) userExists(name string) (bool, error) {
 	var value int
-	err := db.QueryRow("SELECT count(*) from dba_users where username=:1", name).Scan(&value)
+	err := db.QueryRow("SELECT count(*) from dba_users where username=:1", strings.ToUpper(name)).Scan(&value)
 	if err != nil {
-		return fmt.Errorf("could not query tablespace: %v", err)
+		return false, fmt.Errorf("could not query users: %v", err)
 	}
+	return value > 0, nil
+}
 
-	if value > 0 {
-		return fmt.Errorf("user already exists")
+func (db *DB) tablespaceExists(name string) (bool, error) {
+	var value int
+	err := db.QueryRow("SELECT count(*) from dba_tablespaces where tablespace_name=:1", strings.ToUpper(name)).Scan(&value)
+	if err != nil {
+		return false, fmt.Errorf("could not query tablespace: %v", err)
 	}
-	return nil
+	return value > 0, nil
 }
 
-func (db *DB) checkTablespace(name string) error {
-	var value int
-	err := db.QueryRow("SELECT count(*) from dba_tablespaces where tablespace_name=:1", name).Scan(&value)
+// Inventory returns the users with a default tablespace named after them,
+// as created by CreateUser, and the bigfile tablespaces that are not used
+// by Oracle maintained accounts.
+func (db *DB) Inventory() ([]databases.Object, error) {
+	users, err := databases.QueryObjects(db.DB, "user", "SELECT username from dba_users where oracle_maintained='N' and default_tablespace=username")
+	if err != nil {
+		return nil, err
+	}
+	tablespaces, err := databases.QueryObjects(db.DB, "tablespace", "SELECT tablespace_name from dba_tablespaces where bigfile='YES' and contents='PERMANENT' and tablespace_name not in (SELECT default_tablespace from dba_users where oracle_maintained='Y')")
 	if err != nil {
-		return fmt.Errorf("could not query tablespace: %v", err)
+		return nil, err
 	}
+	return append(users, tablespaces...), nil
+}
 
-	if value > 0 {
-		return fmt.Errorf("tablespace already exists")
+// ChangePassword sets a new password for username
+func (db *DB) ChangePassword(username, password string) error {
+	if err := validUsername(username); err != nil {
+		return err
+	}
+	if err := validPassword(password); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("ALTER user " + quoteIdentifier(username) + " identified by " + quotePassword(password)); err != nil {
+		return fmt.Errorf("could not change password of user (%v): %v", username, err)
 	}
 	return nil
 }
 
-// DropUser drops the user and tablespace matching username
-func (db *DB) DropUser(username string) error {
-	if _, err := db.Exec("DROP user " + username); err != nil {
-		return fmt.Errorf("could not drop user (%v): %v", username, err)
+// LockUser locks the account of username
+func (db *DB) LockUser(username string) error {
+	return db.alterUser(username, "account lock", "lock user")
+}
+
+// UnlockUser unlocks the account of username
+func (db *DB) UnlockUser(username string) error {
+	return db.alterUser(username, "account unlock", "unlock user")
+}
+
+// ExpirePassword expires the password of username, so
+// it has to be changed with the next login
+func (db *DB) ExpirePassword(username string) error {
+	return db.alterUser(username, "password expire", "expire password of user")
+}
+
+// alterUser runs ALTER user for username with clause. desc describes the change in errors.
+func (db *DB) alterUser(username, clause, desc string) error {
+	if err := validUsername(username); err != nil {
+		return err
 	}
-	if _, err := db.Exec("DROP tablespace " + username); err != nil {
-		return fmt.Errorf("could not drop tablespace (%v): %v", username, err)
+	if _, err := db.Exec("ALTER user " + quoteIdentifier(username) + " " + clause); err != nil {
+		return fmt.Errorf("could not %v (%v): %v", desc, username, err)
 	}
 	return nil
 }
 
-// notEmpty checks if a string inside a map is empty or not
-func notEmpty(args map[string]string) error {
-	for key, value := range args {
-		if len(value) <= 0 {
-			return fmt.Errorf("%v is missing", key)
+// DropUser drops the user and tablespace matching username.
+// Objects that do not exist are skipped, if neither exists
+// it returns an error matching databases.ErrNotFound.
+func (db *DB) DropUser(username string) error {
+	if err := validUsername(username); err != nil {
+		return err
+	}
+	userExists, err := db.userExists(username)
+	if err != nil {
+		return err
+	}
+	tablespaceExists, err := db.tablespaceExists(username)
+	if err != nil {
+		return err
+	}
+	if !userExists && !tablespaceExists {
+		return fmt.Errorf("user %v: %w", username, databases.ErrNotFound)
+	}
+
+	user := quoteIdentifier(username)
+	if userExists {
+		if _, err := db.Exec("DROP user " + user); err != nil {
+			return fmt.Errorf("could not drop user (%v): %v", username, err)
+		}
+	}
+	if tablespaceExists {
+		if _, err := db.Exec("DROP tablespace " + user); err != nil {
+			return fmt.Errorf("could not drop tablespace (%v): %v", username, err)
 		}
 	}
 	return nil
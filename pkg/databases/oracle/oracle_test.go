@@ -0,0 +1,291 @@
+package oracle
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/internal/sqltest"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+func TestDB_CreateUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		fail      string
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "create user", username: "testuser", password: "test pw", wantStmts: []string{
+			`CREATE bigfile tablespace "TESTUSER" datafile size 100M autoextend on next 100M`,
+			`CREATE user "TESTUSER" profile "APPUSERS" default tablespace "TESTUSER" identified by "test pw" account unlock quota UNLIMITED on "TESTUSER"`,
+			`GRANT "GSB" to "TESTUSER"`,
+		}},
+		{name: "user creation fails", username: "testuser", password: "testpw", fail: "CREATE user", wantStmts: []string{
+			`CREATE bigfile tablespace "TESTUSER" datafile size 100M autoextend on next 100M`,
+			`CREATE user "TESTUSER" profile "APPUSERS" default tablespace "TESTUSER" identified by "testpw" account unlock quota UNLIMITED on "TESTUSER"`,
+			`DROP tablespace "TESTUSER" including contents and datafiles`,
+		}, wantErr: errors.New("could not create user (testuser): simulated failure")},
+		{name: "grant fails", username: "testuser", password: "testpw", fail: "GRANT", wantStmts: []string{
+			`CREATE bigfile tablespace "TESTUSER" datafile size 100M autoextend on next 100M`,
+			`CREATE user "TESTUSER" profile "APPUSERS" default tablespace "TESTUSER" identified by "testpw" account unlock quota UNLIMITED on "TESTUSER"`,
+			`GRANT "GSB" to "TESTUSER"`,
+			`DROP user "TESTUSER" cascade`,
+			`DROP tablespace "TESTUSER" including contents and datafiles`,
+		}, wantErr: errors.New("could not grant role GSB to testuser: simulated failure")},
+		{name: "grant and rollback fail", username: "testuser", password: "testpw", fail: "GRANT|DROP user", wantStmts: []string{
+			`CREATE bigfile tablespace "TESTUSER" datafile size 100M autoextend on next 100M`,
+			`CREATE user "TESTUSER" profile "APPUSERS" default tablespace "TESTUSER" identified by "testpw" account unlock quota UNLIMITED on "TESTUSER"`,
+			`GRANT "GSB" to "TESTUSER"`,
+			`DROP user "TESTUSER" cascade`,
+			`DROP tablespace "TESTUSER" including contents and datafiles`,
+		}, wantErr: errors.New("could not grant role GSB to testuser: simulated failure (rollback failed for: create user)")},
+		{name: "user exists", username: "testuser", password: "testpw", wantErr: &databases.ConflictError{Objects: []databases.Object{{Kind: "user", Name: "TESTUSER"}}}},
+		{name: "user and tablespace exist", username: "both", password: "testpw", wantErr: &databases.ConflictError{Objects: []databases.Object{{Kind: "user", Name: "BOTH"}, {Kind: "tablespace", Name: "BOTH"}}}},
+		{name: "statement separator in username", username: "x; DROP USER SYS", password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "identified by in username", username: "x identified by y", password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "quote in username", username: `x" identified by "y`, password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "comment in username", username: "x--", password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "username starting with digit", username: "1user", password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "username too long", username: strings.Repeat("u", 31), password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "reserved word", username: "select", password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "oracle maintained account", username: "System", password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "missing username", password: "testpw", wantErr: databases.ErrInvalid},
+		{name: "missing password", username: "testuser", wantErr: databases.ErrInvalid},
+		{name: "quote in password", username: "testuser", password: `pw" account lock --`, wantErr: databases.ErrInvalid},
+		{name: "newline in password", username: "testuser", password: "pw\nGRANT DBA to x", wantErr: databases.ErrInvalid},
+		{name: "password too long", username: "testuser", password: strings.Repeat("p", 31), wantErr: databases.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+			rec.Count = existing(tt.name)
+			if tt.fail != "" {
+				rec.Fail = func(query string) error {
+					for _, prefix := range strings.Split(tt.fail, "|") {
+						if strings.HasPrefix(query, prefix) {
+							return fmt.Errorf("simulated failure")
+						}
+					}
+					return nil
+				}
+			}
+
+			err := db.CreateUser(tt.username, tt.password)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestDB_PlanCreateUser(t *testing.T) {
+	db, rec := newTestDB(t)
+	db.template = &models.UserTemplate{
+		Profile:             "devusers",
+		Roles:               []string{"CONNECT", "RESOURCE"},
+		Privileges:          []string{"CREATE SESSION", "CREATE VIEW"},
+		InitialSize:         "10M",
+		Increment:           "10M",
+		MaxSize:             "1G",
+		Quota:               "500M",
+		TemporaryTablespace: "temp",
+	}
+
+	plan, err := db.PlanCreateUser("testuser", "secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		`CREATE bigfile tablespace "TESTUSER" datafile size 10M autoextend on next 10M maxsize 1G`,
+		`CREATE user "TESTUSER" profile "DEVUSERS" default tablespace "TESTUSER" temporary tablespace "TEMP" identified by "********" account unlock quota 500M on "TESTUSER"`,
+		`GRANT "CONNECT", "RESOURCE" to "TESTUSER"`,
+		`GRANT CREATE SESSION, CREATE VIEW to "TESTUSER"`,
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("expected plan %q; got %q", want, plan)
+	}
+	if stmts := rec.Statements(); len(stmts) > 0 {
+		t.Errorf("expected no statements to run; got %q", stmts)
+	}
+
+	rec.Count = existing("user exists")
+	if _, err := db.PlanCreateUser("testuser", "secret"); !errors.Is(err, databases.ErrConflict) {
+		t.Errorf("expected conflict; got %v", err)
+	}
+}
+
+func TestDB_UserSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		template *models.UserTemplate
+		want     int64
+	}{
+		{name: "default", template: models.DefaultUserTemplate(), want: -1},
+		{name: "maxSize", template: &models.UserTemplate{InitialSize: "10M", Increment: "10M", MaxSize: "1G"}, want: 1 << 30},
+		{name: "unlimited maxSize", template: &models.UserTemplate{Increment: "10M", MaxSize: "UNLIMITED"}, want: -1},
+		{name: "autoextend off", template: &models.UserTemplate{InitialSize: "500M"}, want: 500 << 20},
+		{name: "default initialSize", template: &models.UserTemplate{}, want: 100 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := newTestDB(t)
+			db.template = tt.template
+			got, err := db.UserSize()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected size %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_DropUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		existing  string
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "drop user", username: "testuser", existing: "dba_users|dba_tablespaces", wantStmts: []string{
+			`DROP user "TESTUSER"`,
+			`DROP tablespace "TESTUSER"`,
+		}},
+		{name: "tablespace left over", username: "testuser", existing: "dba_tablespaces", wantStmts: []string{
+			`DROP tablespace "TESTUSER"`,
+		}},
+		{name: "user without tablespace", username: "testuser", existing: "dba_users", wantStmts: []string{
+			`DROP user "TESTUSER"`,
+		}},
+		{name: "user does not exist", username: "testuser", wantErr: databases.ErrNotFound},
+		{name: "cascade in username", username: "sys cascade", wantErr: databases.ErrInvalid},
+		{name: "oracle maintained account", username: "sys", wantErr: databases.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+			rec.Count = func(query string, args []driver.Value) int64 {
+				for _, table := range strings.Split(tt.existing, "|") {
+					if table != "" && strings.Contains(query, table) {
+						return 1
+					}
+				}
+				return 0
+			}
+
+			err := db.DropUser(tt.username)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+// existing returns a count function reporting the
+// objects of the named test case as existing
+func existing(name string) func(string, []driver.Value) int64 {
+	return func(query string, args []driver.Value) int64 {
+		switch {
+		case name == "user exists" && strings.Contains(query, "dba_users"):
+			return 1
+		case name == "user and tablespace exist":
+			return 1
+		}
+		return 0
+	}
+}
+
+// checkErr fails the test if err does not match want. databases.ErrInvalid
+// and databases.ErrNotFound are compared with errors.Is, other errors by message.
+func checkErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want == nil:
+	case err == nil:
+		t.Fatalf("expected error %v; got nil", want)
+	case want == databases.ErrInvalid || want == databases.ErrNotFound:
+		if !errors.Is(err, want) {
+			t.Fatalf("expected error %v; got %v", want, err)
+		}
+	case err.Error() != want.Error():
+		t.Fatalf("expected error %v; got %v", want, err)
+	}
+}
+
+func TestDB_ChangePassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "change password", username: "testuser", password: "new pw", wantStmts: []string{
+			`ALTER user "TESTUSER" identified by "new pw"`,
+		}},
+		{name: "injection in password", username: "testuser", password: `x" account unlock`, wantErr: databases.ErrInvalid},
+		{name: "oracle maintained account", username: "system", password: "newpw", wantErr: databases.ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+
+			err := db.ChangePassword(tt.username, tt.password)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestDB_Inventory(t *testing.T) {
+	db, rec := newTestDB(t)
+	rec.Rows = func(query string) []string {
+		if strings.HasPrefix(query, "SELECT username") {
+			return []string{"ALICE", "BOB"}
+		}
+		return []string{"ALICE", "ORPHAN"}
+	}
+
+	got, err := db.Inventory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []databases.Object{
+		{Kind: "user", Name: "ALICE"},
+		{Kind: "user", Name: "BOB"},
+		{Kind: "tablespace", Name: "ALICE"},
+		{Kind: "tablespace", Name: "ORPHAN"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected objects %v; got %v", want, got)
+	}
+
+	rec.Fail = func(query string) error { return errors.New("simulated failure") }
+	if _, err := db.Inventory(); err == nil || err.Error() != "could not query users: simulated failure" {
+		t.Errorf("expected query error; got %v", err)
+	}
+}
+
+// newTestDB returns a DB using the default user template backed by a recorder
+func newTestDB(t *testing.T) (*DB, *sqltest.Recorder) {
+	db, rec := sqltest.Open(t, "fakeoracle")
+	return &DB{DB: db, template: models.DefaultUserTemplate()}, rec
+}
@@ -0,0 +1,48 @@
+package databases
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+const (
+	// passwordLength stays below the 30 characters Oracle accepts
+	passwordLength = 24
+
+	lowerChars  = "abcdefghijklmnopqrstuvwxyz"
+	upperChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitChars  = "0123456789"
+	letterChars = lowerChars + upperChars
+)
+
+// GeneratePassword returns a random password accepted by all provisioners.
+// It starts with a letter and contains lower and upper case letters and
+// digits, so it also passes common password complexity rules.
+func GeneratePassword() (string, error) {
+	for {
+		b := make([]byte, passwordLength)
+		var err error
+		if b[0], err = randomChar(letterChars); err != nil {
+			return "", err
+		}
+		for i := 1; i < len(b); i++ {
+			if b[i], err = randomChar(letterChars + digitChars); err != nil {
+				return "", err
+			}
+		}
+
+		password := string(b)
+		if strings.ContainsAny(password, lowerChars) && strings.ContainsAny(password, upperChars) && strings.ContainsAny(password, digitChars) {
+			return password, nil
+		}
+	}
+}
+
+func randomChar(chars string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, err
+	}
+	return chars[n.Int64()], nil
+}
@@ -0,0 +1,31 @@
+package databases
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		password, err := GeneratePassword()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(password) != passwordLength {
+			t.Errorf("expected %v characters; got %q", passwordLength, password)
+		}
+		if !strings.ContainsAny(password[:1], letterChars) {
+			t.Errorf("expected password to start with a letter; got %q", password)
+		}
+		for _, chars := range []string{lowerChars, upperChars, digitChars} {
+			if !strings.ContainsAny(password, chars) {
+				t.Errorf("expected password to contain one of %q; got %q", chars, password)
+			}
+		}
+		if seen[password] {
+			t.Errorf("password %q generated twice", password)
+		}
+		seen[password] = true
+	}
+}
@@ -0,0 +1,254 @@
+// Package plugin runs provisioners as external executables.
+//
+// banquette starts a plugin and speaks JSON-RPC with it over the plugins
+// stdin and stdout, starting with a handshake to agree on the protocol
+// version. Plugins must therefore write their logs to stderr only.
+// Plugins are written with Serve, banquette starts them with Start.
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// handshakeTimeout limits how long a started plugin may take to answer the handshake
+var handshakeTimeout = 10 * time.Second
+
+// callTimeout limits how long a plugin may take to answer a call on a user
+var callTimeout = time.Minute
+
+// Plugin is a running plugin process.
+// It's safe for concurrent use by multiple goroutines.
+type Plugin struct {
+	name       string
+	cmd        *exec.Cmd
+	client     *rpc.Client
+	operations []string
+}
+
+// Start starts the plugin executable at path, performs the
+// handshake and asks the plugin for its capabilities.
+func Start(path string, args ...string) (*Plugin, error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start plugin (%v): %v", path, err)
+	}
+
+	p := &Plugin{
+		cmd:    cmd,
+		client: jsonrpc.NewClient(stdio{stdout, stdin}),
+	}
+	if err := p.handshake(); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin (%v): %v", path, err)
+	}
+	return p, nil
+}
+
+func (p *Plugin) handshake() error {
+	var reply HandshakeReply
+	if err := p.invoke("Handshake", HandshakeArgs{ProtocolVersion: ProtocolVersion}, &reply, handshakeTimeout); err != nil {
+		return fmt.Errorf("handshake failed: %v", err)
+	}
+	if reply.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %v, expected %v", reply.ProtocolVersion, ProtocolVersion)
+	}
+	p.name = reply.Name
+
+	var caps CapabilitiesReply
+	if err := p.invoke("Capabilities", Empty{}, &caps, handshakeTimeout); err != nil {
+		return fmt.Errorf("could not get capabilities: %v", err)
+	}
+	p.operations = caps.Operations
+	return nil
+}
+
+// invoke calls method of the plugin and waits at most timeout for its reply,
+// so a plugin that hangs or died cannot block its caller. A reply arriving
+// after the timeout is discarded.
+func (p *Plugin) invoke(method string, args, reply interface{}, timeout time.Duration) error {
+	call := p.client.Go(serviceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return decodeError(call.Error)
+	case <-timer.C:
+		return fmt.Errorf("%v timed out after %v", method, timeout)
+	}
+}
+
+// pluginError is an error returned by a plugin with an error code
+type pluginError struct {
+	msg string
+	// target is the error of package databases matching the error code
+	target error
+}
+
+func (e *pluginError) Error() string {
+	return e.msg
+}
+
+// Is reports whether target is the error matching the error code.
+func (e *pluginError) Is(target error) bool {
+	return target == e.target
+}
+
+// decodeError returns an error matching the error of package
+// databases for the error code of an error returned by a plugin.
+func decodeError(err error) error {
+	serr, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	if msg := strings.TrimPrefix(string(serr), CodeNotFound+": "); msg != string(serr) {
+		return &pluginError{msg: msg, target: databases.ErrNotFound}
+	}
+	return err
+}
+
+// Name returns the name the plugin announced during the handshake.
+func (p *Plugin) Name() string {
+	return p.name
+}
+
+// Supports reports whether the plugin announced op in its capabilities.
+func (p *Plugin) Supports(op string) bool {
+	for _, o := range p.operations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops the plugin process.
+func (p *Plugin) Close() error {
+	p.client.Close()
+	if err := p.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	p.cmd.Wait()
+	return nil
+}
+
+// Factory returns a databases.Factory creating provisioners
+// that forward their calls to the plugin.
+func (p *Plugin) Factory() databases.Factory {
+	return func(data *models.Database) (databases.Provisioner, error) {
+		return &session{
+			plugin: p,
+			conn: Connection{
+				DBAddr:   data.DBAddr,
+				DBName:   data.DBName,
+				Username: data.Username,
+				Password: data.Password,
+			},
+		}, nil
+	}
+}
+
+// session is a databases.Provisioner for a single registered database
+type session struct {
+	plugin *Plugin
+	conn   Connection
+}
+
+// Close does nothing, the plugin keeps running until Plugin.Close is called.
+func (s *session) Close() {}
+
+// CreateUser asks the plugin to create a user
+func (s *session) CreateUser(username, password string) error {
+	if !s.plugin.Supports(OpCreateUser) {
+		return fmt.Errorf("plugin %v: %v: %w", s.plugin.name, OpCreateUser, databases.ErrNotSupported)
+	}
+	args := UserArgs{Connection: s.conn, Username: username, Password: password}
+	if err := s.plugin.invoke("CreateUser", args, &Empty{}, callTimeout); err != nil {
+		return fmt.Errorf("could not create user (%v): %w", username, err)
+	}
+	return nil
+}
+
+// DropUser asks the plugin to drop a user. It returns an error matching
+// databases.ErrNotFound if the plugin reports that the user does not exist.
+func (s *session) DropUser(username string) error {
+	if !s.plugin.Supports(OpDropUser) {
+		return fmt.Errorf("plugin %v: %v: %w", s.plugin.name, OpDropUser, databases.ErrNotSupported)
+	}
+	args := UserArgs{Connection: s.conn, Username: username}
+	if err := s.plugin.invoke("DropUser", args, &Empty{}, callTimeout); err != nil {
+		return fmt.Errorf("could not drop user (%v): %w", username, err)
+	}
+	return nil
+}
+
+// ChangePassword asks the plugin to change the password of a user
+func (s *session) ChangePassword(username, password string) error {
+	if !s.plugin.Supports(OpChangePassword) {
+		return fmt.Errorf("plugin %v: %v: %w", s.plugin.name, OpChangePassword, databases.ErrNotSupported)
+	}
+	args := UserArgs{Connection: s.conn, Username: username, Password: password}
+	if err := s.plugin.invoke("ChangePassword", args, &Empty{}, callTimeout); err != nil {
+		return fmt.Errorf("could not change password of user (%v): %w", username, err)
+	}
+	return nil
+}
+
+// LockUser asks the plugin to lock a user
+func (s *session) LockUser(username string) error {
+	return s.call(OpLockUser, "LockUser", username)
+}
+
+// UnlockUser asks the plugin to unlock a user
+func (s *session) UnlockUser(username string) error {
+	return s.call(OpUnlockUser, "UnlockUser", username)
+}
+
+// ExpirePassword asks the plugin to expire the password of a user
+func (s *session) ExpirePassword(username string) error {
+	return s.call(OpExpirePassword, "ExpirePassword", username)
+}
+
+// call calls method for username if the plugin supports op
+func (s *session) call(op, method, username string) error {
+	if !s.plugin.Supports(op) {
+		return fmt.Errorf("plugin %v: %v: %w", s.plugin.name, op, databases.ErrNotSupported)
+	}
+	args := UserArgs{Connection: s.conn, Username: username}
+	if err := s.plugin.invoke(method, args, &Empty{}, callTimeout); err != nil {
+		return fmt.Errorf("could not %v (%v): %w", strings.Replace(op, "_", " ", -1), username, err)
+	}
+	return nil
+}
+
+// stdio joins a reader and a writer to the io.ReadWriteCloser used by the rpc codecs
+type stdio struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (s stdio) Close() error {
+	err := s.WriteCloser.Close()
+	if rerr := s.ReadCloser.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
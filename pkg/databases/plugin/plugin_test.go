@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// pluginPath is the memplugin binary built by TestMain
+var pluginPath string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "banquette-plugin")
+	if err != nil {
+		panic(err)
+	}
+	pluginPath = filepath.Join(dir, "memplugin")
+	build := exec.Command("go", "build", "-o", pluginPath, "./testdata/memplugin")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		os.RemoveAll(dir)
+		panic("could not build test plugin: " + err.Error())
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestStart(t *testing.T) {
+	p, err := Start(pluginPath)
+	if err != nil {
+		t.Fatalf("could not start plugin: %v", err)
+	}
+	defer p.Close()
+
+	if p.Name() != "memory" {
+		t.Errorf("expected plugin name %q; got %q", "memory", p.Name())
+	}
+	for _, op := range []string{OpCreateUser, OpDropUser, OpChangePassword} {
+		if !p.Supports(op) {
+			t.Errorf("expected plugin to support %v", op)
+		}
+	}
+	if p.Supports("unknown") {
+		t.Errorf("expected plugin not to support unknown operations")
+	}
+}
+
+func TestStart_notAPlugin(t *testing.T) {
+	if _, err := Start(filepath.Join(os.TempDir(), "does-not-exist")); err == nil {
+		t.Errorf("expected error starting a missing executable")
+	}
+
+	path, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true not available")
+	}
+	if _, err := Start(path); err == nil {
+		t.Errorf("expected handshake with %v to fail", path)
+	}
+}
+
+func TestPlugin_Factory(t *testing.T) {
+	p, err := Start(pluginPath)
+	if err != nil {
+		t.Fatalf("could not start plugin: %v", err)
+	}
+	defer p.Close()
+
+	db, err := p.Factory()(&models.Database{Type: "memplugin", DBAddr: "addr", DBName: "name"})
+	if err != nil {
+		t.Fatalf("could not open plugin database: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr bool
+		// wantIs is matched by the error if set
+		wantIs error
+	}{
+		{name: "create user", call: func() error { return db.CreateUser("testuser", "testpw") }},
+		{name: "create existing user", call: func() error { return db.CreateUser("testuser", "testpw") }, wantErr: true},
+		{name: "change password", call: func() error { return db.(databases.PasswordChanger).ChangePassword("testuser", "newpw") }},
+		{name: "drop user", call: func() error { return db.DropUser("testuser") }},
+		{name: "drop missing user", call: func() error { return db.DropUser("testuser") }, wantErr: true, wantIs: databases.ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("expected error matching %v; got %v", tt.wantIs, err)
+			}
+		})
+	}
+}
+
+func TestSession_notSupported(t *testing.T) {
+	// a plugin that announced no operations is never called
+	s := &session{plugin: &Plugin{name: "empty"}}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "create user", call: func() error { return s.CreateUser("testuser", "testpw") }},
+		{name: "drop user", call: func() error { return s.DropUser("testuser") }},
+		{name: "change password", call: func() error { return s.ChangePassword("testuser", "newpw") }},
+		{name: "lock user", call: func() error { return s.LockUser("testuser") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, databases.ErrNotSupported) {
+				t.Errorf("expected error matching %v; got %v", databases.ErrNotSupported, err)
+			}
+		})
+	}
+}
+
+func TestPlugin_callTimeout(t *testing.T) {
+	p, err := Start(pluginPath)
+	if err != nil {
+		t.Fatalf("could not start plugin: %v", err)
+	}
+	defer p.Close()
+
+	defer func(d time.Duration) { callTimeout = d }(callTimeout)
+	callTimeout = 100 * time.Millisecond
+
+	db, err := p.Factory()(&models.Database{DBAddr: "addr", DBName: "name"})
+	if err != nil {
+		t.Fatalf("could not open plugin database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CreateUser("hang", "testpw"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected call to time out; got %v", err)
+	}
+	// the plugin still answers other calls
+	if err := db.CreateUser("testuser", "testpw"); err != nil {
+		t.Errorf("could not create user after a timeout: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package plugin
+
+// ProtocolVersion is the version of the protocol spoken between banquette
+// and its plugins. It is compared during the handshake and has to be
+// increased on every incompatible change to the messages below.
+// Version 2 added the error codes.
+const ProtocolVersion = 2
+
+// serviceName is the name the plugin service is registered under
+const serviceName = "Plugin"
+
+// Operations a plugin can announce in its capabilities.
+const (
+	OpCreateUser     = "create_user"
+	OpDropUser       = "drop_user"
+	OpChangePassword = "change_password"
+	OpLockUser       = "lock_user"
+	OpUnlockUser     = "unlock_user"
+	OpExpirePassword = "expire_password"
+)
+
+// Error codes prefix the messages of errors returned by plugins as
+// "<code>: <message>", so banquette can tell them apart. net/rpc
+// only transports the messages of errors.
+const (
+	// CodeNotFound is reported by DropUser if the user does not exist
+	CodeNotFound = "not_found"
+)
+
+// HandshakeArgs is sent by banquette after starting a plugin.
+type HandshakeArgs struct {
+	ProtocolVersion int
+}
+
+// HandshakeReply is the plugins answer to a handshake.
+type HandshakeReply struct {
+	ProtocolVersion int
+	Name            string
+}
+
+// CapabilitiesReply lists the operations a plugin supports.
+type CapabilitiesReply struct {
+	Operations []string
+}
+
+// Connection contains the connect information of the registered
+// database a plugin should create or drop users in.
+type Connection struct {
+	DBAddr   string
+	DBName   string
+	Username string
+	Password string
+}
+
+// UserArgs are the arguments of all calls on a user.
+// Password is only set for CreateUser and ChangePassword.
+type UserArgs struct {
+	Connection Connection
+	Username   string
+	Password   string
+}
+
+// Empty is used for calls without arguments or reply.
+type Empty struct{}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+
+	"github.com/svenbs/banquette/pkg/databases"
+)
+
+// Provisioner is implemented by plugins to create or drop users
+// in the registered database described by conn. DropUser returns
+// an error matching databases.ErrNotFound if the user does not exist.
+type Provisioner interface {
+	CreateUser(conn Connection, username, password string) error
+	DropUser(conn Connection, username string) error
+}
+
+// PasswordChanger is implemented by plugins that can change passwords.
+// Plugins announce the OpChangePassword capability if they implement it.
+type PasswordChanger interface {
+	ChangePassword(conn Connection, username, password string) error
+}
+
+// AccountLocker is implemented by plugins that can lock and unlock users and
+// expire their passwords. Plugins announce the OpLockUser, OpUnlockUser
+// and OpExpirePassword capabilities if they implement it.
+type AccountLocker interface {
+	LockUser(conn Connection, username string) error
+	UnlockUser(conn Connection, username string) error
+	ExpirePassword(conn Connection, username string) error
+}
+
+// Serve serves impl over stdin and stdout until banquette closes the connection.
+// It is called from the main function of a plugin.
+func Serve(name string, impl Provisioner) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(serviceName, &service{name: name, impl: impl}); err != nil {
+		return err
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(stdio{os.Stdin, os.Stdout}))
+	return nil
+}
+
+// service exposes a Provisioner with the method set expected by net/rpc
+type service struct {
+	name string
+	impl Provisioner
+}
+
+func (s *service) Handshake(args HandshakeArgs, reply *HandshakeReply) error {
+	if args.ProtocolVersion != ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %v, expected %v", args.ProtocolVersion, ProtocolVersion)
+	}
+	reply.ProtocolVersion = ProtocolVersion
+	reply.Name = s.name
+	return nil
+}
+
+func (s *service) Capabilities(args Empty, reply *CapabilitiesReply) error {
+	reply.Operations = []string{OpCreateUser, OpDropUser}
+	if _, ok := s.impl.(PasswordChanger); ok {
+		reply.Operations = append(reply.Operations, OpChangePassword)
+	}
+	if _, ok := s.impl.(AccountLocker); ok {
+		reply.Operations = append(reply.Operations, OpLockUser, OpUnlockUser, OpExpirePassword)
+	}
+	return nil
+}
+
+func (s *service) CreateUser(args UserArgs, reply *Empty) error {
+	return s.impl.CreateUser(args.Connection, args.Username, args.Password)
+}
+
+func (s *service) DropUser(args UserArgs, reply *Empty) error {
+	return encodeError(s.impl.DropUser(args.Connection, args.Username))
+}
+
+func (s *service) ChangePassword(args UserArgs, reply *Empty) error {
+	changer, ok := s.impl.(PasswordChanger)
+	if !ok {
+		return fmt.Errorf("%v is not supported", OpChangePassword)
+	}
+	return changer.ChangePassword(args.Connection, args.Username, args.Password)
+}
+
+func (s *service) LockUser(args UserArgs, reply *Empty) error {
+	locker, ok := s.impl.(AccountLocker)
+	if !ok {
+		return fmt.Errorf("%v is not supported", OpLockUser)
+	}
+	return locker.LockUser(args.Connection, args.Username)
+}
+
+func (s *service) UnlockUser(args UserArgs, reply *Empty) error {
+	locker, ok := s.impl.(AccountLocker)
+	if !ok {
+		return fmt.Errorf("%v is not supported", OpUnlockUser)
+	}
+	return locker.UnlockUser(args.Connection, args.Username)
+}
+
+func (s *service) ExpirePassword(args UserArgs, reply *Empty) error {
+	locker, ok := s.impl.(AccountLocker)
+	if !ok {
+		return fmt.Errorf("%v is not supported", OpExpirePassword)
+	}
+	return locker.ExpirePassword(args.Connection, args.Username)
+}
+
+// encodeError prefixes the message of err with its error code
+func encodeError(err error) error {
+	if errors.Is(err, databases.ErrNotFound) {
+		return fmt.Errorf("%v: %v", CodeNotFound, err)
+	}
+	return err
+}
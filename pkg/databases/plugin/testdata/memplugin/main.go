@@ -0,0 +1,59 @@
+// memplugin is a plugin used by the tests that keeps its users in memory.
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/databases/plugin"
+)
+
+type memory struct {
+	mu    sync.Mutex
+	users map[string]string
+}
+
+func (m *memory) CreateUser(conn plugin.Connection, username, password string) error {
+	if username == "hang" {
+		// simulates a plugin that never answers
+		select {}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := conn.DBAddr + "/" + conn.DBName + "/" + username
+	if _, ok := m.users[key]; ok {
+		return fmt.Errorf("user %v already exists", username)
+	}
+	m.users[key] = password
+	return nil
+}
+
+func (m *memory) DropUser(conn plugin.Connection, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := conn.DBAddr + "/" + conn.DBName + "/" + username
+	if _, ok := m.users[key]; !ok {
+		return fmt.Errorf("user %v: %w", username, databases.ErrNotFound)
+	}
+	delete(m.users, key)
+	return nil
+}
+
+func (m *memory) ChangePassword(conn plugin.Connection, username, password string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := conn.DBAddr + "/" + conn.DBName + "/" + username
+	if _, ok := m.users[key]; !ok {
+		return fmt.Errorf("user %v does not exist", username)
+	}
+	m.users[key] = password
+	return nil
+}
+
+func main() {
+	if err := plugin.Serve("memory", &memory{users: make(map[string]string)}); err != nil {
+		log.Fatal(err)
+	}
+}
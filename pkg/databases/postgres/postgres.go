@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/lib/pq"
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+func init() {
+	databases.Register("postgres", func(data *models.Database) (databases.Provisioner, error) {
+		db, err := Open(data)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	})
+}
+
+// DB is a database handle representing a pool of zero or more underlying connections.
+// It's safe for concurrent use by multiple goroutines.
+type DB struct {
+	*sql.DB
+}
+
+// NewDB connects to the database of the registration with id registrationID
+func NewDB(registrationID int, store models.Datastore) (*DB, error) {
+	data, err := store.GetDatabase(registrationID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get database: %v", err)
+	}
+	return Open(data)
+}
+
+// Open connects to the registered database described by data.
+func Open(data *models.Database) (*DB, error) {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(data.Username, data.Password),
+		Host:   data.DBAddr,
+		Path:   "/" + data.DBName,
+	}
+
+	db, err := sql.Open("postgres", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to database (%v/%v): %v", data.DBAddr, data.DBName, err)
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	return &DB{db}, nil
+}
+
+// Close closes the database, releasing any open resources.
+func (db *DB) Close() {
+	db.DB.Close()
+}
+
+// CreateUser creates a login role and a schema owned by it
+func (db *DB) CreateUser(username, password string) error {
+	if err := notEmpty(map[string]string{
+		"username": username,
+		"password": password,
+	}); err != nil {
+		return err
+	}
+
+	role := pq.QuoteIdentifier(username)
+	if _, err := db.Exec("CREATE ROLE " + role + " LOGIN PASSWORD " + pq.QuoteLiteral(password)); err != nil {
+		return fmt.Errorf("could not create role (%v): %v", username, err)
+	}
+
+	schema := role
+	if _, err := db.Exec("CREATE SCHEMA " + schema + " AUTHORIZATION " + role); err != nil {
+		if _, err := db.Exec("DROP ROLE " + role); err != nil {
+			return fmt.Errorf("could not drop role (%v) after schema creation failed: %v", username, err)
+		}
+		return fmt.Errorf("could not create schema (%v): %v", username, err)
+	}
+	return nil
+}
+
+// ChangePassword sets a new password for the role username.
+// It also lifts a password expiry set by ExpirePassword.
+func (db *DB) ChangePassword(username, password string) error {
+	if err := notEmpty(map[string]string{
+		"username": username,
+		"password": password,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("ALTER ROLE " + pq.QuoteIdentifier(username) + " PASSWORD " + pq.QuoteLiteral(password) + " VALID UNTIL 'infinity'"); err != nil {
+		return fmt.Errorf("could not change password of role (%v): %v", username, err)
+	}
+	return nil
+}
+
+// LockUser revokes the login privilege of the role username
+func (db *DB) LockUser(username string) error {
+	return db.alterRole(username, "NOLOGIN", "lock role")
+}
+
+// UnlockUser grants the login privilege to the role username
+func (db *DB) UnlockUser(username string) error {
+	return db.alterRole(username, "LOGIN", "unlock role")
+}
+
+// ExpirePassword lets the password of the role username expire immediately
+func (db *DB) ExpirePassword(username string) error {
+	return db.alterRole(username, "VALID UNTIL 'epoch'", "expire password of role")
+}
+
+// alterRole runs ALTER ROLE for username with option
+func (db *DB) alterRole(username, option, desc string) error {
+	if _, err := db.Exec("ALTER ROLE " + pq.QuoteIdentifier(username) + " " + option); err != nil {
+		return fmt.Errorf("could not %v (%v): %v", desc, username, err)
+	}
+	return nil
+}
+
+// Inventory returns the roles owning a schema named after them,
+// as created by CreateUser, and the schemas not owned by a superuser.
+func (db *DB) Inventory() ([]databases.Object, error) {
+	users, err := databases.QueryObjects(db.DB, "user", "SELECT r.rolname FROM pg_roles r JOIN pg_namespace n ON n.nspname = r.rolname AND n.nspowner = r.oid WHERE NOT r.rolsuper")
+	if err != nil {
+		return nil, err
+	}
+	schemas, err := databases.QueryObjects(db.DB, "schema", "SELECT n.nspname FROM pg_namespace n JOIN pg_roles o ON o.oid = n.nspowner WHERE NOT o.rolsuper AND n.nspname NOT LIKE 'pg\\_%' AND n.nspname <> 'information_schema'")
+	if err != nil {
+		return nil, err
+	}
+	return append(users, schemas...), nil
+}
+
+// DropUser drops the schema and role matching username.
+// Objects that do not exist are skipped, if neither exists
+// it returns an error matching databases.ErrNotFound.
+func (db *DB) DropUser(username string) error {
+	roleExists, err := db.exists("role", "SELECT count(*) FROM pg_roles WHERE rolname = $1", username)
+	if err != nil {
+		return err
+	}
+	schemaExists, err := db.exists("schema", "SELECT count(*) FROM pg_namespace WHERE nspname = $1", username)
+	if err != nil {
+		return err
+	}
+	if !roleExists && !schemaExists {
+		return fmt.Errorf("user %v: %w", username, databases.ErrNotFound)
+	}
+
+	role := pq.QuoteIdentifier(username)
+	if schemaExists {
+		if _, err := db.Exec("DROP SCHEMA " + role + " CASCADE"); err != nil {
+			return fmt.Errorf("could not drop schema (%v): %v", username, err)
+		}
+	}
+	if roleExists {
+		if _, err := db.Exec("DROP ROLE " + role); err != nil {
+			return fmt.Errorf("could not drop role (%v): %v", username, err)
+		}
+	}
+	return nil
+}
+
+// exists reports whether the count(*) query of kind counts any rows
+func (db *DB) exists(kind, query string, args ...interface{}) (bool, error) {
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		return false, fmt.Errorf("could not query %vs: %v", kind, err)
+	}
+	return n > 0, nil
+}
+
+// notEmpty checks if a string inside a map is empty or not
+func notEmpty(args map[string]string) error {
+	for key, value := range args {
+		if len(value) <= 0 {
+			return fmt.Errorf("%v is missing", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/internal/sqltest"
+)
+
+func TestDB_CreateUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		fail      string
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "create user", username: "testuser", password: "test pw", wantStmts: []string{
+			`CREATE ROLE "testuser" LOGIN PASSWORD 'test pw'`,
+			`CREATE SCHEMA "testuser" AUTHORIZATION "testuser"`,
+		}},
+		{name: "quote in username", username: `x" SUPERUSER --`, password: "testpw", wantStmts: []string{
+			`CREATE ROLE "x"" SUPERUSER --" LOGIN PASSWORD 'testpw'`,
+			`CREATE SCHEMA "x"" SUPERUSER --" AUTHORIZATION "x"" SUPERUSER --"`,
+		}},
+		{name: "quote in password", username: "testuser", password: `pw' SUPERUSER --`, wantStmts: []string{
+			`CREATE ROLE "testuser" LOGIN PASSWORD 'pw'' SUPERUSER --'`,
+			`CREATE SCHEMA "testuser" AUTHORIZATION "testuser"`,
+		}},
+		{name: "backslash in password", username: "testuser", password: `pw\' SUPERUSER --`, wantStmts: []string{
+			`CREATE ROLE "testuser" LOGIN PASSWORD  E'pw\\'' SUPERUSER --'`,
+			`CREATE SCHEMA "testuser" AUTHORIZATION "testuser"`,
+		}},
+		{name: "role creation fails", username: "testuser", password: "testpw", fail: "CREATE ROLE", wantStmts: []string{
+			`CREATE ROLE "testuser" LOGIN PASSWORD 'testpw'`,
+		}, wantErr: errors.New("could not create role (testuser): simulated failure")},
+		{name: "schema creation fails", username: "testuser", password: "testpw", fail: "CREATE SCHEMA", wantStmts: []string{
+			`CREATE ROLE "testuser" LOGIN PASSWORD 'testpw'`,
+			`CREATE SCHEMA "testuser" AUTHORIZATION "testuser"`,
+			`DROP ROLE "testuser"`,
+		}, wantErr: errors.New("could not create schema (testuser): simulated failure")},
+		{name: "schema creation and rollback fail", username: "testuser", password: "testpw", fail: "CREATE SCHEMA|DROP ROLE", wantStmts: []string{
+			`CREATE ROLE "testuser" LOGIN PASSWORD 'testpw'`,
+			`CREATE SCHEMA "testuser" AUTHORIZATION "testuser"`,
+			`DROP ROLE "testuser"`,
+		}, wantErr: errors.New("could not drop role (testuser) after schema creation failed: simulated failure")},
+		{name: "missing username", password: "testpw", wantErr: errors.New("username is missing")},
+		{name: "missing password", username: "testuser", wantErr: errors.New("password is missing")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+			rec.Fail = sqltest.Failing(tt.fail)
+
+			err := db.CreateUser(tt.username, tt.password)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestDB_DropUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		username  string
+		existing  string
+		fail      string
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "drop user", username: "testuser", existing: "pg_roles|pg_namespace", wantStmts: []string{
+			`DROP SCHEMA "testuser" CASCADE`,
+			`DROP ROLE "testuser"`,
+		}},
+		{name: "schema left over", username: "testuser", existing: "pg_namespace", wantStmts: []string{
+			`DROP SCHEMA "testuser" CASCADE`,
+		}},
+		{name: "role without schema", username: "testuser", existing: "pg_roles", wantStmts: []string{
+			`DROP ROLE "testuser"`,
+		}},
+		{name: "quote in username", username: `x"; DROP ROLE "admin`, existing: "pg_roles|pg_namespace", wantStmts: []string{
+			`DROP SCHEMA "x""; DROP ROLE ""admin" CASCADE`,
+			`DROP ROLE "x""; DROP ROLE ""admin"`,
+		}},
+		{name: "schema drop fails", username: "testuser", existing: "pg_roles|pg_namespace", fail: "DROP SCHEMA", wantStmts: []string{
+			`DROP SCHEMA "testuser" CASCADE`,
+		}, wantErr: errors.New("could not drop schema (testuser): simulated failure")},
+		{name: "user does not exist", username: "testuser", wantErr: databases.ErrNotFound},
+		{name: "existence check fails", username: "testuser", fail: "SELECT count(*) FROM pg_roles", wantErr: errors.New("could not query roles: simulated failure")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+			rec.Fail = sqltest.Failing(tt.fail)
+			rec.Count = func(query string, args []driver.Value) int64 {
+				if len(args) != 1 || args[0] != tt.username {
+					t.Errorf("expected the username as argument of %q; got %v", query, args)
+				}
+				for _, table := range strings.Split(tt.existing, "|") {
+					if table != "" && strings.Contains(query, table) {
+						return 1
+					}
+				}
+				return 0
+			}
+
+			err := db.DropUser(tt.username)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestDB_AlterRole(t *testing.T) {
+	tests := []struct {
+		name      string
+		alter     func(db *DB) error
+		wantStmts []string
+		wantErr   error
+	}{
+		{name: "change password", alter: func(db *DB) error { return db.ChangePassword("testuser", "new pw") }, wantStmts: []string{
+			`ALTER ROLE "testuser" PASSWORD 'new pw' VALID UNTIL 'infinity'`,
+		}},
+		{name: "quote in password", alter: func(db *DB) error { return db.ChangePassword(`x"y`, `pw' SUPERUSER --`) }, wantStmts: []string{
+			`ALTER ROLE "x""y" PASSWORD 'pw'' SUPERUSER --' VALID UNTIL 'infinity'`,
+		}},
+		{name: "missing password", alter: func(db *DB) error { return db.ChangePassword("testuser", "") }, wantErr: errors.New("password is missing")},
+		{name: "lock", alter: func(db *DB) error { return db.LockUser("testuser") }, wantStmts: []string{
+			`ALTER ROLE "testuser" NOLOGIN`,
+		}},
+		{name: "unlock", alter: func(db *DB) error { return db.UnlockUser("testuser") }, wantStmts: []string{
+			`ALTER ROLE "testuser" LOGIN`,
+		}},
+		{name: "expire password", alter: func(db *DB) error { return db.ExpirePassword(`x" SUPERUSER --`) }, wantStmts: []string{
+			`ALTER ROLE "x"" SUPERUSER --" VALID UNTIL 'epoch'`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, rec := newTestDB(t)
+
+			err := tt.alter(db)
+			checkErr(t, err, tt.wantErr)
+
+			if got := rec.Statements(); !reflect.DeepEqual(got, tt.wantStmts) {
+				t.Errorf("expected statements %q; got %q", tt.wantStmts, got)
+			}
+		})
+	}
+}
+
+func TestDB_Inventory(t *testing.T) {
+	db, rec := newTestDB(t)
+	rec.Rows = func(query string) []string {
+		if strings.HasPrefix(query, "SELECT r.rolname") {
+			return []string{"alice", "bob"}
+		}
+		return []string{"alice", "orphan"}
+	}
+
+	got, err := db.Inventory()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []databases.Object{
+		{Kind: "user", Name: "alice"},
+		{Kind: "user", Name: "bob"},
+		{Kind: "schema", Name: "alice"},
+		{Kind: "schema", Name: "orphan"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected objects %v; got %v", want, got)
+	}
+}
+
+// checkErr fails the test if err does not match want. databases.ErrNotFound
+// is compared with errors.Is, other errors by message.
+func checkErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want == nil:
+	case err == nil:
+		t.Fatalf("expected error %v; got nil", want)
+	case want == databases.ErrNotFound:
+		if !errors.Is(err, want) {
+			t.Fatalf("expected error %v; got %v", want, err)
+		}
+	case err.Error() != want.Error():
+		t.Fatalf("expected error %v; got %v", want, err)
+	}
+}
+
+// newTestDB returns a DB backed by a recorder
+func newTestDB(t *testing.T) (*DB, *sqltest.Recorder) {
+	db, rec := sqltest.Open(t, "fakepostgres")
+	return &DB{db}, rec
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// rotatePassword changes the password of a user bookmarked for the token.
+// If the request has no password, a new one is generated and
+// returned in the response. It is not stored by banquette.
+func (env *Env) rotatePassword(w http.ResponseWriter, req *http.Request, oradb databases.Provisioner, data *userRequest) {
+	if err := notEmpty(map[string]string{
+		"username": data.Username,
+	}); err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+
+	changer, ok := oradb.(databases.PasswordChanger)
+	if !ok {
+		respondErr(w, req, http.StatusNotImplemented, "changing passwords is not supported for this database type")
+		return
+	}
+
+	bookmark, ok := env.bookmark(w, req, data)
+	if !ok {
+		return
+	}
+
+	password := data.Password
+	generated := password == ""
+	if generated {
+		var err error
+		if password, err = databases.GeneratePassword(); err != nil {
+			log.Println(err)
+			respondErr(w, req, http.StatusInternalServerError, "could not generate password")
+			return
+		}
+	}
+
+	if err := changer.ChangePassword(data.Username, password); err != nil {
+		log.Println(err)
+		respondErr(w, req, errStatus(err), err)
+		return
+	}
+
+	// a new password lifts the expiry of the old one
+	if state := nextState(bookmark.State, "unexpire"); state != bookmark.State {
+		if err := env.db.SetBookmarkState(data.caller.RegistrationID, data.Username, state); err != nil {
+			log.Println(err)
+		}
+	}
+
+	res := map[string]interface{}{
+		"message": fmt.Sprintf("password of user %v changed", data.Username),
+	}
+	if generated {
+		w.Header().Set("Cache-Control", "no-store")
+		res["password"] = password
+	}
+	respondJSON(w, http.StatusOK, res)
+}
+
+// AccountActionRouter locks, unlocks or expires the password of a user
+// bookmarked for the token. The action is taken from the route variable
+// "action" and the resulting account state is recorded with the bookmark.
+func (env *Env) AccountActionRouter(w http.ResponseWriter, req *http.Request) {
+	action := mux.Vars(req)["action"]
+	data, oradb, ok := env.openUserRequest(w, req, models.ScopeUsersUpdate)
+	if !ok {
+		return
+	}
+	defer oradb.Close()
+
+	env.accountAction(w, req, oradb, data, action)
+}
+
+// accountAction runs action on the user of a request
+func (env *Env) accountAction(w http.ResponseWriter, req *http.Request, oradb databases.Provisioner, data *userRequest, action string) {
+	if err := notEmpty(map[string]string{
+		"username": data.Username,
+	}); err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+
+	locker, ok := oradb.(databases.AccountLocker)
+	if !ok {
+		respondErr(w, req, http.StatusNotImplemented, "locking accounts is not supported for this database type")
+		return
+	}
+
+	var run func(string) error
+	var done string
+	switch action {
+	case "lock":
+		run, done = locker.LockUser, "locked"
+	case "unlock":
+		run, done = locker.UnlockUser, "unlocked"
+	case "expire":
+		run, done = locker.ExpirePassword, "expired"
+	default:
+		respondErr(w, req, http.StatusNotFound, fmt.Sprintf("unknown action %q", action))
+		return
+	}
+
+	bookmark, ok := env.bookmark(w, req, data)
+	if !ok {
+		return
+	}
+
+	if err := run(data.Username); err != nil {
+		log.Println(err)
+		respondErr(w, req, errStatus(err), err)
+		return
+	}
+
+	state := nextState(bookmark.State, action)
+	if err := env.db.SetBookmarkState(data.caller.RegistrationID, data.Username, state); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusOK, fmt.Sprintf("user %v %v, but could not record its state", data.Username, done))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message": fmt.Sprintf("user %v %v", data.Username, done),
+		"state":   state,
+	})
+}
+
+// nextState returns the account state after action was run on an account in state current.
+// Locking and expiry are independent of each other, "unexpire" lifts the expiry.
+func nextState(current, action string) string {
+	locked := current == models.StateLocked || current == models.StateExpiredLocked
+	expired := current == models.StateExpired || current == models.StateExpiredLocked
+
+	switch action {
+	case "lock":
+		locked = true
+	case "unlock":
+		locked = false
+	case "expire":
+		expired = true
+	case "unexpire":
+		expired = false
+	}
+
+	switch {
+	case locked && expired:
+		return models.StateExpiredLocked
+	case locked:
+		return models.StateLocked
+	case expired:
+		return models.StateExpired
+	}
+	return models.StateOpen
+}
+
+// bookmark returns the bookmark of the user of a request if it was created
+// for the registration of its caller. If not, it responds with an error.
+func (env *Env) bookmark(w http.ResponseWriter, req *http.Request, data *userRequest) (*models.Bookmark, bool) {
+	bookmark, err := env.db.GetBookmark(data.caller.RegistrationID, data.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		respondErr(w, req, http.StatusNotFound, fmt.Sprintf("user %v was not created for this token", data.Username))
+		return nil, false
+	}
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return nil, false
+	}
+	return bookmark, true
+}
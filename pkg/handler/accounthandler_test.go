@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+func TestEnv_rotatePassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        string
+		provisioner    databases.Provisioner
+		wantMsg        string
+		wantStatusCode int
+		wantGenerated  bool
+	}{
+		{name: "missing username", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"username is missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "not supported", request: `{"token":"testtoken","username":"testuser"}`, provisioner: struct{ databases.Provisioner }{&oraMockDB{}}, wantMsg: `{"error":{"message":"changing passwords is not supported for this database type"}}`, wantStatusCode: http.StatusNotImplemented},
+		{name: "not bookmarked", request: `{"token":"testtoken","username":"not_bookmarked","password":"newpw"}`, wantMsg: `{"error":{"message":"user not_bookmarked was not created for this token"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "bookmark lookup fails", request: `{"token":"testtoken","username":"bookmark_error","password":"newpw"}`, wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "change fails", request: `{"token":"testtoken","username":"error_changing_password","password":"newpw"}`, wantMsg: `{"error":{"message":"could not change password of user (error_changing_password)"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "change password", request: `{"token":"testtoken","username":"testuser","password":"newpw"}`, wantMsg: `{"message":"password of user testuser changed"}`, wantStatusCode: http.StatusOK},
+		{name: "generate password", request: `{"token":"testtoken","username":"testuser"}`, wantStatusCode: http.StatusOK, wantGenerated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, err := http.NewRequest("PATCH", "/api/v1/users", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			var data userRequest
+			if err := decodeBody(req, &data); err != nil {
+				t.Fatalf("could not decode request body: %v", err)
+			}
+			data.caller = testCaller
+			oradb := tt.provisioner
+			if oradb == nil {
+				oradb = &oraMockDB{}
+			}
+
+			var db *mockDB
+			env := NewEnv(db)
+			env.rotatePassword(rec, req, oradb, &data)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("could not read from response body: %v", err)
+			}
+			if res.StatusCode != tt.wantStatusCode {
+				t.Fatalf("expected status code %v; got %v", tt.wantStatusCode, res.StatusCode)
+			}
+
+			if tt.wantGenerated {
+				var v struct{ Message, Password string }
+				if err := json.Unmarshal(body, &v); err != nil {
+					t.Fatalf("could not decode response: %v", err)
+				}
+				if v.Message != "password of user testuser changed" {
+					t.Errorf("unexpected message %q", v.Message)
+				}
+				if len(v.Password) != 24 {
+					t.Errorf("expected a generated password of 24 characters; got %q", v.Password)
+				}
+				if res.Header.Get("Cache-Control") != "no-store" {
+					t.Errorf("expected response with a password not to be cached")
+				}
+				return
+			}
+			if msg := strings.TrimSpace(string(body)); msg != tt.wantMsg {
+				t.Fatalf("expected message %q; got %q", tt.wantMsg, msg)
+			}
+		})
+	}
+}
+
+func TestEnv_accountAction(t *testing.T) {
+	tests := []struct {
+		name           string
+		action         string
+		request        string
+		provisioner    databases.Provisioner
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "missing username", action: "lock", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"username is missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "not supported", action: "lock", request: `{"token":"testtoken","username":"testuser"}`, provisioner: struct{ databases.Provisioner }{&oraMockDB{}}, wantMsg: `{"error":{"message":"locking accounts is not supported for this database type"}}`, wantStatusCode: http.StatusNotImplemented},
+		{name: "unknown action", action: "freeze", request: `{"token":"testtoken","username":"testuser"}`, wantMsg: `{"error":{"message":"unknown action \"freeze\""}}`, wantStatusCode: http.StatusNotFound},
+		{name: "not bookmarked", action: "lock", request: `{"token":"testtoken","username":"not_bookmarked"}`, wantMsg: `{"error":{"message":"user not_bookmarked was not created for this token"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "lock fails", action: "lock", request: `{"token":"testtoken","username":"error_locking"}`, wantMsg: `{"error":{"message":"could not lock user (error_locking)"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "state not recorded", action: "lock", request: `{"token":"testtoken","username":"fail_state"}`, wantMsg: `{"error":{"message":"user fail_state locked, but could not record its state"}}`, wantStatusCode: http.StatusOK},
+		{name: "lock", action: "lock", request: `{"token":"testtoken","username":"testuser"}`, wantMsg: `{"message":"user testuser locked","state":"LOCKED"}`, wantStatusCode: http.StatusOK},
+		{name: "lock expired", action: "lock", request: `{"token":"testtoken","username":"expired_user"}`, wantMsg: `{"message":"user expired_user locked","state":"EXPIRED \u0026 LOCKED"}`, wantStatusCode: http.StatusOK},
+		{name: "unlock", action: "unlock", request: `{"token":"testtoken","username":"locked_user"}`, wantMsg: `{"message":"user locked_user unlocked","state":"OPEN"}`, wantStatusCode: http.StatusOK},
+		{name: "expire", action: "expire", request: `{"token":"testtoken","username":"testuser"}`, wantMsg: `{"message":"user testuser expired","state":"EXPIRED"}`, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, err := http.NewRequest("POST", "/api/v1/users/"+tt.action, strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			var data userRequest
+			if err := decodeBody(req, &data); err != nil {
+				t.Fatalf("could not decode request body: %v", err)
+			}
+			data.caller = testCaller
+			oradb := tt.provisioner
+			if oradb == nil {
+				oradb = &oraMockDB{}
+			}
+
+			var db *mockDB
+			env := NewEnv(db)
+			env.accountAction(rec, req, oradb, &data, tt.action)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("could not read from response body: %v", err)
+			}
+			if res.StatusCode != tt.wantStatusCode {
+				t.Fatalf("expected status code %v; got %v", tt.wantStatusCode, res.StatusCode)
+			}
+			if msg := strings.TrimSpace(string(body)); msg != tt.wantMsg {
+				t.Fatalf("expected message %q; got %q", tt.wantMsg, msg)
+			}
+		})
+	}
+}
+
+func Test_nextState(t *testing.T) {
+	tests := []struct {
+		current, action, want string
+	}{
+		{models.StateOpen, "lock", models.StateLocked},
+		{models.StateOpen, "expire", models.StateExpired},
+		{models.StateOpen, "unlock", models.StateOpen},
+		{models.StateLocked, "expire", models.StateExpiredLocked},
+		{models.StateLocked, "unlock", models.StateOpen},
+		{models.StateExpired, "lock", models.StateExpiredLocked},
+		{models.StateExpired, "unexpire", models.StateOpen},
+		{models.StateExpiredLocked, "unlock", models.StateExpired},
+		{models.StateExpiredLocked, "unexpire", models.StateLocked},
+		{"", "lock", models.StateLocked},
+	}
+	for _, tt := range tests {
+		if got := nextState(tt.current, tt.action); got != tt.want {
+			t.Errorf("nextState(%q, %q) = %q; want %q", tt.current, tt.action, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// AdminKeyHeader is the request header of admin API keys
+const AdminKeyHeader = "X-Admin-Key"
+
+// Admins authenticate the administrators that register databases,
+// by static API keys or by the subjects of verified TLS client certificates.
+type Admins struct {
+	// keys maps the hashes of the API keys to their names
+	keys map[[sha256.Size]byte]string
+	// subjects are the allowed certificate subjects
+	subjects map[string]bool
+}
+
+// NewAdmins returns Admins accepting keys, which maps the names of API keys
+// to the keys, and client certificates with one of subjects, e.g.
+// "CN=ops,O=Example". Without keys and subjects no one is an admin.
+func NewAdmins(keys map[string]string, subjects []string) *Admins {
+	a := &Admins{keys: map[[sha256.Size]byte]string{}, subjects: map[string]bool{}}
+	for name, key := range keys {
+		a.keys[sha256.Sum256([]byte(key))] = name
+	}
+	for _, s := range subjects {
+		a.subjects[s] = true
+	}
+	return a
+}
+
+// authenticate returns the principal of the admin of req, "key:<name>"
+// or "cert:<subject>". If req is not authenticated as admin, it returns
+// the response status and error.
+func (a *Admins) authenticate(req *http.Request) (string, int, error) {
+	if key := req.Header.Get(AdminKeyHeader); key != "" {
+		// keys are looked up by their hash, which does not leak them by timing
+		name, ok := a.keys[sha256.Sum256([]byte(key))]
+		if !ok {
+			return "", http.StatusUnauthorized, errors.New("invalid admin key")
+		}
+		return "key:" + name, 0, nil
+	}
+
+	if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		subject := req.TLS.VerifiedChains[0][0].Subject.String()
+		if !a.subjects[subject] {
+			return "", http.StatusForbidden, fmt.Errorf("certificate subject %q is not an admin", subject)
+		}
+		return "cert:" + subject, 0, nil
+	}
+	return "", http.StatusUnauthorized, errors.New("admin authentication required")
+}
+
+// authorizeAdmin returns the principal of the admin of req.
+// If req is not authenticated as admin, it responds with an error and returns false.
+func (env *Env) authorizeAdmin(w http.ResponseWriter, req *http.Request) (string, bool) {
+	principal, status, err := env.Admins.authenticate(req)
+	if err != nil {
+		log.Printf("admin authentication from %v failed: %v", clientIP(req), err)
+		respondErr(w, req, status, err)
+		return "", false
+	}
+	return principal, true
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+const (
+	testAdminName = "test"
+	testAdminKey  = "0123456789abcdef0123456789abcdef"
+)
+
+// newAdminEnv returns an Env using db with the admin key testAdminKey
+// and the admin certificate subject "CN=ops,O=Example"
+func newAdminEnv(db models.Datastore) *Env {
+	env := NewEnv(db)
+	env.Admins = NewAdmins(map[string]string{testAdminName: testAdminKey}, []string{"CN=ops,O=Example"})
+	return env
+}
+
+// withClientCert returns req received over TLS with a verified client certificate of subject
+func withClientCert(req *http.Request, subject pkix.Name) *http.Request {
+	cert := &x509.Certificate{Subject: subject}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return req
+}
+
+func TestAdmins_authenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           string
+		subject       *pkix.Name
+		unverified    bool
+		wantPrincipal string
+		wantStatus    int
+	}{
+		{name: "no credentials", wantStatus: http.StatusUnauthorized},
+		{name: "admin key", key: testAdminKey, wantPrincipal: "key:test"},
+		{name: "invalid admin key", key: "guessed", wantStatus: http.StatusUnauthorized},
+		{name: "admin certificate", subject: &pkix.Name{CommonName: "ops", Organization: []string{"Example"}}, wantPrincipal: "cert:CN=ops,O=Example"},
+		{name: "certificate not allowed", subject: &pkix.Name{CommonName: "dev", Organization: []string{"Example"}}, wantStatus: http.StatusForbidden},
+		{name: "unverified certificate", subject: &pkix.Name{CommonName: "ops", Organization: []string{"Example"}}, unverified: true, wantStatus: http.StatusUnauthorized},
+		{name: "invalid key with admin certificate", key: "guessed", subject: &pkix.Name{CommonName: "ops", Organization: []string{"Example"}}, wantStatus: http.StatusUnauthorized},
+	}
+
+	a := newAdminEnv(nil).Admins
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/token", nil)
+			if tt.key != "" {
+				req.Header.Set(AdminKeyHeader, tt.key)
+			}
+			if tt.subject != nil {
+				req = withClientCert(req, *tt.subject)
+				if tt.unverified {
+					req.TLS.VerifiedChains = nil
+				}
+			}
+
+			principal, status, err := a.authenticate(req)
+			if (err != nil) != (tt.wantStatus != 0) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("expected status %v; got %v", tt.wantStatus, status)
+			}
+			if principal != tt.wantPrincipal {
+				t.Errorf("expected principal %q; got %q", tt.wantPrincipal, principal)
+			}
+		})
+	}
+}
+
+func TestEnv_authorizeAdmin(t *testing.T) {
+	var db *mockDB
+
+	// no admins are configured by default
+	req := httptest.NewRequest("POST", "/api/v1/token", nil)
+	req.Header.Set(AdminKeyHeader, testAdminKey)
+	checkResponse(t, NewEnv(db).TokenMethodRouter, req, http.StatusUnauthorized, `{"error":{"message":"invalid admin key"}}`)
+
+	env := newAdminEnv(db)
+	req = httptest.NewRequest("GET", "/api/v1/databases", nil)
+	checkResponse(t, env.ListDatabases, req, http.StatusUnauthorized, `{"error":{"message":"admin authentication required"}}`)
+
+	req = withClientCert(httptest.NewRequest("GET", "/api/v1/tokens/stale", nil), pkix.Name{CommonName: "dev"})
+	checkResponse(t, env.StaleTokens, req, http.StatusForbidden, `{"error":{"message":"certificate subject \"CN=dev\" is not an admin"}}`)
+
+	req = httptest.NewRequest("PATCH", "/api/v1/token", nil)
+	req.Header.Set("Authorization", "Bearer testtoken")
+	checkResponse(t, env.Authenticate(http.HandlerFunc(env.TokenMethodRouter)).ServeHTTP, req, http.StatusUnauthorized, `{"error":{"message":"admin authentication required"}}`)
+}
+
+func TestEnv_adminOnly(t *testing.T) {
+	endpoints := []struct {
+		name    string
+		path    string
+		handler func(env *Env, w http.ResponseWriter, req *http.Request)
+	}{
+		{name: "list databases", path: "/api/v1/databases", handler: (*Env).ListDatabases},
+		{name: "stale tokens", path: "/api/v1/tokens/stale", handler: (*Env).StaleTokens},
+	}
+	tests := []struct {
+		name           string
+		header         string
+		value          string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "no credentials", wantMsg: `{"error":{"message":"admin authentication required"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "bearer token", header: "Authorization", value: "Bearer testtoken", wantMsg: `{"error":{"message":"admin authentication required"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "invalid admin key", header: AdminKeyHeader, value: "invalid", wantMsg: `{"error":{"message":"invalid admin key"}}`, wantStatusCode: http.StatusUnauthorized},
+	}
+	for _, e := range endpoints {
+		for _, tt := range tests {
+			t.Run(e.name+"/"+tt.name, func(t *testing.T) {
+				var db *mockDB
+				env := newAdminEnv(db)
+				req := httptest.NewRequest("GET", e.path, nil)
+				if tt.header != "" {
+					req.Header.Set(tt.header, tt.value)
+				}
+				h := func(w http.ResponseWriter, req *http.Request) { e.handler(env, w, req) }
+				checkResponse(t, h, req, tt.wantStatusCode, tt.wantMsg)
+			})
+		}
+	}
+}
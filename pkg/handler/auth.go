@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/oidc"
+)
+
+// RegistrationHeader is the request header naming the registration
+// a caller authenticated with a JWT acts on
+const RegistrationHeader = "X-Registration-Id"
+
+// Verifier verifies the JWTs of SSO identities, see oidc.Verifier
+type Verifier interface {
+	Verify(token string) (oidc.Claims, error)
+}
+
+// caller is the authenticated caller of a request
+type caller struct {
+	// RegistrationID is the registration the caller acts on
+	RegistrationID int
+	// Principal identifies the caller, "token:<id>" or "jwt:<subject>"
+	Principal string
+	// Token is the token of the caller, nil for callers with a JWT
+	Token  *models.Token
+	scopes []string
+}
+
+// HasScope reports whether c has scope
+func (c *caller) HasScope(scope string) bool {
+	for _, s := range c.scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+// callerKey is the context key of the caller of a request
+const callerKey contextKey = iota
+
+// Authenticate is a middleware that authenticates requests with a bearer
+// token in the Authorization header and puts the caller of the token
+// into the request context. Requests without the header are
+// passed on, handlers accept tokens in request bodies until they are removed.
+//
+// If env has a Verifier, the bearer token can be a JWT instead. Callers with
+// a JWT name their registration in the RegistrationHeader and have the
+// scopes env.Rules and their role in the team owning it grant them.
+func (env *Env) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+			respondErr(w, req, http.StatusUnauthorized, "expected Authorization: Bearer <token>")
+			return
+		}
+		token := strings.TrimSpace(parts[1])
+		authenticate := env.authenticate
+		if env.Verifier != nil && strings.Count(token, ".") == 2 {
+			authenticate = env.authenticateJWT
+		}
+		c, status, err := authenticate(req, token)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", bearerError(status))
+			respondErr(w, req, status, err)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), callerKey, c)))
+	})
+}
+
+// bearerError returns the WWW-Authenticate challenge of a failed
+// authentication with status
+func bearerError(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return `Bearer error="invalid_request"`
+	case http.StatusForbidden:
+		return `Bearer error="insufficient_scope"`
+	}
+	return `Bearer error="invalid_token"`
+}
+
+// authenticate looks up token and records its use. If the token cannot be
+// used, it returns the response status and error.
+func (env *Env) authenticate(req *http.Request, token string) (*caller, int, error) {
+	t, err := env.db.GetToken(token)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, http.StatusUnauthorized, errors.New("invalid token")
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, errors.New("internal server error")
+	}
+	now := time.Now()
+	if err := t.Check(now); err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	if err := env.db.TouchToken(t.ID, clientIP(req), now); err != nil {
+		log.Println(err)
+	}
+	return &caller{RegistrationID: t.RegistrationID, Principal: fmt.Sprintf("token:%v", t.ID), Token: t, scopes: t.Scopes}, 0, nil
+}
+
+// authenticateJWT verifies the JWT token and returns a caller with the
+// scopes env.Rules and its role in the team owning the registration named
+// by the request grant it on the registration.
+// If that fails, it returns the response status and error.
+func (env *Env) authenticateJWT(req *http.Request, token string) (*caller, int, error) {
+	claims, err := env.Verifier.Verify(token)
+	if errors.Is(err, oidc.ErrInvalidToken) {
+		log.Printf("invalid jwt from %v: %v", clientIP(req), err)
+		return nil, http.StatusUnauthorized, err
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, errors.New("internal server error")
+	}
+	if claims.Subject() == "" {
+		return nil, http.StatusUnauthorized, errors.New("jwt has no subject")
+	}
+
+	v := req.Header.Get(RegistrationHeader)
+	if v == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("missing %v header", RegistrationHeader)
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil || id <= 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid %v: %q", RegistrationHeader, v)
+	}
+	principal := "jwt:" + claims.Subject()
+	var scopes []string
+	if env.Rules != nil {
+		scopes = env.Rules.Scopes(claims, id)
+	}
+	role, err := env.db.MemberRole(principal, id)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		log.Println(err)
+		return nil, http.StatusInternalServerError, errors.New("internal server error")
+	}
+	scopes = union(scopes, models.RoleScopes[role])
+	if len(scopes) == 0 {
+		return nil, http.StatusForbidden, fmt.Errorf("no access to registration %v", id)
+	}
+	return &caller{RegistrationID: id, Principal: principal, scopes: scopes}, 0, nil
+}
+
+// union returns the scopes of a followed by those of b that a lacks
+func union(a, b []string) []string {
+	scopes := append([]string{}, a...)
+	for _, s := range b {
+		found := false
+		for _, t := range a {
+			found = found || s == t
+		}
+		if !found {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// authorize returns the caller of a request if its token has scope.
+// The caller is taken from the request context or authenticated with
+// bodyToken, the deprecated token of the request body.
+// If that fails, it responds with an error and returns false.
+func (env *Env) authorize(w http.ResponseWriter, req *http.Request, bodyToken, scope string) (*caller, bool) {
+	c, ok := req.Context().Value(callerKey).(*caller)
+	if !ok {
+		if bodyToken == "" {
+			respondErr(w, req, http.StatusBadRequest, "missing token")
+			return nil, false
+		}
+		var status int
+		var err error
+		if c, status, err = env.authenticate(req, bodyToken); err != nil {
+			respondErr(w, req, status, err)
+			return nil, false
+		}
+		log.Printf("token %v sent the token in the request body from %v", c.Token.ID, clientIP(req))
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Warning", `299 - "tokens in request bodies are deprecated, use the Authorization header"`)
+	}
+
+	if !c.HasScope(scope) {
+		respondErr(w, req, http.StatusForbidden, fmt.Sprintf("token lacks scope %v", scope))
+		return nil, false
+	}
+	return c, true
+}
+
+// clientIP returns the address of the client of req without its port
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
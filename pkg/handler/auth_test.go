@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/oidc"
+)
+
+// testCaller is the caller of requests that are passed to handlers directly
+var testCaller = &caller{RegistrationID: 1, Principal: "token:1", scopes: models.AllScopes}
+
+// fakeVerifier verifies the JWTs that are its keys, e.g. "alice.jwt.sig"
+type fakeVerifier map[string]oidc.Claims
+
+func (v fakeVerifier) Verify(token string) (oidc.Claims, error) {
+	if token == "failing.jwt.sig" {
+		return nil, fmt.Errorf("could not fetch keys")
+	}
+	claims, ok := v[token]
+	if !ok {
+		return nil, fmt.Errorf("unknown token: %w", oidc.ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func TestEnv_Authenticate(t *testing.T) {
+	tests := []struct {
+		name             string
+		authorization    string
+		request          string
+		wantStatusCode   int
+		wantAuthenticate string
+		wantDeprecation  string
+	}{
+		{name: "bearer token", authorization: "Bearer testtoken", wantStatusCode: http.StatusOK},
+		{name: "lowercase scheme", authorization: "bearer testtoken", wantStatusCode: http.StatusOK},
+		{name: "header before body", authorization: "Bearer testtoken", request: `{"token":"unknown"}`, wantStatusCode: http.StatusOK},
+		{name: "body token", request: `{"token":"testtoken"}`, wantStatusCode: http.StatusOK, wantDeprecation: "true"},
+		{name: "no token", wantStatusCode: http.StatusBadRequest},
+		{name: "basic auth", authorization: "Basic dXNlcjpwYXNz", wantStatusCode: http.StatusUnauthorized, wantAuthenticate: `Bearer error="invalid_request"`},
+		{name: "empty bearer", authorization: "Bearer ", wantStatusCode: http.StatusUnauthorized, wantAuthenticate: `Bearer error="invalid_request"`},
+		{name: "unknown token", authorization: "Bearer unknown", wantStatusCode: http.StatusUnauthorized, wantAuthenticate: `Bearer error="invalid_token"`},
+		{name: "expired token", authorization: "Bearer expired", wantStatusCode: http.StatusUnauthorized, wantAuthenticate: `Bearer error="invalid_token"`},
+		{name: "token lookup fails", authorization: "Bearer token_error", wantStatusCode: http.StatusInternalServerError, wantAuthenticate: `Bearer error="invalid_token"`},
+	}
+
+	var db *mockDB
+	env := NewEnv(db)
+	h := env.Authenticate(http.HandlerFunc(env.ListUsers))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/users", strings.NewReader(tt.request))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			if res.StatusCode != tt.wantStatusCode {
+				t.Errorf("expected status code %v; got %v", tt.wantStatusCode, res.StatusCode)
+			}
+			if got := res.Header.Get("WWW-Authenticate"); got != tt.wantAuthenticate {
+				t.Errorf("expected WWW-Authenticate %q; got %q", tt.wantAuthenticate, got)
+			}
+			if got := res.Header.Get("Deprecation"); got != tt.wantDeprecation {
+				t.Errorf("expected Deprecation %q; got %q", tt.wantDeprecation, got)
+			}
+		})
+	}
+}
+
+func TestEnv_Authenticate_scope(t *testing.T) {
+	var db *mockDB
+	env := NewEnv(db)
+
+	req := httptest.NewRequest("GET", "/api/v1/tokens", nil)
+	req.Header.Set("Authorization", "Bearer readonly")
+	checkResponse(t, env.Authenticate(http.HandlerFunc(env.TokensMethodRouter)).ServeHTTP, req, http.StatusForbidden, `{"error":{"message":"token lacks scope registration:admin"}}`)
+
+	req = httptest.NewRequest("DELETE", "/api/v1/token", nil)
+	req.Header.Set("Authorization", "Bearer unregister")
+	checkResponse(t, env.Authenticate(http.HandlerFunc(env.TokenMethodRouter)).ServeHTTP, req, http.StatusOK, `{"message":"token deleted"}`)
+}
+
+func TestEnv_Authenticate_jwt(t *testing.T) {
+	rules, err := oidc.ParseRules([]byte(`{"rules": [
+		{"claim": "groups", "values": ["dba"], "registrations": [1], "scopes": ["users:read"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		token            string
+		registration     string
+		wantStatusCode   int
+		wantAuthenticate string
+		wantPrincipal    string
+	}{
+		{name: "jwt", token: "alice.jwt.sig", registration: "1", wantStatusCode: http.StatusOK, wantPrincipal: "jwt:alice"},
+		{name: "database token", token: "testtoken", wantStatusCode: http.StatusOK, wantPrincipal: "token:1"},
+		{name: "missing registration", token: "alice.jwt.sig", wantStatusCode: http.StatusBadRequest, wantAuthenticate: `Bearer error="invalid_request"`},
+		{name: "invalid registration", token: "alice.jwt.sig", registration: "one", wantStatusCode: http.StatusBadRequest, wantAuthenticate: `Bearer error="invalid_request"`},
+		{name: "no rule", token: "alice.jwt.sig", registration: "2", wantStatusCode: http.StatusForbidden, wantAuthenticate: `Bearer error="insufficient_scope"`},
+		{name: "no group", token: "bob.jwt.sig", registration: "1", wantStatusCode: http.StatusForbidden, wantAuthenticate: `Bearer error="insufficient_scope"`},
+		{name: "no subject", token: "nosub.jwt.sig", registration: "1", wantStatusCode: http.StatusUnauthorized, wantAuthenticate: `Bearer error="invalid_token"`},
+		{name: "invalid jwt", token: "forged.jwt.sig", registration: "1", wantStatusCode: http.StatusUnauthorized, wantAuthenticate: `Bearer error="invalid_token"`},
+		{name: "team role", token: "carol.jwt.sig", registration: "1", wantStatusCode: http.StatusOK, wantPrincipal: "jwt:carol"},
+		{name: "team role on other registration", token: "carol.jwt.sig", registration: "2", wantStatusCode: http.StatusForbidden, wantAuthenticate: `Bearer error="insufficient_scope"`},
+		{name: "role lookup fails", token: "broken.jwt.sig", registration: "1", wantStatusCode: http.StatusInternalServerError, wantAuthenticate: `Bearer error="invalid_token"`},
+		{name: "verification fails", token: "failing.jwt.sig", registration: "1", wantStatusCode: http.StatusInternalServerError, wantAuthenticate: `Bearer error="invalid_token"`},
+	}
+
+	var db *mockDB
+	env := NewEnv(db)
+	env.Rules = rules
+	env.Verifier = fakeVerifier{
+		"alice.jwt.sig":  {"sub": "alice", "groups": []interface{}{"dba"}},
+		"bob.jwt.sig":    {"sub": "bob", "groups": []interface{}{"dev"}},
+		"nosub.jwt.sig":  {"groups": []interface{}{"dba"}},
+		"carol.jwt.sig":  {"sub": "carol"},
+		"broken.jwt.sig": {"sub": "broken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *caller
+			h := env.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if c, ok := env.authorize(w, req, "", models.ScopeUsersRead); ok {
+					got = c
+					respondMessage(w, req, http.StatusOK, "ok")
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/api/v1/users", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			if tt.registration != "" {
+				req.Header.Set(RegistrationHeader, tt.registration)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			res := rec.Result()
+			if res.StatusCode != tt.wantStatusCode {
+				t.Errorf("expected status code %v; got %v", tt.wantStatusCode, res.StatusCode)
+			}
+			if got := res.Header.Get("WWW-Authenticate"); got != tt.wantAuthenticate {
+				t.Errorf("expected WWW-Authenticate %q; got %q", tt.wantAuthenticate, got)
+			}
+			if tt.wantPrincipal == "" {
+				return
+			}
+			if got == nil || got.Principal != tt.wantPrincipal || got.RegistrationID != 1 {
+				t.Errorf("expected caller %v of registration 1; got %+v", tt.wantPrincipal, got)
+			}
+		})
+	}
+}
+
+func TestEnv_Authenticate_roles(t *testing.T) {
+	var db *mockDB
+	env := NewEnv(db)
+	env.Verifier = fakeVerifier{
+		"carol.jwt.sig": {"sub": "carol"},
+		"dave.jwt.sig":  {"sub": "dave"},
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		method         string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "viewer lists users", token: "dave.jwt.sig", method: "GET", wantStatusCode: http.StatusOK, wantMsg: `{"limit":50,"offset":0,"total":3,"users":[` +
+			`{"username":"user1","state":"OPEN","tablespace":"user1","created":"2020-01-01T00:00:00Z"},` +
+			`{"username":"user2","state":"LOCKED","tablespace":"user2","created":"2020-01-02T00:00:00Z"},` +
+			`{"username":"user3","state":"OPEN","tablespace":"user3","created":"2020-01-03T00:00:00Z"}]}`},
+		{name: "viewer drops user", token: "dave.jwt.sig", method: "DELETE", request: `{"username":"user1"}`, wantMsg: `{"error":{"message":"token lacks scope users:drop"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "provisioner mints token", token: "carol.jwt.sig", method: "POST", request: `{"scopes":["users:read"]}`, wantMsg: `{"error":{"message":"token lacks scope registration:admin"}}`, wantStatusCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := map[string]http.HandlerFunc{"GET": env.ListUsers, "DELETE": env.UserMethodRouter, "POST": env.TokensMethodRouter}[tt.method]
+			req := httptest.NewRequest(tt.method, "/api/v1/users", strings.NewReader(tt.request))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			req.Header.Set(RegistrationHeader, "1")
+			checkResponse(t, env.Authenticate(h).ServeHTTP, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr, want string
+	}{
+		{"192.0.2.1:51234", "192.0.2.1"},
+		{"[2001:db8::1]:51234", "2001:db8::1"},
+		{"192.0.2.1", "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		req := &http.Request{RemoteAddr: tt.remoteAddr}
+		if got := clientIP(req); got != tt.want {
+			t.Errorf("clientIP(%q) = %q; want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
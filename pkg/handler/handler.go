@@ -3,22 +3,38 @@ package handler
 import (
 	"fmt"
 
+	"github.com/svenbs/banquette/pkg/lease"
 	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/oidc"
+	"github.com/svenbs/banquette/pkg/secrets"
 )
 
 // Env is used to interface with models.Datastore
 type Env struct {
 	db models.Datastore
+	// Leases issues and renews the leases of created users
+	Leases *lease.Manager
+	// Admins authenticate the callers of the registration endpoints
+	Admins *Admins
+	// Verifier verifies JWTs of SSO identities, nil disables them
+	Verifier Verifier
+	// Rules grant callers with a JWT scopes on registrations
+	Rules *oidc.Rules
 }
 
 // InitDB initializes the database to store registered databases
 // and bookmark users created by banquette.
-func InitDB(driver, secret, dsn string) (*Env, error) {
-	db, err := models.NewDB(driver, secret, dsn)
+func InitDB(driver, secret, dsn string, keys secrets.Provider, tokenKey []byte) (*Env, error) {
+	db, err := models.NewDB(driver, secret, dsn, keys, tokenKey)
 	if err != nil {
 		return nil, fmt.Errorf("could not create database connection: %v", err)
 	}
-	return &Env{db}, nil
+	return NewEnv(db), nil
+}
+
+// NewEnv returns an Env using db
+func NewEnv(db models.Datastore) *Env {
+	return &Env{db: db, Leases: lease.New(db), Admins: NewAdmins(nil, nil)}
 }
 
 // Close closes the database, releasing any open resources.
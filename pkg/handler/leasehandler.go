@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/lease"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// leaseRequest is the request body of the lease endpoints
+type leaseRequest struct {
+	Token   string `json:"token"`
+	LeaseID string `json:"leaseId"`
+	// Increment extends a renewed lease, e.g. "1h"
+	Increment string `json:"increment"`
+	// caller is the authenticated caller of the request
+	caller *caller
+}
+
+// leaseInfo is a lease in responses
+type leaseInfo struct {
+	*models.Lease
+	// Duration is the remaining lifetime of the lease in seconds
+	Duration  int64 `json:"leaseDuration"`
+	Renewable bool  `json:"renewable"`
+}
+
+func newLeaseInfo(l *models.Lease, now time.Time) *leaseInfo {
+	duration := l.Expires.Sub(now)
+	if duration < 0 {
+		duration = 0
+	}
+	return &leaseInfo{
+		Lease:     l,
+		Duration:  int64(duration / time.Second),
+		Renewable: duration > 0 && l.Expires.Before(l.MaxExpires),
+	}
+}
+
+// decodeLeaseRequest decodes the body of a request to the lease endpoints
+// and authorizes its caller with scope. If that fails, it responds with an
+// error and returns false.
+func (env *Env) decodeLeaseRequest(w http.ResponseWriter, req *http.Request, scope string) (*leaseRequest, bool) {
+	data := &leaseRequest{}
+	if err := decodeOptionalBody(req, data); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusBadRequest, "malformed request")
+		return nil, false
+	}
+	c, ok := env.authorize(w, req, data.Token, scope)
+	if !ok {
+		return nil, false
+	}
+	data.caller = c
+	return data, true
+}
+
+// GetLease returns the lease in the route variable "id"
+// if it belongs to a user bookmarked for the token of the request.
+func (env *Env) GetLease(w http.ResponseWriter, req *http.Request) {
+	data, ok := env.decodeLeaseRequest(w, req, models.ScopeUsersRead)
+	if !ok {
+		return
+	}
+	data.LeaseID = mux.Vars(req)["id"]
+
+	l, ok := env.lease(w, req, data)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, newLeaseInfo(l, env.Leases.Now()))
+}
+
+// leaseScopes are the scopes required by the lease actions
+var leaseScopes = map[string]string{
+	"renew":  models.ScopeUsersUpdate,
+	"revoke": models.ScopeUsersDrop,
+}
+
+// LeaseActionRouter renews or revokes the lease of a request.
+// The action is taken from the route variable "action".
+func (env *Env) LeaseActionRouter(w http.ResponseWriter, req *http.Request) {
+	action := mux.Vars(req)["action"]
+	scope, ok := leaseScopes[action]
+	if !ok {
+		respondErr(w, req, http.StatusNotFound, fmt.Sprintf("unknown action %q", action))
+		return
+	}
+	data, ok := env.decodeLeaseRequest(w, req, scope)
+	if !ok {
+		return
+	}
+	if err := notEmpty(map[string]string{
+		"leaseId": data.LeaseID,
+	}); err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+
+	switch action {
+	case "renew":
+		env.renewLease(w, req, data)
+	case "revoke":
+		env.revokeLease(w, req, data)
+	}
+}
+
+// renewLease extends a lease by its increment, up to its max TTL
+func (env *Env) renewLease(w http.ResponseWriter, req *http.Request, data *leaseRequest) {
+	var increment time.Duration
+	if data.Increment != "" {
+		var err error
+		increment, err = time.ParseDuration(data.Increment)
+		if err != nil || increment <= 0 {
+			respondErr(w, req, http.StatusBadRequest, fmt.Sprintf("invalid increment: %q", data.Increment))
+			return
+		}
+	}
+
+	l, err := env.Leases.Renew(data.caller.RegistrationID, data.LeaseID, increment)
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		respondErr(w, req, http.StatusNotFound, fmt.Sprintf("lease %v not found", data.LeaseID))
+		return
+	case errors.Is(err, lease.ErrExpired):
+		respondErr(w, req, http.StatusGone, err)
+		return
+	case err != nil:
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"lease": newLeaseInfo(l, env.Leases.Now()),
+	})
+}
+
+// revokeLease drops the user of a lease and removes its bookmark with the lease
+func (env *Env) revokeLease(w http.ResponseWriter, req *http.Request, data *leaseRequest) {
+	l, ok := env.lease(w, req, data)
+	if !ok {
+		return
+	}
+
+	oradb, ok := env.open(w, req, data.caller.RegistrationID)
+	if !ok {
+		return
+	}
+	defer oradb.Close()
+
+	// a user that is already gone only needs its bookmark removed
+	if err := oradb.DropUser(l.Username); err != nil && !errors.Is(err, databases.ErrNotFound) {
+		log.Println(err)
+		respondErr(w, req, errStatus(err), fmt.Sprintf("could not revoke lease %v: %v", l.ID, err))
+		return
+	}
+
+	if err := env.db.UnBookmarkUser(data.caller.RegistrationID, l.Username); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusOK, l.Username+" deleted, but could not unbookmark it")
+		return
+	}
+
+	respondMessage(w, req, http.StatusOK, fmt.Sprintf("lease %v revoked, user %v removed", l.ID, l.Username))
+}
+
+// lease returns the lease of a request if it belongs to the
+// registration of its caller. If not, it responds with an error.
+func (env *Env) lease(w http.ResponseWriter, req *http.Request, data *leaseRequest) (*models.Lease, bool) {
+	l, err := env.db.GetLease(data.caller.RegistrationID, data.LeaseID)
+	if errors.Is(err, models.ErrNotFound) {
+		respondErr(w, req, http.StatusNotFound, fmt.Sprintf("lease %v not found", data.LeaseID))
+		return nil, false
+	}
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return nil, false
+	}
+	return l, true
+}
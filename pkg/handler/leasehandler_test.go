@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestEnv_createUser_lease(t *testing.T) {
+	tests := []struct {
+		name           string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+		wantDuration   int64
+	}{
+		{name: "lease with expiresAt", request: `{"token":"testtoken","username":"testuser","password":"testpw","lease":true,"expiresAt":"2100-01-01T00:00:00Z"}`, wantMsg: `{"error":{"message":"leases expire after their ttl, expiresAt cannot be used"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "fail to create lease", request: `{"token":"testtoken","username":"fail_lease","password":"testpw","lease":true}`, wantMsg: `{"error":{"message":"could not create lease","steps":{"ran":["reserve user","create user"],"failed":"create lease","rolledBack":["create user","reserve user"]}}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "default ttl", request: `{"token":"testtoken","username":"testuser","password":"testpw","lease":true}`, wantStatusCode: http.StatusCreated, wantDuration: 3600},
+		{name: "ttl", request: `{"token":"testtoken","username":"testuser","password":"testpw","lease":true,"ttl":"2h"}`, wantStatusCode: http.StatusCreated, wantDuration: 7200},
+		{name: "ttl above max", request: `{"token":"testtoken","username":"testuser","password":"testpw","lease":true,"ttl":"100h"}`, wantStatusCode: http.StatusCreated, wantDuration: 3 * 3600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, err := http.NewRequest("POST", "/api/v1/users", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			var data userRequest
+			if err := decodeBody(req, &data); err != nil {
+				t.Fatalf("could not decode request body: %v", err)
+			}
+			data.caller = testCaller
+
+			var db *mockDB
+			env := NewEnv(db)
+			env.Leases.MaxTTL = 3 * time.Hour
+			env.Leases.Now = func() time.Time { return leaseStart }
+			env.createUser(rec, req, &oraMockDB{}, &data)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("could not read from response body: %v", err)
+			}
+			if res.StatusCode != tt.wantStatusCode {
+				t.Fatalf("expected status code %v; got %v", tt.wantStatusCode, res.StatusCode)
+			}
+			if tt.wantDuration == 0 {
+				if msg := strings.TrimSpace(string(body)); msg != tt.wantMsg {
+					t.Fatalf("expected message %q; got %q", tt.wantMsg, msg)
+				}
+				return
+			}
+
+			var created struct {
+				Lease leaseInfo `json:"lease"`
+			}
+			if err := json.Unmarshal(body, &created); err != nil {
+				t.Fatalf("could not decode response %q: %v", body, err)
+			}
+			if l := created.Lease; l.Lease == nil || len(l.ID) != 32 || l.Username != "testuser" || l.Duration != tt.wantDuration {
+				t.Fatalf("expected a lease of testuser lasting %vs; got %s", tt.wantDuration, body)
+			}
+		})
+	}
+}
+
+func TestEnv_LeaseActionRouter(t *testing.T) {
+	tests := []struct {
+		name           string
+		action         string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "missing token", action: "renew", request: `{"leaseId":"lease"}`, wantMsg: `{"error":{"message":"missing token"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "missing lease id", action: "renew", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"leaseId is missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "unknown action", action: "extend", request: `{"token":"testtoken","leaseId":"lease"}`, wantMsg: `{"error":{"message":"unknown action \"extend\""}}`, wantStatusCode: http.StatusNotFound},
+		{name: "renew unknown lease", action: "renew", request: `{"token":"testtoken","leaseId":"unknown"}`, wantMsg: `{"error":{"message":"lease unknown not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "renew expired lease", action: "renew", request: `{"token":"testtoken","leaseId":"expired"}`, wantMsg: `{"error":{"message":"lease expired: lease has expired"}}`, wantStatusCode: http.StatusGone},
+		{name: "renew lookup fails", action: "renew", request: `{"token":"testtoken","leaseId":"internal"}`, wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "invalid increment", action: "renew", request: `{"token":"testtoken","leaseId":"lease","increment":"soon"}`, wantMsg: `{"error":{"message":"invalid increment: \"soon\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "renew", action: "renew", request: `{"token":"testtoken","leaseId":"lease"}`, wantMsg: `{"lease":{"leaseId":"lease","username":"testuser","issued":"2020-01-01T00:00:00Z","expires":"2020-01-01T01:30:00Z","maxExpires":"2020-01-01T03:00:00Z","leaseDuration":3600,"renewable":true}}`, wantStatusCode: http.StatusOK},
+		{name: "renew up to max ttl", action: "renew", request: `{"token":"testtoken","leaseId":"lease","increment":"5h"}`, wantMsg: `{"lease":{"leaseId":"lease","username":"testuser","issued":"2020-01-01T00:00:00Z","expires":"2020-01-01T03:00:00Z","maxExpires":"2020-01-01T03:00:00Z","leaseDuration":9000,"renewable":false}}`, wantStatusCode: http.StatusOK},
+		{name: "revoke unknown lease", action: "revoke", request: `{"token":"testtoken","leaseId":"unknown"}`, wantMsg: `{"error":{"message":"lease unknown not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "revoke unknown database type", action: "revoke", request: `{"token":"unknowntype","leaseId":"lease"}`, wantMsg: `{"error":{"message":"unsupported database type: \"db2\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "revoke drop fails", action: "revoke", request: `{"token":"testtoken","leaseId":"drop_error"}`, wantMsg: `{"error":{"message":"could not revoke lease drop_error: could not drop user (error_dropping_user)"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "revoke unbookmark fails", action: "revoke", request: `{"token":"testtoken","leaseId":"unbookmark_error"}`, wantMsg: `{"error":{"message":"fail_unbookmark deleted, but could not unbookmark it"}}`, wantStatusCode: http.StatusOK},
+		{name: "revoke lease of dropped user", action: "revoke", request: `{"token":"testtoken","leaseId":"gone"}`, wantMsg: `{"message":"lease gone revoked, user gone removed"}`, wantStatusCode: http.StatusOK},
+		{name: "revoke", action: "revoke", request: `{"token":"testtoken","leaseId":"lease"}`, wantMsg: `{"message":"lease lease revoked, user testuser removed"}`, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/api/v1/leases/"+tt.action, strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"action": tt.action})
+
+			var db *mockDB
+			env := NewEnv(db)
+			env.Leases.Now = func() time.Time { return leaseStart.Add(30 * time.Minute) }
+			checkResponse(t, env.LeaseActionRouter, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+func TestEnv_GetLease(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "missing token", id: "lease", request: `{}`, wantMsg: `{"error":{"message":"missing token"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "unknown lease", id: "unknown", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"lease unknown not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "get lease", id: "lease", request: `{"token":"testtoken"}`, wantMsg: `{"leaseId":"lease","username":"testuser","issued":"2020-01-01T00:00:00Z","expires":"2020-01-01T01:00:00Z","maxExpires":"2020-01-01T03:00:00Z","leaseDuration":1800,"renewable":true}`, wantStatusCode: http.StatusOK},
+		{name: "get expired lease", id: "expired", request: `{"token":"testtoken"}`, wantMsg: `{"leaseId":"expired","username":"testuser","issued":"2020-01-01T00:00:00Z","expires":"2020-01-01T00:00:00Z","maxExpires":"2020-01-01T03:00:00Z","leaseDuration":0,"renewable":false}`, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/leases/"+tt.id, strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+
+			var db *mockDB
+			env := NewEnv(db)
+			env.Leases.Now = func() time.Time { return leaseStart.Add(30 * time.Minute) }
+			checkResponse(t, env.GetLease, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
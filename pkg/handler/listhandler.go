@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+const (
+	// defaultLimit is the page size of listings without a limit
+	defaultLimit = 50
+	// maxLimit is the largest page size of listings
+	maxLimit = 500
+)
+
+// ListUsers lists the users bookmarked for the token of a request.
+// The page is selected by the query parameters limit and offset.
+func (env *Env) ListUsers(w http.ResponseWriter, req *http.Request) {
+	data := &userRequest{}
+	if err := decodeOptionalBody(req, data); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusBadRequest, "malformed request")
+		return
+	}
+	c, ok := env.authorize(w, req, data.Token, models.ScopeUsersRead)
+	if !ok {
+		return
+	}
+
+	limit, offset, err := pagination(req)
+	if err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+
+	bookmarks, total, err := env.db.ListBookmarks(c.RegistrationID, limit, offset)
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"users":  bookmarks,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetUser returns the details of the user in the route variable
+// "username" if it was bookmarked for the token of the request.
+func (env *Env) GetUser(w http.ResponseWriter, req *http.Request) {
+	data := &userRequest{}
+	if err := decodeOptionalBody(req, data); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusBadRequest, "malformed request")
+		return
+	}
+	c, ok := env.authorize(w, req, data.Token, models.ScopeUsersRead)
+	if !ok {
+		return
+	}
+	data.caller = c
+	data.Username = mux.Vars(req)["username"]
+
+	bookmark, ok := env.bookmark(w, req, data)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, bookmark)
+}
+
+// databaseInfo is a registered database as shown in listings.
+// It never contains the token or the password of a registration.
+type databaseInfo struct {
+	ID       int                  `json:"id"`
+	Type     string               `json:"type"`
+	DBAddr   string               `json:"dbaddr"`
+	DBName   string               `json:"dbname"`
+	Username string               `json:"username"`
+	Template *models.UserTemplate `json:"template,omitempty"`
+	Quota    *models.Quota        `json:"quota,omitempty"`
+	// CreatedBy and UpdatedBy are the admins that registered
+	// and last updated the database
+	CreatedBy string `json:"createdBy,omitempty"`
+	UpdatedBy string `json:"updatedBy,omitempty"`
+	// TeamID is the team owning the registration
+	TeamID int `json:"teamId,omitempty"`
+}
+
+// ListDatabases lists the registered databases to admins.
+// The page is selected by the query parameters limit and offset.
+func (env *Env) ListDatabases(w http.ResponseWriter, req *http.Request) {
+	if _, ok := env.authorizeAdmin(w, req); !ok {
+		return
+	}
+	limit, offset, err := pagination(req)
+	if err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+
+	list, total, err := env.db.ListDatabases(limit, offset)
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	infos := make([]databaseInfo, len(list))
+	for i, d := range list {
+		infos[i] = databaseInfo{
+			ID:        d.ID,
+			Type:      d.Type,
+			DBAddr:    d.DBAddr,
+			DBName:    d.DBName,
+			Username:  d.Username,
+			Template:  d.Template,
+			Quota:     d.Quota,
+			CreatedBy: d.CreatedBy,
+			UpdatedBy: d.UpdatedBy,
+			TeamID:    d.TeamID,
+		}
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"databases": infos,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// pagination returns the limit and offset query parameters of req
+func pagination(req *http.Request) (int, int, error) {
+	limit, offset := defaultLimit, 0
+	query := req.URL.Query()
+
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			return 0, 0, fmt.Errorf("limit must be a number between 1 and %v", maxLimit)
+		}
+		limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("offset must be a positive number")
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
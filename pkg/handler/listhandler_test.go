@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestEnv_ListUsers(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "no request body", wantMsg: `{"error":{"message":"missing token"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "malformed request", request: `{`, wantMsg: `{"error":{"message":"malformed request"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "missing token", request: `{}`, wantMsg: `{"error":{"message":"missing token"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "unknown token", request: `{"token":"unknown"}`, wantMsg: `{"error":{"message":"invalid token"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "internal server error", request: `{"token":"internal"}`, wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "invalid limit", query: "?limit=0", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"limit must be a number between 1 and 500"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "limit too large", query: "?limit=501", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"limit must be a number between 1 and 500"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "invalid offset", query: "?offset=-1", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"offset must be a positive number"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "list users", request: `{"token":"testtoken"}`, wantStatusCode: http.StatusOK, wantMsg: `{"limit":50,"offset":0,"total":3,"users":[` +
+			`{"username":"user1","state":"OPEN","tablespace":"user1","created":"2020-01-01T00:00:00Z"},` +
+			`{"username":"user2","state":"LOCKED","tablespace":"user2","created":"2020-01-02T00:00:00Z"},` +
+			`{"username":"user3","state":"OPEN","tablespace":"user3","created":"2020-01-03T00:00:00Z"}]}`},
+		{name: "list second page", query: "?limit=2&offset=2", request: `{"token":"testtoken"}`, wantStatusCode: http.StatusOK, wantMsg: `{"limit":2,"offset":2,"total":3,"users":[` +
+			`{"username":"user3","state":"OPEN","tablespace":"user3","created":"2020-01-03T00:00:00Z"}]}`},
+		{name: "list past the end", query: "?offset=10", request: `{"token":"testtoken"}`, wantStatusCode: http.StatusOK, wantMsg: `{"limit":50,"offset":10,"total":3,"users":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/users"+tt.query, strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			var db *mockDB
+			env := NewEnv(db)
+			checkResponse(t, env.ListUsers, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+func TestEnv_GetUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		username       string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "missing token", username: "testuser", request: `{}`, wantMsg: `{"error":{"message":"missing token"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "not bookmarked", username: "not_bookmarked", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"user not_bookmarked was not created for this token"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "get user", username: "locked_user", request: `{"token":"testtoken"}`, wantMsg: `{"username":"locked_user","state":"LOCKED","tablespace":"","created":"0001-01-01T00:00:00Z"}`, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/users/"+tt.username, strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"username": tt.username})
+
+			var db *mockDB
+			env := NewEnv(db)
+			checkResponse(t, env.GetUser, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+func TestEnv_ListDatabases(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "internal server error", query: "?limit=13", wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "invalid limit", query: "?limit=all", wantMsg: `{"error":{"message":"limit must be a number between 1 and 500"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "list without tokens and passwords", wantStatusCode: http.StatusOK, wantMsg: `{"databases":[` +
+			`{"id":1,"type":"oracle","dbaddr":"addr","dbname":"name","username":"admin","createdBy":"key:ops"},` +
+			`{"id":2,"type":"postgres","dbaddr":"addr","dbname":"name","username":"admin","template":{"quota":"1G"}}],"limit":50,"offset":0,"total":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/databases"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set(AdminKeyHeader, testAdminKey)
+
+			var db *mockDB
+			env := newAdminEnv(db)
+			checkResponse(t, env.ListDatabases, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+// checkResponse serves req with h and compares the response to the wanted status and body
+func checkResponse(t *testing.T, h http.HandlerFunc, req *http.Request, wantStatus int, wantMsg string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h(rec, req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("could not read from response body: %v", err)
+	}
+	if res.StatusCode != wantStatus {
+		t.Errorf("expected status code %v; got %v", wantStatus, res.StatusCode)
+	}
+	if msg := strings.TrimSpace(string(body)); msg != wantMsg {
+		t.Errorf("expected message %q; got %q", wantMsg, msg)
+	}
+}
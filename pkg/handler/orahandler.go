@@ -1,32 +1,92 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
-	"github.com/svenbs/banquette/pkg/databases/oracle"
+	"github.com/svenbs/banquette/pkg/databases"
 	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/saga"
 )
 
-// OracleMethodRouter routes requests via method to the correct handler
-func (env *Env) OracleMethodRouter(w http.ResponseWriter, req *http.Request) {
-	data := &models.Database{}
-	if err := decodeBody(req, data); err != nil {
-		log.Println(err)
-		respondErr(w, req, http.StatusBadRequest, "malformed request")
-		return
-	}
+// userRequest is the request body of the user endpoints
+type userRequest struct {
+	models.Database
+	// DryRun returns the statements a request would run instead of running them
+	DryRun bool `json:"dryRun"`
+	// TTL is the lifetime of a created user, e.g. "72h"
+	TTL string `json:"ttl"`
+	// ExpiresAt is the time a created user is dropped
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// Lease issues a renewable lease for a created user lasting TTL
+	Lease bool `json:"lease"`
+	// caller is the authenticated caller of the request
+	caller *caller
+}
 
-	if len(data.Token) <= 0 {
-		respondErr(w, req, http.StatusBadRequest, "missing token")
-		return
+// ttl returns the TTL of a request or zero if it has none
+func (data *userRequest) ttl() (time.Duration, error) {
+	return parseTTL(data.TTL)
+}
+
+// expires returns the time the user of a create request expires
+// or nil if it does not.
+func (data *userRequest) expires(now time.Time) (*time.Time, error) {
+	return expiry(data.TTL, data.ExpiresAt, now)
+}
+
+// parseTTL parses a positive duration or returns zero if s is empty
+func parseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
 	}
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl: %q", s)
+	}
+	return ttl, nil
+}
 
-	oradb, err := oracle.NewDB(data.Token, env.db)
+// expiry returns the time something requested with ttl or expiresAt
+// expires, or nil if neither is set.
+func expiry(ttl string, expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	if ttl != "" && expiresAt != nil {
+		return nil, errors.New("ttl and expiresAt are mutually exclusive")
+	}
+	d, err := parseTTL(ttl)
 	if err != nil {
-		log.Println(err)
-		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return nil, err
+	}
+	if d > 0 {
+		expires := now.Add(d)
+		return &expires, nil
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, fmt.Errorf("expiresAt %v is in the past", expiresAt.Format(time.RFC3339))
+	}
+	return expiresAt, nil
+}
+
+// userScopes are the scopes required by the methods of the user endpoints
+var userScopes = map[string]string{
+	"POST":   models.ScopeUsersCreate,
+	"PATCH":  models.ScopeUsersUpdate,
+	"DELETE": models.ScopeUsersDrop,
+}
+
+// UserMethodRouter routes requests via method to the correct handler.
+// The provisioner is chosen by the type of the database registered for the token.
+func (env *Env) UserMethodRouter(w http.ResponseWriter, req *http.Request) {
+	scope, ok := userScopes[req.Method]
+	if !ok {
+		respondErr(w, req, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	data, oradb, ok := env.openUserRequest(w, req, scope)
+	if !ok {
 		return
 	}
 	defer oradb.Close()
@@ -34,13 +94,65 @@ func (env *Env) OracleMethodRouter(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case "POST":
 		env.createUser(w, req, oradb, data)
+	case "PATCH":
+		env.rotatePassword(w, req, oradb, data)
 	case "DELETE":
 		env.dropUser(w, req, oradb, data)
 	}
 }
 
+// openUserRequest decodes the body of a request to the user endpoints and
+// connects to the database of the registration of its caller, if the caller has scope.
+// If that fails, it responds with an error and returns false.
+func (env *Env) openUserRequest(w http.ResponseWriter, req *http.Request, scope string) (*userRequest, databases.Provisioner, bool) {
+	data := &userRequest{}
+	if err := decodeBody(req, data); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusBadRequest, "malformed request")
+		return nil, nil, false
+	}
+
+	c, ok := env.authorize(w, req, data.Token, scope)
+	if !ok {
+		return nil, nil, false
+	}
+	data.caller = c
+
+	oradb, ok := env.open(w, req, c.RegistrationID)
+	if !ok {
+		return nil, nil, false
+	}
+	return data, oradb, true
+}
+
+// openDB connects to the database of the registration with id
+// using the provisioner registered for its stored type.
+func (env *Env) openDB(registrationID int) (databases.Provisioner, error) {
+	data, err := env.db.GetDatabase(registrationID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get database: %v", err)
+	}
+	return databases.Open(data)
+}
+
+// open connects to the database of the registration with id registrationID.
+// If that fails, it responds with an error and returns false.
+func (env *Env) open(w http.ResponseWriter, req *http.Request, registrationID int) (databases.Provisioner, bool) {
+	oradb, err := env.openDB(registrationID)
+	if err != nil {
+		log.Println(err)
+		if errors.Is(err, databases.ErrUnknownType) {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return nil, false
+		}
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return nil, false
+	}
+	return oradb, true
+}
+
 // createUser creates a user in a registered database associated to its token
-func (env *Env) createUser(w http.ResponseWriter, req *http.Request, oradb oracle.OraDB, data *models.Database) {
+func (env *Env) createUser(w http.ResponseWriter, req *http.Request, oradb databases.Provisioner, data *userRequest) {
 	if err := notEmpty(map[string]string{
 		"username": data.Username,
 		"password": data.Password,
@@ -49,38 +161,170 @@ func (env *Env) createUser(w http.ResponseWriter, req *http.Request, oradb oracl
 		return
 	}
 
-	if err := oradb.CreateUser(data.Username, data.Password); err != nil {
+	expires, err := data.expires(time.Now())
+	if err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+
+	if data.DryRun {
+		env.planUser(w, req, oradb, data)
+		return
+	}
+
+	var lease *models.Lease
+	if data.Lease {
+		if data.ExpiresAt != nil {
+			respondErr(w, req, http.StatusBadRequest, "leases expire after their ttl, expiresAt cannot be used")
+			return
+		}
+		ttl, _ := data.ttl()
+		if lease, err = env.Leases.Issue(data.Username, ttl); err != nil {
+			log.Println(err)
+			respondErr(w, req, http.StatusInternalServerError, "could not issue lease")
+			return
+		}
+		expires = &lease.Expires
+	}
+
+	create, err := createSteps(oradb, data.Username, data.Password)
+	if err != nil {
 		log.Println(err)
-		respondErr(w, req, http.StatusInternalServerError, err)
+		respondCreateErr(w, req, err, nil)
 		return
 	}
+	reserve, err := env.reserveStep(oradb, data, expires)
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	steps := append([]saga.Step{reserve}, create...)
+	// the lease is removed with the reserved bookmark if a later step fails
+	if lease != nil {
+		steps = append(steps, saga.Step{
+			Name: "create lease",
+			Do: func() error {
+				if err := env.Leases.Create(data.caller.RegistrationID, lease); err != nil {
+					log.Println(err)
+					return errors.New("could not create lease")
+				}
+				return nil
+			},
+		})
+	}
+	steps = append(steps, saga.Step{
+		Name: "bookmark user",
+		Do: func() error {
+			if err := env.db.SetBookmarkState(data.caller.RegistrationID, data.Username, models.StateOpen); err != nil {
+				log.Println(err)
+				return errors.New("could not bookmark user")
+			}
+			return nil
+		},
+	})
 
-	if err := env.db.BookmarkUser(data.Token, data.Username); err != nil {
+	if result, err := saga.Run(steps); err != nil {
 		log.Println(err)
-		oradb.DropUser(data.Username)
-		respondErr(w, req, http.StatusInternalServerError, "could not bookmark user")
+		respondCreateErr(w, req, err, result)
 		return
 	}
 
-	respondMessage(w, req, http.StatusCreated, fmt.Sprintf("user %v created", data.Username))
+	msg := fmt.Sprintf("user %v created", data.Username)
+	if lease != nil {
+		respondJSON(w, http.StatusCreated, map[string]interface{}{
+			"message": msg,
+			"lease":   newLeaseInfo(lease, env.Leases.Now()),
+		})
+		return
+	}
+	respondMessage(w, req, http.StatusCreated, msg)
 }
 
-// dropUser drops a user associated to its token.
-func (env *Env) dropUser(w http.ResponseWriter, req *http.Request, oradb oracle.OraDB, data *models.Database) {
+// planUser responds with the statements createUser would run
+func (env *Env) planUser(w http.ResponseWriter, req *http.Request, oradb databases.Provisioner, data *userRequest) {
+	planner, ok := oradb.(databases.Planner)
+	if !ok {
+		respondErr(w, req, http.StatusNotImplemented, "dry run is not supported for this database type")
+		return
+	}
+
+	stmts, err := planner.PlanCreateUser(data.Username, data.Password)
+	if err != nil {
+		log.Println(err)
+		respondCreateErr(w, req, err, nil)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"dryRun":     true,
+		"statements": stmts,
+	})
+}
+
+// createSteps returns the steps to create a user. Provisioners that
+// cannot split user creation into steps are run as a single step.
+func createSteps(oradb databases.Provisioner, username, password string) ([]saga.Step, error) {
+	if stepper, ok := oradb.(databases.Stepper); ok {
+		return stepper.CreateUserSteps(username, password)
+	}
+	return []saga.Step{{
+		Name: "create user",
+		Do: func() error {
+			return oradb.CreateUser(username, password)
+		},
+		Undo: func() error {
+			return oradb.DropUser(username)
+		},
+	}}, nil
+}
+
+// respondCreateErr responds with an error of a user creation. Conflicts list
+// the objects that already exist and result reports the steps that ran.
+func respondCreateErr(w http.ResponseWriter, req *http.Request, err error, result *saga.Result) {
+	status := errStatus(err)
+	body := map[string]interface{}{
+		"message": err.Error(),
+	}
+
+	var conflict *databases.ConflictError
+	if errors.As(err, &conflict) {
+		body["conflicts"] = conflict.Objects
+	}
+	if result != nil {
+		body["steps"] = result
+	}
+
+	respondJSON(w, status, map[string]interface{}{
+		"error": body,
+	})
+}
+
+// dropUser drops a user created for the registration of its caller.
+// Users without a bookmark are not dropped.
+func (env *Env) dropUser(w http.ResponseWriter, req *http.Request, oradb databases.Provisioner, data *userRequest) {
 	if err := notEmpty(map[string]string{
 		"username": data.Username,
 	}); err != nil {
 		respondErr(w, req, http.StatusBadRequest, err)
 		return
 	}
+	if _, ok := env.bookmark(w, req, data); !ok {
+		return
+	}
 
-	if err := oradb.DropUser(data.Username); err != nil {
+	// a user that is already gone only needs its bookmark removed
+	if err := oradb.DropUser(data.Username); err != nil && !errors.Is(err, databases.ErrNotFound) {
 		log.Println(err)
+		if status := errStatus(err); status != http.StatusInternalServerError {
+			respondErr(w, req, status, err)
+			return
+		}
 		respondErr(w, req, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
 
-	if err := env.db.UnBookmarkUser(data.Token, data.Username); err != nil {
+	if err := env.db.UnBookmarkUser(data.caller.RegistrationID, data.Username); err != nil {
 		log.Println(err)
 		respondErr(w, req, http.StatusOK, data.Username+" deleted, but could not unbookmark it")
 		return
@@ -5,10 +5,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/svenbs/banquette/pkg/databases"
 	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/saga"
 )
 
 func TestEnv_createUser(t *testing.T) {
@@ -21,10 +24,21 @@ func TestEnv_createUser(t *testing.T) {
 	}{
 		{name: "missing username", method: "POST", request: "{\"token\":\"testtoken\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"username is missing\"}}", wantStatusCode: http.StatusBadRequest},
 		{name: "missing password", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\"}", wantMsg: "{\"error\":{\"message\":\"password is missing\"}}", wantStatusCode: http.StatusBadRequest},
-		{name: "tablespace exists", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"tablespace_exists\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not create tablespace (tablespace_exists)\"}}", wantStatusCode: http.StatusInternalServerError},
-		{name: "username exists", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"username_exists\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not create user (username_exists)\"}}", wantStatusCode: http.StatusInternalServerError},
-		{name: "grant does not exist", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"grant_does_not_exist\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not grant role GSB to grant_does_not_exist\"}}", wantStatusCode: http.StatusInternalServerError},
-		{name: "fail to bookmark", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"fail_bookmark\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not bookmark user\"}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "tablespace exists", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"tablespace_exists\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not create tablespace (tablespace_exists)\",\"steps\":{\"ran\":[\"reserve user\"],\"failed\":\"create user\",\"rolledBack\":[\"reserve user\"]}}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "username exists", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"username_exists\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not create user (username_exists)\",\"steps\":{\"ran\":[\"reserve user\"],\"failed\":\"create user\",\"rolledBack\":[\"reserve user\"]}}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "user and tablespace conflict", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"conflict\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"conflicts\":[{\"kind\":\"user\",\"name\":\"CONFLICT\"},{\"kind\":\"tablespace\",\"name\":\"CONFLICT\"}],\"message\":\"user CONFLICT, tablespace CONFLICT already exists\"}}", wantStatusCode: http.StatusConflict},
+		{name: "dry run", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\",\"dryRun\":true}", wantMsg: "{\"dryRun\":true,\"statements\":[\"CREATE tablespace testuser\",\"CREATE user testuser identified by ********\"]}", wantStatusCode: http.StatusOK},
+		{name: "dry run conflict", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"conflict\",\"password\":\"testpw\",\"dryRun\":true}", wantMsg: "{\"error\":{\"conflicts\":[{\"kind\":\"user\",\"name\":\"CONFLICT\"},{\"kind\":\"tablespace\",\"name\":\"CONFLICT\"}],\"message\":\"user CONFLICT, tablespace CONFLICT already exists\"}}", wantStatusCode: http.StatusConflict},
+		{name: "grant does not exist", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"grant_does_not_exist\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not grant role GSB to grant_does_not_exist\",\"steps\":{\"ran\":[\"reserve user\"],\"failed\":\"create user\",\"rolledBack\":[\"reserve user\"]}}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "injection in username", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"x; DROP USER SYS\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"invalid input: username \\\"x; DROP USER SYS\\\" must start with a letter and contain only letters, digits, _, $ and #\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "fail to reserve", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"fail_reserve\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not reserve user\",\"steps\":{\"ran\":[],\"failed\":\"reserve user\"}}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "fail to bookmark", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"fail_bookmark\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not bookmark user\",\"steps\":{\"ran\":[\"reserve user\",\"create user\"],\"failed\":\"bookmark user\",\"rolledBack\":[\"create user\",\"reserve user\"]}}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "fail to bookmark and to roll back", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"fail_bookmark_and_drop\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"could not bookmark user (rollback failed for: create user)\",\"steps\":{\"ran\":[\"reserve user\",\"create user\"],\"failed\":\"bookmark user\",\"rolledBack\":[\"reserve user\"],\"rollbackFailed\":[{\"step\":\"create user\",\"error\":\"could not drop user (fail_bookmark_and_drop)\"}]}}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "ttl and expiresAt", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\",\"ttl\":\"1h\",\"expiresAt\":\"2100-01-01T00:00:00Z\"}", wantMsg: "{\"error\":{\"message\":\"ttl and expiresAt are mutually exclusive\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "invalid ttl", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\",\"ttl\":\"a week\"}", wantMsg: "{\"error\":{\"message\":\"invalid ttl: \\\"a week\\\"\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "negative ttl", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\",\"ttl\":\"-1h\"}", wantMsg: "{\"error\":{\"message\":\"invalid ttl: \\\"-1h\\\"\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "expiresAt in the past", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\",\"expiresAt\":\"2000-01-01T00:00:00Z\"}", wantMsg: "{\"error\":{\"message\":\"expiresAt 2000-01-01T00:00:00Z is in the past\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "create user with ttl", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\",\"ttl\":\"72h\"}", wantMsg: "{\"message\":\"user testuser created\"}", wantStatusCode: http.StatusCreated},
 		{name: "create user successfully", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\"}", wantMsg: "{\"message\":\"user testuser created\"}", wantStatusCode: http.StatusCreated},
 	}
 	for _, tt := range tests {
@@ -48,13 +62,14 @@ func TestEnv_createUser(t *testing.T) {
 			}
 
 			var oradb *oraMockDB
-			var data models.Database
+			var data userRequest
 			if err := decodeBody(req, &data); err != nil {
 				t.Fatalf("could not decode request body: %v", err)
 			}
+			data.caller = testCaller
 
 			var db *mockDB
-			env := &Env{db}
+			env := NewEnv(db)
 			env.createUser(rec, req, oradb, &data)
 
 			res := rec.Result()
@@ -75,6 +90,116 @@ func TestEnv_createUser(t *testing.T) {
 	}
 }
 
+// sizedMockDB is an oraMockDB whose users have tablespaces of size bytes
+type sizedMockDB struct {
+	*oraMockDB
+	size int64
+}
+
+func (db *sizedMockDB) UserSize() (int64, error) {
+	return db.size, nil
+}
+
+func TestEnv_createUser_quota(t *testing.T) {
+	registration := &caller{RegistrationID: mockRegistrations["quota"], Principal: "jwt:alice", scopes: models.AllScopes}
+	token := func(q *models.Quota) *caller {
+		return &caller{RegistrationID: mockRegistrations["quota"], Principal: "token:9", Token: &models.Token{ID: 9, Quota: q}, scopes: models.AllScopes}
+	}
+
+	tests := []struct {
+		name           string
+		caller         *caller
+		size           int64
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "no quota", caller: testCaller, size: 10 << 30, wantMsg: `{"message":"user testuser created"}`, wantStatusCode: http.StatusCreated},
+		{name: "within quota", caller: registration, size: 1 << 30, wantMsg: `{"message":"user testuser created"}`, wantStatusCode: http.StatusCreated},
+		{name: "user too large", caller: registration, size: 2 << 30, wantMsg: `{"error":{"message":"quota of registration 5: user size quota exceeded: a tablespace of 2G is larger than 1G","steps":{"ran":[],"failed":"reserve user"}}}`, wantStatusCode: http.StatusForbidden},
+		{name: "unlimited user", caller: registration, size: -1, wantMsg: `{"error":{"message":"quota of registration 5: user size quota exceeded: tablespaces can grow without limit, their template needs a maxSize","steps":{"ran":[],"failed":"reserve user"}}}`, wantStatusCode: http.StatusForbidden},
+		{name: "too many users of token", caller: token(&models.Quota{MaxUsers: 1}), size: 100 << 20, wantMsg: `{"error":{"message":"quota of token 9: user quota exceeded: at most 1 users are allowed","steps":{"ran":[],"failed":"reserve user"}}}`, wantStatusCode: http.StatusTooManyRequests},
+		{name: "total size of token", caller: token(&models.Quota{MaxTotalSize: "600M"}), size: 200 << 20, wantMsg: `{"error":{"message":"quota of token 9: total size quota exceeded: 500M of 600M are allocated, a tablespace of 200M does not fit","steps":{"ran":[],"failed":"reserve user"}}}`, wantStatusCode: http.StatusTooManyRequests},
+		{name: "within quota of token", caller: token(&models.Quota{MaxUsers: 2, MaxTotalSize: "600M"}), size: 100 << 20, wantMsg: `{"message":"user testuser created"}`, wantStatusCode: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/users", nil)
+			data := &userRequest{caller: tt.caller}
+			data.Username, data.Password = "testuser", "testpw"
+
+			var db *mockDB
+			env := NewEnv(db)
+			checkResponse(t, func(w http.ResponseWriter, req *http.Request) {
+				env.createUser(w, req, &sizedMockDB{size: tt.size}, data)
+			}, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+// bookmarkingMockDB is a mockDB that keeps the states of its bookmarks
+type bookmarkingMockDB struct {
+	*mockDB
+	states map[string]string
+}
+
+func (db *bookmarkingMockDB) ReserveUser(registrationID int, bookmark *models.Bookmark, limits []models.Limit) error {
+	if _, ok := db.states[bookmark.Username]; ok {
+		return fmt.Errorf("user %v: %w", bookmark.Username, models.ErrExists)
+	}
+	db.states[bookmark.Username] = models.StatePending
+	return nil
+}
+
+func (db *bookmarkingMockDB) ReleaseUser(registrationID int, username string) error {
+	if db.states[username] == models.StatePending {
+		delete(db.states, username)
+	}
+	return nil
+}
+
+func (db *bookmarkingMockDB) UnBookmarkUser(registrationID int, username string) error {
+	delete(db.states, username)
+	return nil
+}
+
+func (db *bookmarkingMockDB) SetBookmarkState(registrationID int, username, state string) error {
+	db.states[username] = state
+	return nil
+}
+
+func TestEnv_createUser_bookmarked(t *testing.T) {
+	tests := []struct {
+		name           string
+		username       string
+		wantMsg        string
+		wantStatusCode int
+		wantStates     map[string]string
+	}{
+		{name: "user exists", username: "username_exists", wantMsg: `{"error":{"message":"user username_exists: already exists","steps":{"ran":[],"failed":"reserve user"}}}`, wantStatusCode: http.StatusConflict, wantStates: map[string]string{"username_exists": models.StateOpen}},
+		{name: "create fails", username: "tablespace_exists", wantMsg: `{"error":{"message":"could not create tablespace (tablespace_exists)","steps":{"ran":["reserve user"],"failed":"create user","rolledBack":["reserve user"]}}}`, wantStatusCode: http.StatusInternalServerError, wantStates: map[string]string{"username_exists": models.StateOpen}},
+		{name: "create user", username: "testuser", wantMsg: `{"message":"user testuser created"}`, wantStatusCode: http.StatusCreated, wantStates: map[string]string{"username_exists": models.StateOpen, "testuser": models.StateOpen}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/users", nil)
+			data := &userRequest{caller: testCaller}
+			data.Username, data.Password = tt.username, "testpw"
+
+			// the provisioner has no pre-flight checks, like postgres and mysql
+			oradb := struct{ databases.Provisioner }{&oraMockDB{}}
+			db := &bookmarkingMockDB{states: map[string]string{"username_exists": models.StateOpen}}
+			env := NewEnv(db)
+			checkResponse(t, func(w http.ResponseWriter, req *http.Request) {
+				env.createUser(w, req, oradb, data)
+			}, req, tt.wantStatusCode, tt.wantMsg)
+
+			if !reflect.DeepEqual(db.states, tt.wantStates) {
+				t.Errorf("expected bookmarks %v; got %v", tt.wantStates, db.states)
+			}
+		})
+	}
+}
+
 func TestEnv_dropUser(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -84,8 +209,12 @@ func TestEnv_dropUser(t *testing.T) {
 		wantStatusCode int
 	}{
 		{name: "missing username", method: "POST", request: "{\"token\":\"testtoken\"}", wantMsg: "{\"error\":{\"message\":\"username is missing\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "injection in username", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"x; DROP USER SYS\"}", wantMsg: "{\"error\":{\"message\":\"invalid input: username \\\"x; DROP USER SYS\\\" must start with a letter and contain only letters, digits, _, $ and #\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "not bookmarked", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"not_bookmarked\"}", wantMsg: "{\"error\":{\"message\":\"user not_bookmarked was not created for this token\"}}", wantStatusCode: http.StatusNotFound},
+		{name: "bookmark error", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"bookmark_error\"}", wantMsg: "{\"error\":{\"message\":\"internal server error\"}}", wantStatusCode: http.StatusInternalServerError},
 		{name: "failed to unbookmark", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"fail_unbookmark\"}", wantMsg: "{\"error\":{\"message\":\"fail_unbookmark deleted, but could not unbookmark it\"}}", wantStatusCode: http.StatusOK},
 		{name: "drop user successfully", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\"}", wantMsg: "{\"message\":\"user testuser removed\"}", wantStatusCode: http.StatusOK},
+		{name: "user dropped by hand", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"gone\"}", wantMsg: "{\"message\":\"user gone removed\"}", wantStatusCode: http.StatusOK},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -108,13 +237,14 @@ func TestEnv_dropUser(t *testing.T) {
 			}
 
 			var oradb *oraMockDB
-			var data models.Database
+			var data userRequest
 			if err := decodeBody(req, &data); err != nil {
 				t.Fatalf("could not decode request body: %v", err)
 			}
+			data.caller = testCaller
 
 			var db *mockDB
-			env := &Env{db}
+			env := NewEnv(db)
 			env.dropUser(rec, req, oradb, &data)
 
 			res := rec.Result()
@@ -135,11 +265,79 @@ func TestEnv_dropUser(t *testing.T) {
 	}
 }
 
+func init() {
+	for _, typ := range []string{"oracle", "postgres"} {
+		databases.Register(typ, func(*models.Database) (databases.Provisioner, error) {
+			return &oraMockDB{}, nil
+		})
+	}
+	// basic only implements the methods of databases.Provisioner
+	databases.Register("basic", func(*models.Database) (databases.Provisioner, error) {
+		return struct{ databases.Provisioner }{&oraMockDB{}}, nil
+	})
+}
+
+func TestEnv_UserMethodRouter(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "missing token", method: "POST", request: "{\"username\":\"testuser\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"missing token\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "unknown database type", method: "POST", request: "{\"token\":\"unknowntype\",\"username\":\"testuser\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"unsupported database type: \\\"db2\\\"\"}}", wantStatusCode: http.StatusBadRequest},
+		{name: "token lookup fails", method: "POST", request: "{\"token\":\"internal\",\"username\":\"testuser\",\"password\":\"testpw\"}", wantMsg: "{\"error\":{\"message\":\"internal server error\"}}", wantStatusCode: http.StatusInternalServerError},
+		{name: "create user", method: "POST", request: "{\"token\":\"testtoken\",\"username\":\"testuser\",\"password\":\"testpw\"}", wantMsg: "{\"message\":\"user testuser created\"}", wantStatusCode: http.StatusCreated},
+		{name: "drop user", method: "DELETE", request: "{\"token\":\"testtoken\",\"username\":\"testuser\"}", wantMsg: "{\"message\":\"user testuser removed\"}", wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req, err := http.NewRequest(tt.method, "/api/v1/users", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			var db *mockDB
+			env := NewEnv(db)
+			env.UserMethodRouter(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			body, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("could not read from response body: %v", err)
+			}
+
+			if res.StatusCode != tt.wantStatusCode {
+				t.Fatalf("expected status code %v; got %v", tt.wantStatusCode, res.StatusCode)
+			}
+			if msg := strings.TrimSpace(string(body)); msg != tt.wantMsg {
+				t.Fatalf("expected message %q; got %q", tt.wantMsg, msg)
+			}
+		})
+	}
+}
+
 type oraMockDB struct{}
 
 func (db *oraMockDB) Close() {}
 
+// errInjection is returned by oraMockDB for usernames trying to inject SQL,
+// in the same way the oracle provisioner rejects them.
+var errInjection = fmt.Errorf("%w: username %q must start with a letter and contain only letters, digits, _, $ and #", databases.ErrInvalid, "x; DROP USER SYS")
+
+var errConflict = &databases.ConflictError{Objects: []databases.Object{{Kind: "user", Name: "CONFLICT"}, {Kind: "tablespace", Name: "CONFLICT"}}}
+
 func (db *oraMockDB) CreateUser(username, password string) error {
+	if strings.Contains(username, ";") {
+		return errInjection
+	}
+	if username == "conflict" {
+		return errConflict
+	}
 	tablespace := username
 	if username == "tablespace_exists" {
 		return fmt.Errorf("could not create tablespace (%v)", tablespace)
@@ -155,6 +353,58 @@ func (db *oraMockDB) CreateUser(username, password string) error {
 	return nil
 }
 
+// CreateUserSteps rejects invalid and existing users before any step
+// runs, like the oracle provisioner, and creates the user in one step.
+func (db *oraMockDB) CreateUserSteps(username, password string) ([]saga.Step, error) {
+	switch {
+	case strings.Contains(username, ";"):
+		return nil, errInjection
+	case username == "conflict":
+		return nil, errConflict
+	}
+	return []saga.Step{{
+		Name: "create user",
+		Do:   func() error { return db.CreateUser(username, password) },
+		Undo: func() error { return db.DropUser(username) },
+	}}, nil
+}
+
+func (db *oraMockDB) PlanCreateUser(username, password string) ([]string, error) {
+	if username == "conflict" {
+		return nil, errConflict
+	}
+	return []string{"CREATE tablespace " + username, "CREATE user " + username + " identified by ********"}, nil
+}
+
+func (db *oraMockDB) ChangePassword(username, password string) error {
+	if username == "error_changing_password" {
+		return fmt.Errorf("could not change password of user (%v)", username)
+	}
+	return nil
+}
+
+func (db *oraMockDB) LockUser(username string) error {
+	if username == "error_locking" {
+		return fmt.Errorf("could not lock user (%v)", username)
+	}
+	return nil
+}
+
+func (db *oraMockDB) UnlockUser(username string) error { return nil }
+
+func (db *oraMockDB) ExpirePassword(username string) error { return nil }
+
+// Inventory returns user1 of mockBookmarks, a user created by hand
+// and a tablespace left behind by user2.
+func (db *oraMockDB) Inventory() ([]databases.Object, error) {
+	return []databases.Object{
+		{Kind: "user", Name: "USER1"},
+		{Kind: "tablespace", Name: "USER1"},
+		{Kind: "tablespace", Name: "USER2"},
+		{Kind: "user", Name: "MANUAL"},
+	}, nil
+}
+
 func (db *oraMockDB) DropUser(username string) error {
 	if err := notEmpty(map[string]string{
 		"username": username,
@@ -163,10 +413,16 @@ func (db *oraMockDB) DropUser(username string) error {
 	}
 
 	switch username {
-	case "error_dropping_user":
+	case "x; DROP USER SYS":
+		return errInjection
+	case "error_dropping_user", "fail_bookmark_and_drop":
 		return fmt.Errorf("could not drop user (%v)", username)
 	case "error_dropping_tablespace":
 		return fmt.Errorf("could not drop tablespace (%v)", username)
+	case "gone":
+		return fmt.Errorf("user %v: %w", username, databases.ErrNotFound)
+	case "not_bookmarked", "bookmark_error":
+		return fmt.Errorf("dropped %v without a bookmark", username)
 	}
 	return nil
 }
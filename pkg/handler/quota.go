@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/saga"
+)
+
+// userSize returns the size the storage of a user created with oradb can grow
+// to, -1 if it is not limited and 0 if oradb allocates no storage for users.
+func userSize(oradb databases.Provisioner) (int64, error) {
+	sizer, ok := oradb.(databases.Sizer)
+	if !ok {
+		return 0, nil
+	}
+	return sizer.UserSize()
+}
+
+// reserveStep returns the step of createUser that reserves the user of data
+// within the quotas of the registration and the token of its caller before
+// it is created with oradb. Its undo releases the reservation, but never
+// the bookmark of an existing user. The reserved bookmark is opened by the
+// last step of createUser.
+func (env *Env) reserveStep(oradb databases.Provisioner, data *userRequest, expires *time.Time) (saga.Step, error) {
+	size, err := userSize(oradb)
+	if err != nil {
+		return saga.Step{}, err
+	}
+	c := data.caller
+	registration, err := env.db.GetDatabase(c.RegistrationID)
+	if err != nil {
+		return saga.Step{}, err
+	}
+	limits := []models.Limit{
+		{Name: fmt.Sprintf("registration %v", c.RegistrationID), Quota: registration.Quota},
+	}
+	if c.Token != nil {
+		limits = append(limits, models.Limit{Name: fmt.Sprintf("token %v", c.Token.ID), Quota: c.Token.Quota, Principal: c.Principal})
+	}
+
+	return saga.Step{
+		Name: "reserve user",
+		Do: func() error {
+			bookmark := &models.Bookmark{Username: data.Username, Expires: expires, CreatedBy: c.Principal, Size: size}
+			err := env.db.ReserveUser(c.RegistrationID, bookmark, limits)
+			if err != nil && errStatus(err) == http.StatusInternalServerError {
+				log.Println(err)
+				return errors.New("could not reserve user")
+			}
+			return err
+		},
+		Undo: func() error {
+			return env.db.ReleaseUser(c.RegistrationID, data.Username)
+		},
+	}, nil
+}
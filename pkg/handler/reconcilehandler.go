@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+	"github.com/svenbs/banquette/pkg/reconcile"
+)
+
+// reconcileRequest is the request body of the reconcile endpoint
+type reconcileRequest struct {
+	Token string `json:"token"`
+	// Repair selects the repairs of a POST request
+	Repair reconcile.Repairs `json:"repair"`
+	// DryRun reports the repairs instead of running them
+	DryRun bool `json:"dryRun"`
+}
+
+// Reconcile compares the users bookmarked for the token of a request with
+// the users in its registered database. GET requests only report the drift,
+// POST requests repair it as selected by "repair" unless "dryRun" is set.
+// Unbookmarked users are only dropped if "repair" lists them in "drop".
+// Repairs require the scope registration:admin.
+func (env *Env) Reconcile(w http.ResponseWriter, req *http.Request) {
+	data := &reconcileRequest{}
+	if err := decodeOptionalBody(req, data); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusBadRequest, "malformed request")
+		return
+	}
+
+	repair := req.Method == "POST"
+	scope := models.ScopeUsersRead
+	if repair {
+		scope = models.ScopeRegistrationAdmin
+		if data.Repair.Empty() {
+			respondErr(w, req, http.StatusBadRequest, "repair is missing")
+			return
+		}
+		if err := data.Repair.Validate(); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	c, ok := env.authorize(w, req, data.Token, scope)
+	if !ok {
+		return
+	}
+
+	bookmarks, err := env.allBookmarks(c.RegistrationID)
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	oradb, ok := env.open(w, req, c.RegistrationID)
+	if !ok {
+		return
+	}
+	defer oradb.Close()
+
+	inventory, ok := oradb.(databases.Inventory)
+	if !ok {
+		respondErr(w, req, http.StatusNotImplemented, "reconciling is not supported for this database type")
+		return
+	}
+	objects, err := inventory.Inventory()
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "could not list the users of the database")
+		return
+	}
+
+	report := reconcile.Compare(bookmarks, objects)
+	if repair {
+		if err := report.Plan(data.Repair); err != nil {
+			respondErr(w, req, http.StatusConflict, err)
+			return
+		}
+		if !data.DryRun {
+			report.Repair(env.db, c.RegistrationID, c.Principal, oradb)
+		}
+	}
+	respondJSON(w, http.StatusOK, report)
+}
+
+// allBookmarks returns every user bookmarked for the registration with id registrationID
+func (env *Env) allBookmarks(registrationID int) ([]*models.Bookmark, error) {
+	var all []*models.Bookmark
+	for offset := 0; ; offset += maxLimit {
+		bookmarks, total, err := env.db.ListBookmarks(registrationID, maxLimit, offset)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, bookmarks...)
+		if len(bookmarks) == 0 || offset+len(bookmarks) >= total {
+			return all, nil
+		}
+	}
+}
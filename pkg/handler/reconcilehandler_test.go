@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnv_Reconcile(t *testing.T) {
+	// report returns the report of mockBookmarks and oraMockDB.Inventory
+	// with the given fields added to the unbookmarked and missing users
+	report := func(unbookmarked, missing string) string {
+		return `{"bookmarks":3,"inSync":1,"drift":[` +
+			`{"username":"MANUAL","status":"unbookmarked","objects":[{"kind":"user","name":"MANUAL"}]` + unbookmarked + `},` +
+			`{"username":"user2","status":"missing","objects":[{"kind":"tablespace","name":"USER2"}]` + missing + `},` +
+			`{"username":"user3","status":"missing"` + missing + `}]}`
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "missing token", method: "GET", request: `{}`, wantMsg: `{"error":{"message":"missing token"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "unknown token", method: "GET", request: `{"token":"unknown"}`, wantMsg: `{"error":{"message":"invalid token"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "not supported", method: "GET", request: `{"token":"basic"}`, wantMsg: `{"error":{"message":"reconciling is not supported for this database type"}}`, wantStatusCode: http.StatusNotImplemented},
+		{name: "report", method: "GET", request: `{"token":"testtoken"}`, wantMsg: report("", ""), wantStatusCode: http.StatusOK},
+		{name: "report ignores repairs", method: "GET", request: `{"token":"testtoken","repair":{"missing":"forget"}}`, wantMsg: report("", ""), wantStatusCode: http.StatusOK},
+		{name: "repair missing", method: "POST", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"repair is missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "invalid repair", method: "POST", request: `{"token":"testtoken","repair":{"missing":"drop"}}`, wantMsg: `{"error":{"message":"invalid repair for missing users: \"drop\", must be \"forget\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "drop unbookmarked users", method: "POST", request: `{"token":"testtoken","repair":{"unbookmarked":"drop"}}`, wantMsg: `{"error":{"message":"unbookmarked users are only dropped if they are listed in drop"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "drop bookmarked user", method: "POST", request: `{"token":"testtoken","repair":{"drop":["user2"]}}`, wantMsg: `{"error":{"message":"not an unbookmarked user of the database: user2"}}`, wantStatusCode: http.StatusConflict},
+		{name: "dry run", method: "POST", request: `{"token":"testtoken","repair":{"missing":"forget","drop":["MANUAL"]},"dryRun":true}`, wantMsg: report(`,"action":"drop"`, `,"action":"forget"`), wantStatusCode: http.StatusOK},
+		{name: "repair", method: "POST", request: `{"token":"testtoken","repair":{"missing":"forget","unbookmarked":"bookmark"}}`, wantMsg: report(`,"action":"bookmark","repaired":true`, `,"action":"forget","repaired":true`), wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/api/v1/reconcile", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			var db *mockDB
+			env := NewEnv(db)
+			checkResponse(t, env.Reconcile, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
@@ -2,8 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
 )
 
 func decodeBody(r *http.Request, v interface{}) error {
@@ -11,6 +16,18 @@ func decodeBody(r *http.Request, v interface{}) error {
 	return json.NewDecoder(r.Body).Decode(v)
 }
 
+// decodeOptionalBody decodes the body of r like decodeBody,
+// but leaves v unchanged if r has no body.
+func decodeOptionalBody(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return nil
+	}
+	if err := decodeBody(r, v); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
 func encodeBody(w http.ResponseWriter, v interface{}) error {
 	return json.NewEncoder(w).Encode(v)
 }
@@ -35,3 +52,21 @@ func respondErr(w http.ResponseWriter, r *http.Request, status int, args ...inte
 		},
 	})
 }
+
+// errStatus returns the response status for an error
+// of a provisioner, a quota or a user reservation.
+func errStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrQuotaUserSize):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrQuotaUsers), errors.Is(err, models.ErrQuotaTotalSize):
+		return http.StatusTooManyRequests
+	case errors.Is(err, databases.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, databases.ErrConflict), errors.Is(err, models.ErrExists):
+		return http.StatusConflict
+	case errors.Is(err, databases.ErrNotSupported):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
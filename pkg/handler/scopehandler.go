@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// tokenRequest is the request body of the tokens endpoint
+type tokenRequest struct {
+	Token string `json:"token"`
+	// Scopes are the scopes of a minted token
+	Scopes []string `json:"scopes"`
+	// TTL is the lifetime of a minted token, e.g. "720h"
+	TTL string `json:"ttl"`
+	// ExpiresAt is the time a minted token expires
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// ID selects the revoked token
+	ID int `json:"id"`
+	// Quota limits the users created with a minted token
+	Quota *models.Quota `json:"quota"`
+}
+
+// TokensMethodRouter lists, mints or revokes the tokens of the
+// registration of the token of a request, which needs the scope
+// registration:admin.
+func (env *Env) TokensMethodRouter(w http.ResponseWriter, req *http.Request) {
+	data := &tokenRequest{}
+	if err := decodeOptionalBody(req, data); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusBadRequest, "malformed request")
+		return
+	}
+	c, ok := env.authorize(w, req, data.Token, models.ScopeRegistrationAdmin)
+	if !ok {
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		env.listTokens(w, req, c)
+	case "POST":
+		env.mintToken(w, req, c, data)
+	case "DELETE":
+		env.revokeToken(w, req, c, data)
+	}
+}
+
+// listTokens lists the tokens of the registration of c without their secrets
+func (env *Env) listTokens(w http.ResponseWriter, req *http.Request, c *caller) {
+	tokens, err := env.db.ListTokens(c.RegistrationID)
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tokens": tokens,
+	})
+}
+
+// mintToken creates a token with the requested scopes and quota for the registration
+// of c. The token is only returned in this response.
+func (env *Env) mintToken(w http.ResponseWriter, req *http.Request, c *caller, data *tokenRequest) {
+	if err := models.ValidateScopes(data.Scopes); err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+
+	expires, err := expiry(data.TTL, data.ExpiresAt, time.Now())
+	if err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+	if data.Quota != nil {
+		if err := data.Quota.Validate(); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	t := &models.Token{RegistrationID: c.RegistrationID, Scopes: data.Scopes, ExpiresAt: expires, Quota: data.Quota}
+	if err := env.db.CreateToken(t); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusCreated, t)
+}
+
+// revokeToken revokes a token of the registration of c.
+// The registration and its users are kept.
+func (env *Env) revokeToken(w http.ResponseWriter, req *http.Request, c *caller, data *tokenRequest) {
+	if data.ID <= 0 {
+		respondErr(w, req, http.StatusBadRequest, "id is missing")
+		return
+	}
+
+	err := env.db.RevokeToken(c.RegistrationID, data.ID, time.Now())
+	if errors.Is(err, models.ErrNotFound) {
+		respondErr(w, req, http.StatusNotFound, fmt.Sprintf("token %v not found or already revoked", data.ID))
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	respondMessage(w, req, http.StatusOK, fmt.Sprintf("token %v revoked", data.ID))
+}
+
+// defaultUnused is the time without use after which tokens are stale
+const defaultUnused = 30 * 24 * time.Hour
+
+// staleToken is a token in the stale token report
+type staleToken struct {
+	*models.Token
+	RegistrationID int `json:"registrationId"`
+	// Reason is "expired", "unused" or "never used"
+	Reason string `json:"reason"`
+}
+
+// StaleTokens reports to admins the tokens of all registrations that are
+// expired but not revoked, or were not used for the duration of the query
+// parameter "unused", 720h by default.
+func (env *Env) StaleTokens(w http.ResponseWriter, req *http.Request) {
+	if _, ok := env.authorizeAdmin(w, req); !ok {
+		return
+	}
+	unused := defaultUnused
+	if v := req.URL.Query().Get("unused"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			respondErr(w, req, http.StatusBadRequest, fmt.Sprintf("invalid unused: %q", v))
+			return
+		}
+		unused = d
+	}
+
+	now := time.Now()
+	tokens, err := env.db.StaleTokens(now.Add(-unused), now)
+	if err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	stale := make([]staleToken, len(tokens))
+	for i, t := range tokens {
+		reason := "unused"
+		switch {
+		case t.Check(now) == models.ErrTokenExpired:
+			reason = "expired"
+		case t.LastUsedAt == nil:
+			reason = "never used"
+		}
+		stale[i] = staleToken{Token: t, RegistrationID: t.RegistrationID, Reason: reason}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tokens":      stale,
+		"unusedSince": now.Add(-unused).UTC().Truncate(time.Second),
+	})
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestEnv_authorize(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        func(env *Env) http.HandlerFunc
+		method         string
+		vars           map[string]string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "unknown token", handler: func(env *Env) http.HandlerFunc { return env.UserMethodRouter }, method: "POST", request: `{"token":"unknown","username":"testuser","password":"pw"}`, wantMsg: `{"error":{"message":"invalid token"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "expired token", handler: func(env *Env) http.HandlerFunc { return env.UserMethodRouter }, method: "POST", request: `{"token":"expired","username":"testuser","password":"pw"}`, wantMsg: `{"error":{"message":"token expired"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "revoked token", handler: func(env *Env) http.HandlerFunc { return env.ListUsers }, method: "GET", request: `{"token":"revoked"}`, wantMsg: `{"error":{"message":"token revoked"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "token lookup fails", handler: func(env *Env) http.HandlerFunc { return env.UserMethodRouter }, method: "POST", request: `{"token":"token_error","username":"testuser","password":"pw"}`, wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "create without scope", handler: func(env *Env) http.HandlerFunc { return env.UserMethodRouter }, method: "POST", request: `{"token":"readonly","username":"testuser","password":"pw"}`, wantMsg: `{"error":{"message":"token lacks scope users:create"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "drop without scope", handler: func(env *Env) http.HandlerFunc { return env.UserMethodRouter }, method: "DELETE", request: `{"token":"readonly","username":"testuser"}`, wantMsg: `{"error":{"message":"token lacks scope users:drop"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "change password without scope", handler: func(env *Env) http.HandlerFunc { return env.UserMethodRouter }, method: "PATCH", request: `{"token":"readonly","username":"testuser"}`, wantMsg: `{"error":{"message":"token lacks scope users:update"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "lock without scope", handler: func(env *Env) http.HandlerFunc { return env.AccountActionRouter }, method: "POST", vars: map[string]string{"action": "lock"}, request: `{"token":"readonly","username":"testuser"}`, wantMsg: `{"error":{"message":"token lacks scope users:update"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "revoke lease without scope", handler: func(env *Env) http.HandlerFunc { return env.LeaseActionRouter }, method: "POST", vars: map[string]string{"action": "revoke"}, request: `{"token":"readonly","leaseId":"lease"}`, wantMsg: `{"error":{"message":"token lacks scope users:drop"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "repair without scope", handler: func(env *Env) http.HandlerFunc { return env.Reconcile }, method: "POST", request: `{"token":"readonly","repair":{"missing":"forget"}}`, wantMsg: `{"error":{"message":"token lacks scope registration:admin"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "update registration without scope", handler: func(env *Env) http.HandlerFunc { return env.TokenMethodRouter }, method: "PATCH", request: `{"token":"readonly","username":"user","password":"pass","dbaddr":"addr","dbname":"name"}`, wantMsg: `{"error":{"message":"token lacks scope registration:admin"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "unregister without scope", handler: func(env *Env) http.HandlerFunc { return env.TokenMethodRouter }, method: "DELETE", request: `{"token":"readonly"}`, wantMsg: `{"error":{"message":"token lacks scope registration:admin"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "read with scope", handler: func(env *Env) http.HandlerFunc { return env.GetUser }, method: "GET", vars: map[string]string{"username": "locked_user"}, request: `{"token":"readonly"}`, wantMsg: `{"username":"locked_user","state":"LOCKED","tablespace":"","created":"0001-01-01T00:00:00Z"}`, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/api/v1/", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			if tt.vars != nil {
+				req = mux.SetURLVars(req, tt.vars)
+			}
+			req.Header.Set(AdminKeyHeader, testAdminKey)
+
+			var db *mockDB
+			env := newAdminEnv(db)
+			checkResponse(t, tt.handler(env), req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+func TestEnv_TokensMethodRouter(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		request        string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "malformed request", method: "GET", request: `{`, wantMsg: `{"error":{"message":"malformed request"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "missing token", method: "GET", request: `{}`, wantMsg: `{"error":{"message":"missing token"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "missing scope", method: "GET", request: `{"token":"readonly"}`, wantMsg: `{"error":{"message":"token lacks scope registration:admin"}}`, wantStatusCode: http.StatusForbidden},
+		{name: "list tokens", method: "GET", request: `{"token":"testtoken"}`, wantStatusCode: http.StatusOK, wantMsg: `{"tokens":[` +
+			`{"id":1,"scopes":["users:create","users:read","users:update","users:drop","registration:admin"],"created":"2020-01-01T00:00:00Z"},` +
+			`{"id":2,"scopes":["users:read"],"created":"2020-01-01T00:00:00Z"}]}`},
+		{name: "mint without scopes", method: "POST", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"scopes are missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "mint unknown scope", method: "POST", request: `{"token":"testtoken","scopes":["users:read","root"]}`, wantMsg: `{"error":{"message":"unknown scope \"root\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "mint fails", method: "POST", request: `{"token":"testtoken","scopes":["users:drop"]}`, wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "mint with ttl and expiresAt", method: "POST", request: `{"token":"testtoken","scopes":["users:read"],"ttl":"1h","expiresAt":"2030-01-01T00:00:00Z"}`, wantMsg: `{"error":{"message":"ttl and expiresAt are mutually exclusive"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "mint expired", method: "POST", request: `{"token":"testtoken","scopes":["users:read"],"expiresAt":"2020-01-01T00:00:00Z"}`, wantMsg: `{"error":{"message":"expiresAt 2020-01-01T00:00:00Z is in the past"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "mint expiring", method: "POST", request: `{"token":"testtoken","scopes":["users:read"],"expiresAt":"2100-01-01T00:00:00Z"}`, wantMsg: `{"id":3,"token":"newtoken","scopes":["users:read"],"created":"2020-01-01T00:00:00Z","expiresAt":"2100-01-01T00:00:00Z"}`, wantStatusCode: http.StatusCreated},
+		{name: "mint invalid quota", method: "POST", request: `{"token":"testtoken","scopes":["users:create"],"quota":{"maxTotalSize":"lots"}}`, wantMsg: `{"error":{"message":"invalid maxTotalSize: \"lots\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "mint with quota", method: "POST", request: `{"token":"testtoken","scopes":["users:create"],"quota":{"maxUsers":10,"maxTotalSize":"10G"}}`, wantMsg: `{"id":3,"token":"newtoken","scopes":["users:create"],"created":"2020-01-01T00:00:00Z","quota":{"maxUsers":10,"maxTotalSize":"10G"}}`, wantStatusCode: http.StatusCreated},
+		{name: "mint", method: "POST", request: `{"token":"testtoken","scopes":["users:create","users:read"]}`, wantMsg: `{"id":3,"token":"newtoken","scopes":["users:create","users:read"],"created":"2020-01-01T00:00:00Z"}`, wantStatusCode: http.StatusCreated},
+		{name: "revoke without id", method: "DELETE", request: `{"token":"testtoken"}`, wantMsg: `{"error":{"message":"id is missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "revoke unknown token", method: "DELETE", request: `{"token":"testtoken","id":7}`, wantMsg: `{"error":{"message":"token 7 not found or already revoked"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "revoke fails", method: "DELETE", request: `{"token":"testtoken","id":13}`, wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "revoke", method: "DELETE", request: `{"token":"testtoken","id":2}`, wantMsg: `{"message":"token 2 revoked"}`, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/api/v1/tokens", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			var db *mockDB
+			env := NewEnv(db)
+			checkResponse(t, env.TokensMethodRouter, req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
+
+func TestEnv_StaleTokens(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "invalid unused", query: "?unused=month", wantMsg: `{"error":{"message":"invalid unused: \"month\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "internal server error", query: "?unused=100000h", wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "report", wantStatusCode: http.StatusOK, wantMsg: `[` +
+			`{"id":4,"scopes":["users:read"],"created":"2020-01-01T00:00:00Z","expiresAt":"2020-01-01T01:00:00Z","registrationId":1,"reason":"expired"},` +
+			`{"id":5,"scopes":["users:read"],"created":"2020-01-01T00:00:00Z","lastUsedAt":"2020-01-01T02:00:00Z","lastUsedIp":"192.0.2.1","registrationId":1,"reason":"unused"},` +
+			`{"id":6,"scopes":["users:create"],"created":"2020-01-01T00:00:00Z","registrationId":2,"reason":"never used"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/api/v1/tokens/stale"+tt.query, nil)
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set(AdminKeyHeader, testAdminKey)
+
+			var db *mockDB
+			env := newAdminEnv(db)
+			rec := httptest.NewRecorder()
+			env.StaleTokens(rec, req)
+
+			var res struct {
+				Tokens json.RawMessage `json:"tokens"`
+				Error  json.RawMessage `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatalf("could not decode response: %v", err)
+			}
+			if rec.Code != tt.wantStatusCode {
+				t.Errorf("expected status code %v; got %v", tt.wantStatusCode, rec.Code)
+			}
+			got := string(res.Tokens)
+			if rec.Code != http.StatusOK {
+				got = strings.TrimSpace(rec.Body.String())
+			}
+			if got != tt.wantMsg {
+				t.Errorf("expected %q; got %q", tt.wantMsg, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// teamRequest is the request body of the team endpoints
+type teamRequest struct {
+	// Name is the name of a created team
+	Name string `json:"name"`
+	// Principal is the member of a team, "jwt:<subject>"
+	Principal string `json:"principal"`
+	// Role is the role of a member, viewer, provisioner or admin
+	Role string `json:"role"`
+	// TeamID is the team owning a registration, 0 for none
+	TeamID int `json:"teamId"`
+}
+
+// decodeTeamRequest authorizes the admin of a request to the team
+// endpoints and decodes its body.
+// If that fails, it responds with an error and returns false.
+func (env *Env) decodeTeamRequest(w http.ResponseWriter, req *http.Request) (*teamRequest, bool) {
+	if _, ok := env.authorizeAdmin(w, req); !ok {
+		return nil, false
+	}
+	data := &teamRequest{}
+	if err := decodeOptionalBody(req, data); err != nil {
+		log.Println(err)
+		respondErr(w, req, http.StatusBadRequest, "malformed request")
+		return nil, false
+	}
+	return data, true
+}
+
+// pathID returns the id in the path of req.
+// If it is invalid, it responds with an error and returns false.
+func pathID(w http.ResponseWriter, req *http.Request) (int, bool) {
+	v := mux.Vars(req)["id"]
+	id, err := strconv.Atoi(v)
+	if err != nil || id <= 0 {
+		respondErr(w, req, http.StatusBadRequest, fmt.Sprintf("invalid id: %q", v))
+		return 0, false
+	}
+	return id, true
+}
+
+// respondTeamErr responds with an error of the team datastore
+func respondTeamErr(w http.ResponseWriter, req *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		respondErr(w, req, http.StatusNotFound, err)
+	case errors.Is(err, models.ErrExists):
+		respondErr(w, req, http.StatusConflict, err)
+	default:
+		log.Println(err)
+		respondErr(w, req, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// TeamsMethodRouter lists and creates teams, which needs an admin.
+func (env *Env) TeamsMethodRouter(w http.ResponseWriter, req *http.Request) {
+	data, ok := env.decodeTeamRequest(w, req)
+	if !ok {
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		teams, err := env.db.ListTeams()
+		if err != nil {
+			respondTeamErr(w, req, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"teams": teams,
+		})
+	case "POST":
+		if err := notEmpty(map[string]string{"name": data.Name}); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+		t := &models.Team{Name: data.Name}
+		if err := env.db.CreateTeam(t); err != nil {
+			respondTeamErr(w, req, err)
+			return
+		}
+		respondJSON(w, http.StatusCreated, t)
+	}
+}
+
+// DeleteTeam removes the team with the id of the path and its members.
+// The registrations of the team are kept without a team.
+func (env *Env) DeleteTeam(w http.ResponseWriter, req *http.Request) {
+	if _, ok := env.decodeTeamRequest(w, req); !ok {
+		return
+	}
+	id, ok := pathID(w, req)
+	if !ok {
+		return
+	}
+	if err := env.db.DeleteTeam(id); err != nil {
+		respondTeamErr(w, req, err)
+		return
+	}
+	respondMessage(w, req, http.StatusOK, fmt.Sprintf("team %v deleted", id))
+}
+
+// TeamMembersMethodRouter lists the members of the team with the id of the
+// path, binds a principal to a role in it or removes a principal from it.
+// It needs an admin.
+func (env *Env) TeamMembersMethodRouter(w http.ResponseWriter, req *http.Request) {
+	data, ok := env.decodeTeamRequest(w, req)
+	if !ok {
+		return
+	}
+	id, ok := pathID(w, req)
+	if !ok {
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		members, err := env.db.ListMembers(id)
+		if err != nil {
+			respondTeamErr(w, req, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"members": members,
+		})
+	case "PUT":
+		if !strings.HasPrefix(data.Principal, "jwt:") || len(data.Principal) == len("jwt:") {
+			respondErr(w, req, http.StatusBadRequest, "principal must be jwt: followed by the subject of a JWT")
+			return
+		}
+		if err := models.ValidateRole(data.Role); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+		m := &models.Member{TeamID: id, Principal: data.Principal, Role: data.Role}
+		if err := env.db.SetMember(m); err != nil {
+			respondTeamErr(w, req, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, m)
+	case "DELETE":
+		if err := notEmpty(map[string]string{"principal": data.Principal}); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+		if err := env.db.RemoveMember(id, data.Principal); err != nil {
+			respondTeamErr(w, req, err)
+			return
+		}
+		respondMessage(w, req, http.StatusOK, fmt.Sprintf("%v removed from team %v", data.Principal, id))
+	}
+}
+
+// SetRegistrationTeam makes the team teamId of the request the owner of
+// the registration with the id of the path, which needs an admin.
+// A teamId of 0 removes the owner of the registration.
+func (env *Env) SetRegistrationTeam(w http.ResponseWriter, req *http.Request) {
+	data, ok := env.decodeTeamRequest(w, req)
+	if !ok {
+		return
+	}
+	id, ok := pathID(w, req)
+	if !ok {
+		return
+	}
+	if data.TeamID < 0 {
+		respondErr(w, req, http.StatusBadRequest, fmt.Sprintf("invalid teamId: %v", data.TeamID))
+		return
+	}
+	if err := env.db.SetRegistrationTeam(id, data.TeamID); err != nil {
+		respondTeamErr(w, req, err)
+		return
+	}
+	if data.TeamID == 0 {
+		respondMessage(w, req, http.StatusOK, fmt.Sprintf("registration %v has no team", id))
+		return
+	}
+	respondMessage(w, req, http.StatusOK, fmt.Sprintf("registration %v belongs to team %v", id, data.TeamID))
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestEnv_teams(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        func(env *Env) http.HandlerFunc
+		method         string
+		id             string
+		request        string
+		noAdmin        bool
+		wantMsg        string
+		wantStatusCode int
+	}{
+		{name: "list without admin", handler: func(env *Env) http.HandlerFunc { return env.TeamsMethodRouter }, method: "GET", noAdmin: true, wantMsg: `{"error":{"message":"admin authentication required"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "list teams", handler: func(env *Env) http.HandlerFunc { return env.TeamsMethodRouter }, method: "GET", wantMsg: `{"teams":[{"id":7,"name":"dba","created":"2020-01-01T00:00:00Z"}]}`, wantStatusCode: http.StatusOK},
+		{name: "create without name", handler: func(env *Env) http.HandlerFunc { return env.TeamsMethodRouter }, method: "POST", request: `{}`, wantMsg: `{"error":{"message":"name is missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "create existing team", handler: func(env *Env) http.HandlerFunc { return env.TeamsMethodRouter }, method: "POST", request: `{"name":"dba"}`, wantMsg: `{"error":{"message":"team dba: already exists"}}`, wantStatusCode: http.StatusConflict},
+		{name: "create fails", handler: func(env *Env) http.HandlerFunc { return env.TeamsMethodRouter }, method: "POST", request: `{"name":"fail"}`, wantMsg: `{"error":{"message":"internal server error"}}`, wantStatusCode: http.StatusInternalServerError},
+		{name: "create team", handler: func(env *Env) http.HandlerFunc { return env.TeamsMethodRouter }, method: "POST", request: `{"name":"dev"}`, wantMsg: `{"id":8,"name":"dev","created":"2020-01-01T00:00:00Z"}`, wantStatusCode: http.StatusCreated},
+		{name: "delete invalid id", handler: func(env *Env) http.HandlerFunc { return env.DeleteTeam }, method: "DELETE", id: "dba", wantMsg: `{"error":{"message":"invalid id: \"dba\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "delete unknown team", handler: func(env *Env) http.HandlerFunc { return env.DeleteTeam }, method: "DELETE", id: "9", wantMsg: `{"error":{"message":"team 9: not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "delete team", handler: func(env *Env) http.HandlerFunc { return env.DeleteTeam }, method: "DELETE", id: "7", wantMsg: `{"message":"team 7 deleted"}`, wantStatusCode: http.StatusOK},
+		{name: "list members of unknown team", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "GET", id: "9", wantMsg: `{"error":{"message":"team 9: not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "list members", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "GET", id: "7", wantMsg: `{"members":[{"teamId":7,"principal":"jwt:carol","role":"provisioner"},{"teamId":7,"principal":"jwt:dave","role":"viewer"}]}`, wantStatusCode: http.StatusOK},
+		{name: "bind token", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "PUT", id: "7", request: `{"principal":"token:1","role":"admin"}`, wantMsg: `{"error":{"message":"principal must be jwt: followed by the subject of a JWT"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "bind unknown role", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "PUT", id: "7", request: `{"principal":"jwt:erin","role":"owner"}`, wantMsg: `{"error":{"message":"unknown role: \"owner\""}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "bind in unknown team", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "PUT", id: "9", request: `{"principal":"jwt:erin","role":"viewer"}`, wantMsg: `{"error":{"message":"team 9: not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "bind role", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "PUT", id: "7", request: `{"principal":"jwt:erin","role":"admin"}`, wantMsg: `{"teamId":7,"principal":"jwt:erin","role":"admin"}`, wantStatusCode: http.StatusOK},
+		{name: "remove without principal", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "DELETE", id: "7", request: `{}`, wantMsg: `{"error":{"message":"principal is missing"}}`, wantStatusCode: http.StatusBadRequest},
+		{name: "remove unknown member", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "DELETE", id: "7", request: `{"principal":"jwt:erin"}`, wantMsg: `{"error":{"message":"member jwt:erin of team 7: not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "remove member", handler: func(env *Env) http.HandlerFunc { return env.TeamMembersMethodRouter }, method: "DELETE", id: "7", request: `{"principal":"jwt:carol"}`, wantMsg: `{"message":"jwt:carol removed from team 7"}`, wantStatusCode: http.StatusOK},
+		{name: "assign without admin", handler: func(env *Env) http.HandlerFunc { return env.SetRegistrationTeam }, method: "PUT", id: "1", request: `{"teamId":7}`, noAdmin: true, wantMsg: `{"error":{"message":"admin authentication required"}}`, wantStatusCode: http.StatusUnauthorized},
+		{name: "assign unknown registration", handler: func(env *Env) http.HandlerFunc { return env.SetRegistrationTeam }, method: "PUT", id: "2", request: `{"teamId":7}`, wantMsg: `{"error":{"message":"registration 2: not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "assign unknown team", handler: func(env *Env) http.HandlerFunc { return env.SetRegistrationTeam }, method: "PUT", id: "1", request: `{"teamId":9}`, wantMsg: `{"error":{"message":"team 9: not found"}}`, wantStatusCode: http.StatusNotFound},
+		{name: "assign team", handler: func(env *Env) http.HandlerFunc { return env.SetRegistrationTeam }, method: "PUT", id: "1", request: `{"teamId":7}`, wantMsg: `{"message":"registration 1 belongs to team 7"}`, wantStatusCode: http.StatusOK},
+		{name: "remove team", handler: func(env *Env) http.HandlerFunc { return env.SetRegistrationTeam }, method: "PUT", id: "1", request: `{"teamId":0}`, wantMsg: `{"message":"registration 1 has no team"}`, wantStatusCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "/api/v1/teams", strings.NewReader(tt.request))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			if tt.id != "" {
+				req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			}
+			if !tt.noAdmin {
+				req.Header.Set(AdminKeyHeader, testAdminKey)
+			}
+
+			var db *mockDB
+			env := newAdminEnv(db)
+			checkResponse(t, tt.handler(env), req, tt.wantStatusCode, tt.wantMsg)
+		})
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/svenbs/banquette/pkg/databases"
 	"github.com/svenbs/banquette/pkg/models"
 )
 
-// TokenMethodRouter routes incoming Requests regarding their request method
+// TokenMethodRouter routes incoming Requests regarding their request method.
+// Registering and updating databases needs an admin, see Admins.
 func (env *Env) TokenMethodRouter(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case "POST":
@@ -24,11 +26,16 @@ func (env *Env) TokenMethodRouter(w http.ResponseWriter, req *http.Request) {
 // it returns a token to the user which can be used to
 // create users in the registered databse.
 func (env *Env) registerDatabase(w http.ResponseWriter, req *http.Request) {
+	principal, ok := env.authorizeAdmin(w, req)
+	if !ok {
+		return
+	}
 	data := &models.Database{}
 	if err := decodeBody(req, data); err != nil {
 		respondErr(w, req, http.StatusBadRequest, "malformed request body")
 		return
 	}
+	data.CreatedBy = principal
 
 	err := notEmpty(map[string]string{
 		"dbaddr":   data.DBAddr,
@@ -41,6 +48,26 @@ func (env *Env) registerDatabase(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if data.Type == "" {
+		data.Type = models.DefaultType
+	}
+	if err := checkType(data.Type); err != nil {
+		respondErr(w, req, http.StatusBadRequest, err)
+		return
+	}
+	if data.Template != nil {
+		if err := data.Template.Validate(); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if data.Quota != nil {
+		if err := data.Quota.Validate(); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	if err := env.db.RegisterDatabase(data); err != nil {
 		log.Println(err)
 		respondErr(w, req, http.StatusInternalServerError, err)
@@ -54,15 +81,19 @@ func (env *Env) registerDatabase(w http.ResponseWriter, req *http.Request) {
 
 // updateDatabase updates a registered database and its credentials.
 func (env *Env) updateDatabase(w http.ResponseWriter, req *http.Request) {
+	principal, ok := env.authorizeAdmin(w, req)
+	if !ok {
+		return
+	}
 	data := &models.Database{}
 	if err := decodeBody(req, data); err != nil {
 		log.Printf("could not decode request body: %v", err)
 		respondErr(w, req, http.StatusBadRequest, "malformed request body")
 		return
 	}
+	data.UpdatedBy = principal
 
 	err := notEmpty(map[string]string{
-		"token":    data.Token,
 		"dbaddr":   data.DBAddr,
 		"dbname":   data.DBName,
 		"username": data.Username,
@@ -73,6 +104,30 @@ func (env *Env) updateDatabase(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if data.Type != "" {
+		if err := checkType(data.Type); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if data.Template != nil {
+		if err := data.Template.Validate(); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if data.Quota != nil {
+		if err := data.Quota.Validate(); err != nil {
+			respondErr(w, req, http.StatusBadRequest, err)
+			return
+		}
+	}
+	c, ok := env.authorize(w, req, data.Token, models.ScopeRegistrationAdmin)
+	if !ok {
+		return
+	}
+	data.ID = c.RegistrationID
+
 	if err := env.db.UpdateDatabase(data); err != nil {
 		log.Println(err)
 		respondErr(w, req, http.StatusInternalServerError, err)
@@ -85,19 +140,16 @@ func (env *Env) updateDatabase(w http.ResponseWriter, req *http.Request) {
 // unregisterDatabase unregisters a database with its credentials.
 func (env *Env) unregisterDatabase(w http.ResponseWriter, req *http.Request) {
 	data := &models.Database{}
-	if err := decodeBody(req, data); err != nil {
+	if err := decodeOptionalBody(req, data); err != nil {
 		log.Println(err)
 		respondErr(w, req, http.StatusBadRequest, "malformed request body")
 		return
 	}
-
-	err := notEmpty(map[string]string{
-		"token": data.Token,
-	})
-	if err != nil {
-		respondErr(w, req, http.StatusBadRequest, err)
+	c, ok := env.authorize(w, req, data.Token, models.ScopeRegistrationAdmin)
+	if !ok {
 		return
 	}
+	data.ID = c.RegistrationID
 
 	if err := env.db.UnregisterDatabase(data); err != nil {
 		log.Println(err)
@@ -108,6 +160,14 @@ func (env *Env) unregisterDatabase(w http.ResponseWriter, req *http.Request) {
 	respondMessage(w, req, http.StatusOK, "token deleted")
 }
 
+// checkType rejects database types no provisioner is registered for
+func checkType(typ string) error {
+	if !databases.Registered(typ) {
+		return fmt.Errorf("unsupported database type: %v", typ)
+	}
+	return nil
+}
+
 func notEmpty(args map[string]string) error {
 	for key, value := range args {
 		if len(value) <= 0 {
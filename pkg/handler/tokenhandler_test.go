@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/svenbs/banquette/pkg/models"
 )
@@ -35,29 +36,31 @@ func TestEnv_TokenMethodRouter(t *testing.T) {
 		{name: "register missing password", method: "POST", jsonrequest: map[string]string{"token": "token", "username": "user", "dbaddr": "addr", "dbname": "name"}, err: "password is missing"},
 		{name: "register missing dbaddr", method: "POST", jsonrequest: map[string]string{"token": "token", "username": "user", "password": "pass", "dbname": "name"}, err: "dbaddr is missing"},
 		{name: "register missing dbname", method: "POST", jsonrequest: map[string]string{"token": "token", "username": "user", "password": "pass", "dbaddr": "addr"}, err: "dbname is missing"},
+		{name: "register unsupported type", method: "POST", jsonrequest: map[string]string{"type": "db2", "username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, err: "unsupported database type: db2"},
+		{name: "register postgres", method: "POST", status: http.StatusCreated, jsonrequest: map[string]string{"type": "postgres", "username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, msg: "{\"token\":\"sha256token\"}"},
 		{name: "register successfull", method: "POST", status: http.StatusCreated, jsonrequest: map[string]string{"token": "token", "username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, msg: "{\"token\":\"sha256token\"}"},
 		// update
 		{name: "update internal server error", method: "PATCH", jsonrequest: map[string]string{"token": "internal", "username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, status: http.StatusInternalServerError, err: "simulated internal server error"},
 		{name: "update no values", method: "PATCH", err: "%"},
 		{name: "update no request body", method: "PATCH", err: "malformed request body"},
 		{name: "update no jsonrequest body", method: "PATCH", err: "malformed request body"},
-		{name: "update missing token", method: "PATCH", jsonrequest: map[string]string{"username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, err: "token is missing"},
+		{name: "update missing token", method: "PATCH", jsonrequest: map[string]string{"username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, err: "missing token"},
 		{name: "update missing username", method: "PATCH", jsonrequest: map[string]string{"token": "token", "password": "pass", "dbaddr": "addr", "dbname": "name"}, err: "username is missing"},
 		{name: "update missing password", method: "PATCH", jsonrequest: map[string]string{"token": "token", "username": "user", "dbaddr": "addr", "dbname": "name"}, err: "password is missing"},
 		{name: "update missing dbaddr", method: "PATCH", jsonrequest: map[string]string{"token": "token", "username": "user", "password": "pass", "dbname": "name"}, err: "dbaddr is missing"},
 		{name: "update missing dbname", method: "PATCH", jsonrequest: map[string]string{"token": "token", "username": "user", "password": "pass", "dbaddr": "addr"}, err: "dbname is missing"},
+		{name: "update unsupported type", method: "PATCH", jsonrequest: map[string]string{"token": "token", "type": "db2", "username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, err: "unsupported database type: db2"},
 		{name: "update successfull", method: "PATCH", status: http.StatusOK, jsonrequest: map[string]string{"token": "token", "username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, msg: "{\"message\":\"token updated\"}"},
 		// delete
 		{name: "delete internal server error", method: "DELETE", jsonrequest: map[string]string{"token": "internal", "username": "user", "password": "pass", "dbaddr": "addr", "dbname": "name"}, status: http.StatusInternalServerError, err: "simulated internal server error"},
 		{name: "delete no values", method: "DELETE", err: "%"},
-		{name: "delete no request body", method: "DELETE", err: "malformed request body"},
-		{name: "delete no jsonrequest body", method: "DELETE", value: "non jsonrequest body", err: "malformed request body"},
-		{name: "delete missing token", method: "DELETE", jsonrequest: map[string]string{}, err: "token is missing"},
+		{name: "delete no request body", method: "DELETE", err: "missing token"},
+		{name: "delete missing token", method: "DELETE", jsonrequest: map[string]string{}, err: "missing token"},
 		{name: "delete successfull", method: "DELETE", status: http.StatusOK, jsonrequest: map[string]string{"token": "unregister"}, msg: "{\"message\":\"token deleted\"}"},
 	}
 
 	var db *mockDB
-	env := &Env{db}
+	env := newAdminEnv(db)
 
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
@@ -83,6 +86,7 @@ func TestEnv_TokenMethodRouter(t *testing.T) {
 			if err != nil {
 				t.Fatalf("could not create request: %v", err)
 			}
+			req.Header.Set(AdminKeyHeader, testAdminKey)
 			rec := httptest.NewRecorder()
 			env.TokenMethodRouter(rec, req)
 
@@ -128,16 +132,13 @@ type mockDB struct{}
 
 func (db *mockDB) Close() {}
 
-func (db *mockDB) Get(string) (*models.Database, error) {
-	return nil, nil
-}
-
 func (db *mockDB) RegisterDatabase(data *models.Database) error {
-	data.Type = "oracle"
-
 	if data.Token == "internal" {
 		return fmt.Errorf("simulated internal server error")
 	}
+	if data.CreatedBy != "key:"+testAdminName {
+		return fmt.Errorf("unexpected admin recieved: %v", data.CreatedBy)
+	}
 
 	data.Token = "sha256token"
 	return nil
@@ -145,34 +146,392 @@ func (db *mockDB) RegisterDatabase(data *models.Database) error {
 
 // UpdateDatabase updates database credentials for a token
 func (db *mockDB) UpdateDatabase(data *models.Database) error {
-	if data.Token == "internal" {
+	if data.ID == mockRegistrations["internal"] {
 		return fmt.Errorf("simulated internal server error")
 	}
+	if data.UpdatedBy != "key:"+testAdminName {
+		return fmt.Errorf("unexpected admin recieved: %v", data.UpdatedBy)
+	}
 	data.Token = "sha256token"
 	return nil
 }
 
 func (db *mockDB) UnregisterDatabase(data *models.Database) error {
-	switch data.Token {
-	case "unregister":
+	switch data.ID {
+	case mockRegistrations["unregister"]:
 		return nil
-	case "internal":
+	case mockRegistrations["internal"]:
 		return fmt.Errorf("simulated internal server error")
 	default:
-		return fmt.Errorf("unexpected test token recieved: %v", data.Token)
+		return fmt.Errorf("unexpected test registration recieved: %v", data.ID)
 	}
 }
 
-func (db *mockDB) BookmarkUser(token, username string) error {
-	if username == "fail_bookmark" {
-		return fmt.Errorf("failed to bookmark user %v", username)
+func (db *mockDB) BookmarkUser(registrationID int, bookmark *models.Bookmark) error {
+	if strings.HasPrefix(bookmark.Username, "fail_bookmark") {
+		return fmt.Errorf("failed to bookmark user %v", bookmark.Username)
+	}
+	if bookmark.CreatedBy == "" {
+		return fmt.Errorf("bookmark of user %v has no creator", bookmark.Username)
 	}
 	return nil
 }
 
-func (db *mockDB) UnBookmarkUser(token, username string) error {
+func (db *mockDB) GetBookmark(registrationID int, username string) (*models.Bookmark, error) {
+	switch username {
+	case "not_bookmarked":
+		return nil, models.ErrNotFound
+	case "bookmark_error":
+		return nil, fmt.Errorf("simulated internal server error")
+	case "expired_user":
+		return &models.Bookmark{Username: username, State: models.StateExpired}, nil
+	case "locked_user":
+		return &models.Bookmark{Username: username, State: models.StateLocked}, nil
+	}
+	return &models.Bookmark{Username: username, State: models.StateOpen}, nil
+}
+
+func (db *mockDB) SetBookmarkState(registrationID int, username, state string) error {
+	if username == "fail_state" || strings.HasPrefix(username, "fail_bookmark") {
+		return fmt.Errorf("simulated internal server error")
+	}
+	return nil
+}
+
+// mockBookmarks are the users bookmarked for every registration of mockDB
+var mockBookmarks = []*models.Bookmark{
+	{Username: "user1", State: models.StateOpen, Tablespace: "user1", Created: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	{Username: "user2", State: models.StateLocked, Tablespace: "user2", Created: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+	{Username: "user3", State: models.StateOpen, Tablespace: "user3", Created: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+}
+
+func (db *mockDB) ListBookmarks(registrationID, limit, offset int) ([]*models.Bookmark, int, error) {
+	if registrationID == mockRegistrations["internal"] {
+		return nil, 0, fmt.Errorf("simulated internal server error")
+	}
+	return page(mockBookmarks, limit, offset), len(mockBookmarks), nil
+}
+
+func (db *mockDB) ListDatabases(limit, offset int) ([]*models.Database, int, error) {
+	if limit == 13 {
+		return nil, 0, fmt.Errorf("simulated internal server error")
+	}
+	return []*models.Database{
+		{ID: 1, Token: "token1", Type: "oracle", DBAddr: "addr", DBName: "name", Username: "admin", Password: "secret", CreatedBy: "key:ops"},
+		{ID: 2, Token: "token2", Type: "postgres", DBAddr: "addr", DBName: "name", Username: "admin", Password: "secret", Template: &models.UserTemplate{Quota: "1G"}},
+	}, 2, nil
+}
+
+func (db *mockDB) GetDatabase(id int) (*models.Database, error) {
+	switch id {
+	case mockRegistrations["unknowntype"]:
+		return &models.Database{ID: id, Type: "db2"}, nil
+	case mockRegistrations["basic"]:
+		return &models.Database{ID: id, Type: "basic"}, nil
+	case mockRegistrations["quota"]:
+		return &models.Database{ID: id, Type: "oracle", Quota: mockQuota}, nil
+	case mockRegistrations["internal"]:
+		return nil, fmt.Errorf("simulated internal server error")
+	}
+	return &models.Database{ID: id, Type: "oracle"}, nil
+}
+
+func (db *mockDB) ExpiredBookmarks(now time.Time) ([]*models.Bookmark, error) {
+	return nil, nil
+}
+
+func page(list []*models.Bookmark, limit, offset int) []*models.Bookmark {
+	if offset > len(list) {
+		offset = len(list)
+	}
+	if offset+limit > len(list) {
+		limit = len(list) - offset
+	}
+	return list[offset : offset+limit]
+}
+
+func (db *mockDB) UnBookmarkUser(registrationID int, username string) error {
 	if username == "fail_unbookmark" {
 		return fmt.Errorf("%v deleted, but could not unbookmark it", username)
 	}
 	return nil
 }
+
+func (db *mockDB) CreateLease(registrationID int, lease *models.Lease) error {
+	if lease.Username == "fail_lease" {
+		return fmt.Errorf("simulated internal server error")
+	}
+	return nil
+}
+
+// leaseStart is the issue time of the leases of mockDB
+var leaseStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func (db *mockDB) GetLease(registrationID int, id string) (*models.Lease, error) {
+	switch id {
+	case "unknown":
+		return nil, models.ErrNotFound
+	case "internal":
+		return nil, fmt.Errorf("simulated internal server error")
+	}
+	l := &models.Lease{ID: id, Username: "testuser", Issued: leaseStart, Expires: leaseStart.Add(time.Hour), MaxExpires: leaseStart.Add(3 * time.Hour)}
+	switch id {
+	case "expired":
+		l.Expires = leaseStart
+	case "drop_error":
+		l.Username = "error_dropping_user"
+	case "unbookmark_error":
+		l.Username = "fail_unbookmark"
+	case "gone":
+		l.Username = "gone"
+	}
+	return l, nil
+}
+
+func (db *mockDB) RenewLease(registrationID int, lease *models.Lease) error {
+	return nil
+}
+
+// mockTokenCreated is the creation time of the tokens of mockDB
+var mockTokenCreated = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mockRegistrations are the registrations of the tokens of mockDB
+// that behave differently, the other tokens belong to registration 1
+var mockRegistrations = map[string]int{
+	"unknowntype": 2,
+	"basic":       3,
+	"unregister":  4,
+	"quota":       5,
+	"internal":    13,
+}
+
+// mockQuota limits the users of registration 5 of mockDB
+var mockQuota = &models.Quota{MaxUsers: 3, MaxUserSize: "1G", MaxTotalSize: "2G"}
+
+func (db *mockDB) GetToken(token string) (*models.Token, error) {
+	t := &models.Token{ID: 1, RegistrationID: 1, Scopes: models.AllScopes, Created: mockTokenCreated}
+	if id, ok := mockRegistrations[token]; ok {
+		t.RegistrationID = id
+	}
+	switch token {
+	case "unknown":
+		return nil, models.ErrNotFound
+	case "token_error":
+		return nil, fmt.Errorf("simulated internal server error")
+	case "readonly":
+		t.ID, t.Scopes = 2, []string{models.ScopeUsersRead}
+	case "expired":
+		expires := mockTokenCreated.Add(time.Hour)
+		t.ExpiresAt = &expires
+	case "revoked":
+		revoked := mockTokenCreated.Add(time.Hour)
+		t.RevokedAt = &revoked
+	}
+	return t, nil
+}
+
+func (db *mockDB) CreateToken(t *models.Token) error {
+	if t.Scopes[0] == models.ScopeUsersDrop {
+		return fmt.Errorf("simulated internal server error")
+	}
+	t.ID, t.Token, t.Created = 3, "newtoken", mockTokenCreated
+	return nil
+}
+
+func (db *mockDB) ListTokens(registrationID int) ([]*models.Token, error) {
+	return []*models.Token{
+		{ID: 1, RegistrationID: registrationID, Scopes: models.AllScopes, Created: mockTokenCreated},
+		{ID: 2, RegistrationID: registrationID, Scopes: []string{models.ScopeUsersRead}, Created: mockTokenCreated},
+	}, nil
+}
+
+// mockStaleTokens are the stale tokens of mockDB
+var mockStaleTokens = func() []*models.Token {
+	expires := mockTokenCreated.Add(time.Hour)
+	used := mockTokenCreated.Add(2 * time.Hour)
+	return []*models.Token{
+		{ID: 4, RegistrationID: 1, Scopes: []string{models.ScopeUsersRead}, Created: mockTokenCreated, ExpiresAt: &expires},
+		{ID: 5, RegistrationID: 1, Scopes: []string{models.ScopeUsersRead}, Created: mockTokenCreated, LastUsedAt: &used, LastUsedIP: "192.0.2.1"},
+		{ID: 6, RegistrationID: 2, Scopes: []string{models.ScopeUsersCreate}, Created: mockTokenCreated},
+	}
+}()
+
+func (db *mockDB) StaleTokens(unusedSince, now time.Time) ([]*models.Token, error) {
+	if unusedSince.Before(mockTokenCreated) {
+		return nil, fmt.Errorf("simulated internal server error")
+	}
+	return mockStaleTokens, nil
+}
+
+func (db *mockDB) TouchToken(id int, ip string, at time.Time) error {
+	return nil
+}
+
+func (db *mockDB) RevokeToken(registrationID, id int, at time.Time) error {
+	switch id {
+	case 1, 2:
+		return nil
+	case 13:
+		return fmt.Errorf("simulated internal server error")
+	}
+	return models.ErrNotFound
+}
+
+func TestEnv_registerDatabase_template(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		template   string
+		wantStatus int
+		wantMsg    string
+	}{
+		{name: "register full template", method: "POST", template: `{"profile":"DEVUSERS","roles":["CONNECT","RESOURCE"],"privileges":["CREATE SESSION"],"initialSize":"10M","increment":"10M","maxSize":"1G","quota":"UNLIMITED","temporaryTablespace":"TEMP"}`, wantStatus: http.StatusCreated, wantMsg: "{\"token\":\"sha256token\"}"},
+		{name: "register empty template", method: "POST", template: `{}`, wantStatus: http.StatusCreated, wantMsg: "{\"token\":\"sha256token\"}"},
+		{name: "register invalid profile", method: "POST", template: `{"profile":"APP; DROP USER SYS"}`, wantStatus: http.StatusBadRequest, wantMsg: "{\"error\":{\"message\":\"invalid profile: \\\"APP; DROP USER SYS\\\"\"}}"},
+		{name: "register invalid role", method: "POST", template: `{"roles":["GSB to x"]}`, wantStatus: http.StatusBadRequest, wantMsg: "{\"error\":{\"message\":\"invalid role: \\\"GSB to x\\\"\"}}"},
+		{name: "register invalid size", method: "POST", template: `{"initialSize":"100X"}`, wantStatus: http.StatusBadRequest, wantMsg: "{\"error\":{\"message\":\"invalid initialSize: \\\"100X\\\"\"}}"},
+		{name: "register maxSize without increment", method: "POST", template: `{"maxSize":"1G"}`, wantStatus: http.StatusBadRequest, wantMsg: "{\"error\":{\"message\":\"maxSize requires an increment\"}}"},
+		{name: "update invalid quota", method: "PATCH", template: `{"quota":"lots"}`, wantStatus: http.StatusBadRequest, wantMsg: "{\"error\":{\"message\":\"invalid quota: \\\"lots\\\"\"}}"},
+		{name: "update template", method: "PATCH", template: `{"quota":"500M"}`, wantStatus: http.StatusOK, wantMsg: "{\"message\":\"token updated\"}"},
+	}
+
+	var db *mockDB
+	env := newAdminEnv(db)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			body := `{"token":"token","username":"user","password":"pass","dbaddr":"addr","dbname":"name","template":` + tc.template + `}`
+			req, err := http.NewRequest(tc.method, "/api/v1/token", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set(AdminKeyHeader, testAdminKey)
+			rec := httptest.NewRecorder()
+			env.TokenMethodRouter(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("could not read response: %v", err)
+			}
+			if res.StatusCode != tc.wantStatus {
+				t.Errorf("expected status %v; got %v", tc.wantStatus, res.StatusCode)
+			}
+			if msg := string(bytes.TrimSpace(b)); msg != tc.wantMsg {
+				t.Errorf("expected message %q; got %q", tc.wantMsg, msg)
+			}
+		})
+	}
+}
+
+// mockTeam is the team of mockDB
+var mockTeam = &models.Team{ID: 7, Name: "dba", Created: mockTokenCreated}
+
+// mockRoles are the roles of principals on registration 1 of mockDB
+var mockRoles = map[string]string{
+	"jwt:carol": models.RoleProvisioner,
+	"jwt:dave":  models.RoleViewer,
+}
+
+func (db *mockDB) CreateTeam(t *models.Team) error {
+	switch t.Name {
+	case "dba":
+		return fmt.Errorf("team dba: %w", models.ErrExists)
+	case "fail":
+		return fmt.Errorf("simulated internal server error")
+	}
+	t.ID, t.Created = 8, mockTokenCreated
+	return nil
+}
+
+func (db *mockDB) ListTeams() ([]*models.Team, error) {
+	return []*models.Team{mockTeam}, nil
+}
+
+func (db *mockDB) DeleteTeam(id int) error {
+	switch id {
+	case mockTeam.ID:
+		return nil
+	case 13:
+		return fmt.Errorf("simulated internal server error")
+	}
+	return fmt.Errorf("team %v: %w", id, models.ErrNotFound)
+}
+
+func (db *mockDB) ListMembers(teamID int) ([]*models.Member, error) {
+	if teamID != mockTeam.ID {
+		return nil, fmt.Errorf("team %v: %w", teamID, models.ErrNotFound)
+	}
+	return []*models.Member{
+		{TeamID: teamID, Principal: "jwt:carol", Role: models.RoleProvisioner},
+		{TeamID: teamID, Principal: "jwt:dave", Role: models.RoleViewer},
+	}, nil
+}
+
+func (db *mockDB) SetMember(m *models.Member) error {
+	if m.TeamID != mockTeam.ID {
+		return fmt.Errorf("team %v: %w", m.TeamID, models.ErrNotFound)
+	}
+	return nil
+}
+
+func (db *mockDB) RemoveMember(teamID int, principal string) error {
+	if _, ok := mockRoles[principal]; !ok || teamID != mockTeam.ID {
+		return fmt.Errorf("member %v of team %v: %w", principal, teamID, models.ErrNotFound)
+	}
+	return nil
+}
+
+func (db *mockDB) SetRegistrationTeam(registrationID, teamID int) error {
+	if registrationID != 1 {
+		return fmt.Errorf("registration %v: %w", registrationID, models.ErrNotFound)
+	}
+	if teamID != 0 && teamID != mockTeam.ID {
+		return fmt.Errorf("team %v: %w", teamID, models.ErrNotFound)
+	}
+	return nil
+}
+
+func (db *mockDB) MemberRole(principal string, registrationID int) (string, error) {
+	if principal == "jwt:broken" {
+		return "", fmt.Errorf("simulated internal server error")
+	}
+	if role, ok := mockRoles[principal]; ok && registrationID == 1 {
+		return role, nil
+	}
+	return "", fmt.Errorf("role of %v: %w", principal, models.ErrNotFound)
+}
+
+// mockUsage is the usage of registration 5 of mockDB and of its token 9
+var mockUsage = map[string]*models.Usage{
+	"":        {Users: 2, Size: 1 << 30},
+	"token:9": {Users: 1, Size: 500 << 20},
+}
+
+func (db *mockDB) ReserveUser(registrationID int, bookmark *models.Bookmark, limits []models.Limit) error {
+	if bookmark.CreatedBy == "" {
+		return fmt.Errorf("bookmark of user %v has no creator", bookmark.Username)
+	}
+	if bookmark.Username == "fail_reserve" {
+		return fmt.Errorf("failed to reserve user %v", bookmark.Username)
+	}
+	for _, l := range limits {
+		if l.Quota == nil {
+			continue
+		}
+		usage := &models.Usage{}
+		if registrationID == mockRegistrations["quota"] {
+			usage = mockUsage[l.Principal]
+		}
+		if err := l.Quota.Check(usage, bookmark.Size); err != nil {
+			return fmt.Errorf("quota of %v: %w", l.Name, err)
+		}
+	}
+	return nil
+}
+
+func (db *mockDB) ReleaseUser(registrationID int, username string) error {
+	return nil
+}
@@ -0,0 +1,173 @@
+// Package sqltest provides a database/sql driver for tests that records
+// the statements run through it, so generated SQL can be tested without
+// a database server.
+package sqltest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	mu        sync.Mutex
+	drivers   = make(map[string]bool)
+	recorders = make(map[string]*Recorder)
+)
+
+// Recorder keeps the statements of one test database
+type Recorder struct {
+	mu    sync.Mutex
+	stmts []string
+	// Fail returns an error for statements that should fail
+	Fail func(query string) error
+	// Count answers count(*) queries
+	Count func(query string, args []driver.Value) int64
+	// Rows answers other queries with one row per value
+	Rows func(query string) []string
+}
+
+// Statements returns the statements run so far
+func (r *Recorder) Statements() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.stmts...)
+}
+
+// Open returns a database backed by a new Recorder. The fake driver is
+// registered as driverName on first use. The database is closed when
+// the test finishes.
+func Open(t *testing.T, driverName string) (*sql.DB, *Recorder) {
+	rec := &Recorder{}
+	mu.Lock()
+	if !drivers[driverName] {
+		sql.Register(driverName, fakeDriver{})
+		drivers[driverName] = true
+	}
+	name := fmt.Sprintf("%v-%v", t.Name(), len(recorders))
+	recorders[name] = rec
+	mu.Unlock()
+
+	db, err := sql.Open(driverName, name)
+	if err != nil {
+		t.Fatalf("could not open fake database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, rec
+}
+
+// Failing returns a Fail function that fails statements
+// starting with one of the "|" separated prefixes
+func Failing(prefixes string) func(string) error {
+	if prefixes == "" {
+		return nil
+	}
+	return func(query string) error {
+		for _, prefix := range strings.Split(prefixes, "|") {
+			if strings.HasPrefix(query, prefix) {
+				return fmt.Errorf("simulated failure")
+			}
+		}
+		return nil
+	}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	rec, ok := recorders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake database %v", name)
+	}
+	return &fakeConn{rec}, nil
+}
+
+type fakeConn struct {
+	rec *Recorder
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{rec: c.rec, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+// Begin starts a transaction whose statements are recorded like others,
+// committing and rolling back does nothing.
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	rec   *Recorder
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.rec.stmts = append(s.rec.stmts, s.query)
+	if s.rec.Fail != nil {
+		if err := s.rec.Fail(s.query); err != nil {
+			return nil, err
+		}
+	}
+	// like MySQL, no rows are reported as changed
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	if s.rec.Fail != nil {
+		if err := s.rec.Fail(s.query); err != nil {
+			return nil, err
+		}
+	}
+	if !strings.Contains(s.query, "count(*)") {
+		var values []driver.Value
+		if s.rec.Rows != nil {
+			for _, v := range s.rec.Rows(s.query) {
+				values = append(values, v)
+			}
+		}
+		return &fakeRows{values: values}, nil
+	}
+	var count int64
+	if s.rec.Count != nil {
+		count = s.rec.Count(s.query, args)
+	}
+	return &fakeRows{values: []driver.Value{count}}, nil
+}
+
+// fakeRows returns one row per value
+type fakeRows struct {
+	values []driver.Value
+	next   int
+}
+
+func (r *fakeRows) Columns() []string { return []string{"value"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	dest[0] = r.values[r.next]
+	r.next++
+	return nil
+}
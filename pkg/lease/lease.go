@@ -0,0 +1,114 @@
+// Package lease issues and renews leases of dynamic credentials.
+//
+// A lease limits the lifetime of a user created by banquette. It can be
+// renewed up to a maximum TTL counted from its issue. Leases expire
+// through the expiry of their bookmark, so expired users are dropped
+// by the reaper and their leases are removed with their bookmark.
+package lease
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// ErrExpired is returned when an expired lease is renewed.
+var ErrExpired = errors.New("lease has expired")
+
+// Store is the part of models.Datastore used by Manager.
+type Store interface {
+	CreateLease(registrationID int, lease *models.Lease) error
+	GetLease(registrationID int, id string) (*models.Lease, error)
+	RenewLease(registrationID int, lease *models.Lease) error
+}
+
+// Manager issues and renews leases.
+type Manager struct {
+	Store Store
+	// TTL is the duration of leases issued or renewed without one
+	TTL time.Duration
+	// MaxTTL is the longest lifetime of a lease from its issue
+	MaxTTL time.Duration
+	// Now returns the current time, it defaults to time.Now
+	Now func() time.Time
+}
+
+// New returns a Manager for store with default settings.
+func New(store Store) *Manager {
+	return &Manager{
+		Store:  store,
+		TTL:    time.Hour,
+		MaxTTL: 24 * time.Hour,
+		Now:    time.Now,
+	}
+}
+
+// Issue returns a new lease for username lasting ttl or Manager.TTL
+// if ttl is zero. ttl is capped by Manager.MaxTTL.
+// The lease is not stored until it is passed to Create.
+func (m *Manager) Issue(username string, ttl time.Duration) (*models.Lease, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.Now().UTC().Truncate(time.Second)
+	lease := &models.Lease{
+		ID:         id,
+		Username:   username,
+		Issued:     now,
+		MaxExpires: now.Add(m.MaxTTL),
+	}
+	lease.Expires = m.expires(lease, now, ttl)
+	return lease, nil
+}
+
+// Create stores lease for the user bookmarked for the registration with id registrationID
+func (m *Manager) Create(registrationID int, lease *models.Lease) error {
+	return m.Store.CreateLease(registrationID, lease)
+}
+
+// Renew extends the lease with id by increment or Manager.TTL if increment
+// is zero, counted from now. Leases are never extended past their max TTL.
+func (m *Manager) Renew(registrationID int, id string, increment time.Duration) (*models.Lease, error) {
+	lease, err := m.Store.GetLease(registrationID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.Now().UTC().Truncate(time.Second)
+	if !lease.Expires.After(now) {
+		return nil, fmt.Errorf("lease %v: %w", id, ErrExpired)
+	}
+
+	lease.Expires = m.expires(lease, now, increment)
+	if err := m.Store.RenewLease(registrationID, lease); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// expires returns the expiry of lease if it is extended by ttl at now
+func (m *Manager) expires(lease *models.Lease, now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = m.TTL
+	}
+	expires := now.Add(ttl)
+	if expires.After(lease.MaxExpires) {
+		return lease.MaxExpires
+	}
+	return expires
+}
+
+// newID returns a random lease ID
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate lease id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
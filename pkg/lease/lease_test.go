@@ -0,0 +1,121 @@
+package lease
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+type fakeStore struct {
+	leases map[string]*models.Lease
+}
+
+func (s *fakeStore) CreateLease(registrationID int, lease *models.Lease) error {
+	l := *lease
+	s.leases[lease.ID] = &l
+	return nil
+}
+
+func (s *fakeStore) GetLease(registrationID int, id string) (*models.Lease, error) {
+	l, ok := s.leases[id]
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+	lease := *l
+	return &lease, nil
+}
+
+func (s *fakeStore) RenewLease(registrationID int, lease *models.Lease) error {
+	l := *lease
+	s.leases[lease.ID] = &l
+	return nil
+}
+
+var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestManager() (*Manager, *fakeStore, *time.Time) {
+	store := &fakeStore{leases: make(map[string]*models.Lease)}
+	now := start
+	m := New(store)
+	m.TTL = time.Hour
+	m.MaxTTL = 3 * time.Hour
+	m.Now = func() time.Time { return now }
+	return m, store, &now
+}
+
+func TestManager_Issue(t *testing.T) {
+	m, _, _ := newTestManager()
+
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		wantExpires time.Time
+	}{
+		{name: "default ttl", wantExpires: start.Add(time.Hour)},
+		{name: "ttl", ttl: 2 * time.Hour, wantExpires: start.Add(2 * time.Hour)},
+		{name: "ttl above max", ttl: 5 * time.Hour, wantExpires: start.Add(3 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lease, err := m.Issue("testuser", tt.ttl)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(lease.ID) != 32 {
+				t.Errorf("expected a lease id of 32 characters; got %q", lease.ID)
+			}
+			if !lease.Expires.Equal(tt.wantExpires) {
+				t.Errorf("expected expiry %v; got %v", tt.wantExpires, lease.Expires)
+			}
+			if want := start.Add(3 * time.Hour); !lease.MaxExpires.Equal(want) {
+				t.Errorf("expected max expiry %v; got %v", want, lease.MaxExpires)
+			}
+		})
+	}
+
+	a, _ := m.Issue("testuser", 0)
+	b, _ := m.Issue("testuser", 0)
+	if a.ID == b.ID {
+		t.Errorf("expected unique lease ids; got %v twice", a.ID)
+	}
+}
+
+func TestManager_Renew(t *testing.T) {
+	m, _, now := newTestManager()
+	lease, err := m.Issue("testuser", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Create(1, lease); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	*now = start.Add(30 * time.Minute)
+	renewed, err := m.Renew(1, lease.ID, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := start.Add(90 * time.Minute); !renewed.Expires.Equal(want) {
+		t.Errorf("expected expiry %v; got %v", want, renewed.Expires)
+	}
+
+	*now = start.Add(75 * time.Minute)
+	renewed, err = m.Renew(1, lease.ID, 2*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !renewed.Expires.Equal(lease.MaxExpires) {
+		t.Errorf("expected expiry to be capped at %v; got %v", lease.MaxExpires, renewed.Expires)
+	}
+
+	*now = lease.MaxExpires
+	if _, err := m.Renew(1, lease.ID, 0); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected %v; got %v", ErrExpired, err)
+	}
+
+	if _, err := m.Renew(1, "unknown", 0); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected %v; got %v", models.ErrNotFound, err)
+	}
+}
@@ -2,6 +2,10 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/secrets"
 
 	// mysql driver available
 	_ "github.com/go-sql-driver/mysql"
@@ -11,12 +15,36 @@ import (
 // store registered databases and BookmarkUser users inside those databases.
 type Datastore interface {
 	Close()
-	Get(token string) (*Database, error)
-	BookmarkUser(token, username string) error
-	UnBookmarkUser(token, username string) error
+	BookmarkUser(registrationID int, bookmark *Bookmark) error
+	GetBookmark(registrationID int, username string) (*Bookmark, error)
+	SetBookmarkState(registrationID int, username, state string) error
+	ListBookmarks(registrationID int, limit, offset int) ([]*Bookmark, int, error)
+	ListDatabases(limit, offset int) ([]*Database, int, error)
+	GetDatabase(id int) (*Database, error)
+	ExpiredBookmarks(now time.Time) ([]*Bookmark, error)
+	UnBookmarkUser(registrationID int, username string) error
+	CreateLease(registrationID int, lease *Lease) error
+	GetLease(registrationID int, id string) (*Lease, error)
+	RenewLease(registrationID int, lease *Lease) error
+	GetToken(token string) (*Token, error)
+	CreateToken(t *Token) error
+	ListTokens(registrationID int) ([]*Token, error)
+	StaleTokens(unusedSince, now time.Time) ([]*Token, error)
+	RevokeToken(registrationID, id int, at time.Time) error
+	TouchToken(id int, ip string, at time.Time) error
 	RegisterDatabase(data *Database) error
 	UpdateDatabase(data *Database) error
 	UnregisterDatabase(data *Database) error
+	CreateTeam(t *Team) error
+	ListTeams() ([]*Team, error)
+	DeleteTeam(id int) error
+	ListMembers(teamID int) ([]*Member, error)
+	SetMember(m *Member) error
+	RemoveMember(teamID int, principal string) error
+	SetRegistrationTeam(registrationID, teamID int) error
+	MemberRole(principal string, registrationID int) (string, error)
+	ReserveUser(registrationID int, bookmark *Bookmark, limits []Limit) error
+	ReleaseUser(registrationID int, username string) error
 }
 
 // DB is a database handle representing a pool of zero or more underlying connections.
@@ -28,8 +56,18 @@ type DB struct {
 // NewDB creates a new DB Object
 // dataSourceName format ist given by the driver
 // possible drivers are: "mysql"
-// mysql dsn example: user:password@(dbaddr)/database
-func NewDB(driver, secret, dataSourceName string) (*DB, error) {
+// mysql dsn example: user:password@(dbaddr)/database?parseTime=true
+// parseTime is required to read timestamps.
+// Passwords are encrypted with the current master key of keys and decrypted
+// with any master key keys still has. secret only decrypts passwords stored before envelope encryption.
+// Tokens are stored as their hash keyed with tokenHashKey.
+func NewDB(driver, secret, dataSourceName string, keys secrets.Provider, tokenHashKey []byte) (*DB, error) {
+	if keys == nil {
+		return nil, errors.New("missing master key")
+	}
+	if len(tokenHashKey) == 0 {
+		return nil, errors.New("missing token key")
+	}
 	db, err := sql.Open(driver, dataSourceName)
 	if err != nil {
 		return nil, err
@@ -38,6 +76,8 @@ func NewDB(driver, secret, dataSourceName string) (*DB, error) {
 		return nil, err
 	}
 	databaseSecret = secret
+	masterKeys = keys
+	tokenKey = tokenHashKey
 	return &DB{db}, nil
 }
 
@@ -1,116 +1,487 @@
 package models
 
 import (
-	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"strconv"
 	"time"
+
+	"github.com/svenbs/banquette/pkg/secrets"
 )
 
 var (
-	tokenTable    = "tokens"
-	bookmarkTable = "bookmarks"
+	registrationTable = "registrations"
+	tokenTable        = "tokens"
+	bookmarkTable     = "bookmarks"
+	leaseTable        = "leases"
+	teamTable         = "teams"
+	memberTable       = "team_members"
 
-	// databaseSecret is set by NewDB()
+	// databaseSecret decrypts passwords stored with AES_ENCRYPT
+	// before envelope encryption. It is set by NewDB()
 	databaseSecret = "setme"
+
+	// masterKeys wrap the data keys of stored passwords. They are set by NewDB()
+	masterKeys secrets.Provider
+
+	// tokenKey keys the hashes of stored tokens. It is set by NewDB()
+	tokenKey []byte
 )
 
-// Database contains database connect information
+// DefaultType is the database type of registrations that do not name one
+const DefaultType = "oracle"
+
+// ErrNotFound is returned if a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Database contains database connect information.
+// ID is the id of its registration.
 type Database struct {
+	ID       int
 	Token    string
 	Type     string
 	DBAddr   string
 	DBName   string
 	Username string
 	Password string
+	Template *UserTemplate
+	// CreatedBy and UpdatedBy are the principals of the admins
+	// that registered and last updated the database
+	CreatedBy string `json:"-"`
+	UpdatedBy string `json:"-"`
+	// TeamID is the id of the team owning the registration, 0 if it has none
+	TeamID int `json:"-"`
+	// Quota limits the users created for the registration
+	Quota *Quota
 }
 
-// Get database information that belongs to a token
-func (db *DB) Get(token string) (*Database, error) {
+// legacyKeyVersion is the key version of passwords stored with AES_ENCRYPT
+const legacyKeyVersion = 0
+
+// registrationColumns are the columns of a registration read by GetDatabase
+const registrationColumns = "r.id, r.type, r.dbaddr, r.dbname, r.username, r.template, r.quota, r.password, r.key_version, r.data_key, r.password_bound"
+
+// GetDatabase returns the database registered with id.
+// Its token is not set, only the hashes of tokens are stored.
+func (db *DB) GetDatabase(id int) (*Database, error) {
 	var v Database
-	err := db.QueryRow("SELECT AES_DECRYPT(password, ?) from "+tokenTable+" where token=?", databaseSecret, token).Scan(&v.Password)
-	if err != nil {
-		return nil, fmt.Errorf("could not decode password, check your database secret: %v", err)
+	var template, quota sql.NullString
+	var r secrets.Record
+	var bound bool
+	err := db.QueryRow("SELECT "+registrationColumns+" from "+registrationTable+" r where r.id=?", id).Scan(&v.ID, &v.Type, &v.DBAddr, &v.DBName, &v.Username, &template, &quota, &r.Ciphertext, &r.KeyVersion, &r.DataKey, &bound)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("registration %v: %w", id, ErrNotFound)
 	}
-	err = db.QueryRow("SELECT type, dbaddr, dbname, username from "+tokenTable+" where token=?", token).Scan(&v.Type, &v.DBAddr, &v.DBName, &v.Username)
 	if err != nil {
-		return nil, fmt.Errorf("could not get token information: %v", err)
+		return nil, fmt.Errorf("could not get registration %v: %v", id, err)
+	}
+	if v.Password, err = db.decryptPassword(v.ID, &r, bound); err != nil {
+		return nil, err
+	}
+	if v.Template, err = decodeTemplate(template); err != nil {
+		return nil, err
+	}
+	if v.Quota, err = decodeQuota(quota); err != nil {
+		return nil, err
 	}
 	return &v, nil
 }
 
-// BookmarkUser bookmarks a database user and link it
-// to the database token for which it was created
-func (db *DB) BookmarkUser(token, username string) error {
-	tokenID, err := db.getTokenID(token)
+// passwordAAD returns the additional data binding the password
+// of the registration with id to its row
+func passwordAAD(id int) []byte {
+	return []byte(strconv.Itoa(id))
+}
+
+// encryptPassword seals password of the registration with id with
+// a new data key wrapped by the current master key
+func encryptPassword(id int, password string) (*secrets.Record, error) {
+	r, err := secrets.Seal(masterKeys, []byte(password), passwordAAD(id))
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("could not encrypt password: %v", err)
+	}
+	return r, nil
+}
+
+// decryptPassword opens the password of the registration with id.
+// Passwords stored with AES_ENCRYPT are decrypted by the database,
+// passwords that are not bound to their row are opened without its id.
+func (db *DB) decryptPassword(id int, r *secrets.Record, bound bool) (string, error) {
+	if r.KeyVersion == legacyKeyVersion {
+		var password string
+		err := db.QueryRow("SELECT AES_DECRYPT(password, ?) from "+registrationTable+" where id=?", databaseSecret, id).Scan(&password)
+		if err != nil {
+			return "", fmt.Errorf("could not decode password, check your database secret: %v", err)
+		}
+		return password, nil
+	}
+
+	var aad []byte
+	if bound {
+		aad = passwordAAD(id)
+	}
+	password, err := secrets.Open(masterKeys, r, aad)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt password, check your master key: %v", err)
+	}
+	return string(password), nil
+}
+
+// EncryptLegacyPasswords encrypts passwords stored with AES_ENCRYPT
+// with the master key and returns the number of encrypted passwords.
+func (db *DB) EncryptLegacyPasswords() (int, error) {
+	return db.rekeyAll("key_version=?", legacyKeyVersion)
+}
+
+// BindLegacyPasswords re-encrypts passwords that were encrypted before
+// passwords were bound to the id of their registration and returns
+// the number of re-encrypted passwords.
+func (db *DB) BindLegacyPasswords() (int, error) {
+	return db.rekeyAll("password_bound=?", false)
+}
+
+// rekeyAll re-encrypts all passwords matching where with arg
+func (db *DB) rekeyAll(where string, arg interface{}) (int, error) {
+	n := 0
+	for after := 0; ; {
+		rekeyed, last, err := db.rekey(where, arg, after, 100)
+		n += rekeyed
+		if err != nil || last == after {
+			return n, err
+		}
+		after = last
+	}
+}
+
+// StalePasswords returns the number of passwords
+// not encrypted with the current master key
+func (db *DB) StalePasswords() (int, error) {
+	current, err := masterKeys.CurrentVersion()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if err := db.QueryRow("SELECT count(*) from "+registrationTable+" where key_version<>?", current).Scan(&n); err != nil {
+		return 0, fmt.Errorf("could not count stale passwords: %v", err)
+	}
+	return n, nil
+}
+
+// RekeyError is returned by Rekey if the password of a registration
+// could not be re-encrypted.
+type RekeyError struct {
+	// RegistrationID is the id of the failed registration
+	RegistrationID int
+	Err            error
+}
+
+func (e *RekeyError) Error() string {
+	return fmt.Sprintf("registration %v: %v", e.RegistrationID, e.Err)
+}
+
+// Unwrap returns the error of the failed registration
+func (e *RekeyError) Unwrap() error {
+	return e.Err
+}
+
+// Rekey re-encrypts up to limit passwords, that are not encrypted with the
+// current master key, of the registrations with an id greater than after.
+// It returns the number of re-encrypted passwords and the id of the last
+// registration it re-encrypted, so it can be continued from there. If last
+// equals after, there are no passwords left. If a registration fails, the
+// returned error is a *RekeyError with its id.
+func (db *DB) Rekey(after, limit int) (rekeyed, last int, err error) {
+	current, err := masterKeys.CurrentVersion()
+	if err != nil {
+		return 0, after, err
 	}
+	return db.rekey("key_version<>?", current, after, limit)
+}
 
-	_, err = db.Exec("INSERT INTO "+bookmarkTable+" (token_id, dbname) values (?, ?)", tokenID, username)
+// rekey re-encrypts the passwords of a batch of registrations matching
+// where with arg, which select passwords by their key version.
+func (db *DB) rekey(where string, arg interface{}, after, limit int) (rekeyed, last int, err error) {
+	rows, err := db.Query("SELECT id, password, key_version, data_key, password_bound from "+registrationTable+" where id>? and "+where+" ORDER BY id LIMIT ?", after, arg, limit)
+	if err != nil {
+		return 0, after, fmt.Errorf("could not list passwords: %v", err)
+	}
+	type stale struct {
+		id    int
+		r     secrets.Record
+		bound bool
+	}
+	var batch []stale
+	for rows.Next() {
+		var s stale
+		if err := rows.Scan(&s.id, &s.r.Ciphertext, &s.r.KeyVersion, &s.r.DataKey, &s.bound); err != nil {
+			rows.Close()
+			return 0, after, fmt.Errorf("could not read password: %v", err)
+		}
+		batch = append(batch, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, after, fmt.Errorf("could not list passwords: %v", err)
+	}
+
+	last = after
+	for _, s := range batch {
+		password, err := db.decryptPassword(s.id, &s.r, s.bound)
+		if err != nil {
+			return rekeyed, last, &RekeyError{RegistrationID: s.id, Err: err}
+		}
+		r, err := encryptPassword(s.id, password)
+		if err != nil {
+			return rekeyed, last, &RekeyError{RegistrationID: s.id, Err: err}
+		}
+		// key_version and password_bound are checked again, the row could have been updated meanwhile
+		res, err := db.Exec("UPDATE "+registrationTable+" set password=?, key_version=?, data_key=?, password_bound=TRUE where id=? and key_version=? and password_bound=?", r.Ciphertext, r.KeyVersion, r.DataKey, s.id, s.r.KeyVersion, s.bound)
+		if err != nil {
+			return rekeyed, last, &RekeyError{RegistrationID: s.id, Err: fmt.Errorf("could not store password: %v", err)}
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			rekeyed++
+		}
+		last = s.id
+	}
+	return rekeyed, last, nil
+}
+
+// BookmarkUser bookmarks a database user and links it to the
+// registration with id registrationID, in whose database it was created.
+// The tablespace is named after the user.
+func (db *DB) BookmarkUser(registrationID int, bookmark *Bookmark) error {
+	var size interface{}
+	if bookmark.Size > 0 {
+		size = bookmark.Size
+	}
+	_, err := db.Exec("INSERT INTO "+bookmarkTable+" (registration_id, dbname, tablespace, expires, created_by, size) values (?, ?, ?, ?, ?, ?)", registrationID, bookmark.Username, bookmark.Username, bookmark.Expires, bookmark.CreatedBy, size)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// UnBookmarkUser removes a bookmar for a database user created by BookmarkUser
-func (db *DB) UnBookmarkUser(token, username string) error {
-	tokenID, err := db.getTokenID(token)
+// Account states of bookmarked users. They follow the
+// account_status values of Oracle's dba_users.
+const (
+	StateOpen          = "OPEN"
+	StateLocked        = "LOCKED"
+	StateExpired       = "EXPIRED"
+	StateExpiredLocked = "EXPIRED & LOCKED"
+	// StatePending is a user reserved by ReserveUser that is being created
+	StatePending = "PENDING"
+)
+
+// Bookmark is a database user created by banquette
+type Bookmark struct {
+	RegistrationID int        `json:"-"`
+	Username       string     `json:"username"`
+	State          string     `json:"state"`
+	Tablespace     string     `json:"tablespace"`
+	Created        time.Time  `json:"created"`
+	Expires        *time.Time `json:"expires,omitempty"`
+	// CreatedBy identifies the caller that created the user,
+	// "token:<id>" or "jwt:<subject>"
+	CreatedBy string `json:"createdBy,omitempty"`
+	// Size is the size in bytes the tablespace of the user can grow to,
+	// 0 if it is not limited or the database has no tablespaces
+	Size int64 `json:"size,omitempty"`
+}
+
+// bookmarkColumns are the columns read by scanBookmark
+const bookmarkColumns = "registration_id, dbname, state, tablespace, created, expires, created_by, size"
+
+// scanBookmark reads the bookmarkColumns of a row
+func scanBookmark(row interface{ Scan(...interface{}) error }) (*Bookmark, error) {
+	var b Bookmark
+	var createdBy sql.NullString
+	var size sql.NullInt64
+	if err := row.Scan(&b.RegistrationID, &b.Username, &b.State, &b.Tablespace, &b.Created, &b.Expires, &createdBy, &size); err != nil {
+		return nil, err
+	}
+	b.CreatedBy, b.Size = createdBy.String, size.Int64
+	return &b, nil
+}
+
+// GetBookmark returns the bookmark of username of the registration with id
+// registrationID. It returns ErrNotFound if the user was not created for it
+// or is still being created.
+func (db *DB) GetBookmark(registrationID int, username string) (*Bookmark, error) {
+	b, err := scanBookmark(db.QueryRow("SELECT "+bookmarkColumns+" FROM "+bookmarkTable+" where registration_id=? and dbname=? and state<>?", registrationID, username, StatePending))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("could not get bookmark: %v", err)
+	}
+	return b, nil
+}
+
+// SetBookmarkState records the account state of a bookmarked user
+func (db *DB) SetBookmarkState(registrationID int, username, state string) error {
+	_, err := db.Exec("UPDATE "+bookmarkTable+" set state=? where registration_id=? and dbname=?", state, registrationID, username)
+	if err != nil {
+		return fmt.Errorf("could not update state of bookmark: %v", err)
 	}
+	return nil
+}
 
-	_, err = db.Exec("DELETE FROM "+bookmarkTable+" where token_id=? and dbname=?", tokenID, username)
+// UnBookmarkUser removes a bookmar for a database user created by BookmarkUser
+func (db *DB) UnBookmarkUser(registrationID int, username string) error {
+	_, err := db.Exec("DELETE FROM "+bookmarkTable+" where registration_id=? and dbname=?", registrationID, username)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (db *DB) getTokenID(token string) (int, error) {
-	var tokenID int
-	err := db.QueryRow("SELECT id from "+tokenTable+" where token=?", token).Scan(&tokenID)
+// ExpiredBookmarks returns the bookmarks that expired before now.
+// Users that are still being created are not returned.
+func (db *DB) ExpiredBookmarks(now time.Time) ([]*Bookmark, error) {
+	rows, err := db.Query("SELECT "+bookmarkColumns+" FROM "+bookmarkTable+" where expires <= ? and state<>? ORDER BY expires", now, StatePending)
 	if err != nil {
-		return 0, fmt.Errorf("could not get tokenID: %v", err)
+		return nil, fmt.Errorf("could not list expired bookmarks: %v", err)
+	}
+	defer rows.Close()
+
+	var bookmarks []*Bookmark
+	for rows.Next() {
+		b, err := scanBookmark(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not read bookmark: %v", err)
+		}
+		bookmarks = append(bookmarks, b)
 	}
-	return tokenID, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list expired bookmarks: %v", err)
+	}
+	return bookmarks, nil
 }
 
-// RegisterDatabase creates and stores a token and access credentials
-// for a database that can be used to create other database users.
+// RegisterDatabase stores the access credentials for a database that can be
+// used to create other database users, and a token with all scopes for it.
 func (db *DB) RegisterDatabase(data *Database) error {
-	data.Type = "oracle"
-
+	if data.Type == "" {
+		data.Type = DefaultType
+	}
 	if err := db.checkDB(data.DBAddr, data.DBName); err != nil {
 		return err
 	}
-	var err error
-	data.Token, err = generateToken(data.DBAddr, data.DBName)
+
+	template, err := encodeTemplate(data.Template)
 	if err != nil {
-		return fmt.Errorf("could not generate token: %v", err)
+		return err
+	}
+	quota, err := encodeQuota(data.Quota)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not register database: %v", err)
+	}
+	defer tx.Rollback()
+
+	// the password is bound to the id of the registration,
+	// so it is encrypted once the row has an id
+	res, err := tx.Exec("INSERT INTO "+registrationTable+" (type, dbaddr, dbname, username, password, template, quota, created_by) values (?, ?, ?, ?, '', ?, ?, ?)", data.Type, data.DBAddr, data.DBName, data.Username, template, quota, data.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("could not store registration: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("could not get id of registration: %v", err)
+	}
+	r, err := encryptPassword(int(id), data.Password)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE "+registrationTable+" set password=?, key_version=?, data_key=?, password_bound=TRUE where id=?", r.Ciphertext, r.KeyVersion, r.DataKey, id); err != nil {
+		return fmt.Errorf("could not store password of registration: %v", err)
 	}
 
-	if _, err := db.Exec("INSERT INTO "+tokenTable+" (token, type, dbaddr, dbname, username, password) values (?, ?, ?, ?, ?, AES_ENCRYPT(?, ?))", data.Token, data.Type, data.DBAddr, data.DBName, data.Username, data.Password, databaseSecret); err != nil {
-		return fmt.Errorf("could not store token: %v", err)
+	t := &Token{RegistrationID: int(id), Scopes: AllScopes}
+	if err := createToken(tx, t); err != nil {
+		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not register database: %v", err)
+	}
+	data.ID = t.RegistrationID
+	data.Token = t.Token
 	return nil
 }
 
-func generateToken(args ...interface{}) (string, error) {
-	h := sha256.New()
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	if _, err := h.Write([]byte(fmt.Sprint(args...) + strconv.Itoa(r.Int()))); err != nil {
-		return "", fmt.Errorf("error hashing token: %v", err)
+// encodeTemplate returns the JSON representation of t to be stored
+// with a token or nil if there is no template.
+func encodeTemplate(t *UserTemplate) (interface{}, error) {
+	if t == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode user template: %v", err)
+	}
+	return string(b), nil
+}
+
+// decodeTemplate decodes a template stored by encodeTemplate
+func decodeTemplate(s sql.NullString) (*UserTemplate, error) {
+	if !s.Valid {
+		return nil, nil
 	}
+	var t UserTemplate
+	if err := json.Unmarshal([]byte(s.String), &t); err != nil {
+		return nil, fmt.Errorf("could not decode user template: %v", err)
+	}
+	return &t, nil
+}
 
-	return fmt.Sprintf("%x", string(h.Sum(nil))), nil
+// hashToken returns the hash a token is stored as
+func hashToken(token string) string {
+	return secrets.HashToken(tokenKey, token)
+}
+
+// HashLegacyTokens replaces tokens stored in plaintext
+// with their hash and returns the number of hashed tokens.
+func (db *DB) HashLegacyTokens() (int, error) {
+	rows, err := db.Query("SELECT id, token from " + tokenTable + " where token_hash IS NULL")
+	if err != nil {
+		return 0, fmt.Errorf("could not get legacy tokens: %v", err)
+	}
+	type legacy struct {
+		id    int
+		token string
+	}
+	var tokens []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.token); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("could not read legacy token: %v", err)
+		}
+		tokens = append(tokens, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("could not read legacy tokens: %v", err)
+	}
+
+	for i, l := range tokens {
+		if _, err := db.Exec("UPDATE "+tokenTable+" set token_hash=?, token=NULL where id=? and token=?", hashToken(l.token), l.id, l.token); err != nil {
+			return i, fmt.Errorf("could not hash token %v: %v", l.id, err)
+		}
+	}
+	return len(tokens), nil
 }
 
 func (db *DB) checkDB(dbaddr, dbname string) error {
 	var count int
-	err := db.QueryRow("SELECT count(*) FROM "+tokenTable+" where dbaddr=? and dbname=?", dbaddr, dbname).Scan(&count)
+	err := db.QueryRow("SELECT count(*) FROM "+registrationTable+" where dbaddr=? and dbname=?", dbaddr, dbname).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("could not connect token database: %v", err)
 	}
@@ -120,24 +491,33 @@ func (db *DB) checkDB(dbaddr, dbname string) error {
 	return nil
 }
 
-// UpdateDatabase updates database credentials for a token
+// UpdateDatabase updates the database credentials of the registration with the id of data.
+// The stored database type, user template and quota are kept if data has none.
 func (db *DB) UpdateDatabase(data *Database) error {
-	_, err := db.Exec("UPDATE "+tokenTable+" set token=?, type=?, dbaddr=?, dbname=?, username=?, password=AES_ENCRYPT(?, ?)", data.Token, data.Type, data.DBAddr, data.DBName, data.Username, data.Password, databaseSecret)
+	template, err := encodeTemplate(data.Template)
+	if err != nil {
+		return err
+	}
+	quota, err := encodeQuota(data.Quota)
+	if err != nil {
+		return err
+	}
+	r, err := encryptPassword(data.ID, data.Password)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE "+registrationTable+" set type=COALESCE(NULLIF(?, ''), type), dbaddr=?, dbname=?, username=?, password=?, key_version=?, data_key=?, password_bound=TRUE, template=COALESCE(?, template), quota=COALESCE(?, quota), updated_by=? where id=?", data.Type, data.DBAddr, data.DBName, data.Username, r.Ciphertext, r.KeyVersion, r.DataKey, template, quota, data.UpdatedBy, data.ID)
 	if err != nil {
 		return fmt.Errorf("could not update token: %v", err)
 	}
 	return nil
 }
 
-// UnregisterDatabase removes a token and all it's
-// linked BookmarkUsers from the datastore
+// UnregisterDatabase removes the registration with the id of data with
+// all its tokens and linked BookmarkUsers from the datastore
 func (db *DB) UnregisterDatabase(data *Database) error {
-	if _, err := db.getTokenID(data.Token); err != nil {
-		return err
-	}
-	_, err := db.Exec("DELETE from "+tokenTable+" where token=?", data.Token)
-	if err != nil {
-		return fmt.Errorf("could not delete token: %v", err)
+	if _, err := db.Exec("DELETE from "+registrationTable+" where id=?", data.ID); err != nil {
+		return fmt.Errorf("could not delete registration: %v", err)
 	}
 	return nil
 }
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Lease limits the lifetime of a bookmarked user. It can be renewed
+// until MaxExpires. Expired users are dropped with their lease.
+type Lease struct {
+	ID         string    `json:"leaseId"`
+	Username   string    `json:"username"`
+	Issued     time.Time `json:"issued"`
+	Expires    time.Time `json:"expires"`
+	MaxExpires time.Time `json:"maxExpires"`
+}
+
+// CreateLease stores lease for the user bookmarked for the registration
+// with id registrationID. The bookmark expires with the lease.
+func (db *DB) CreateLease(registrationID int, lease *Lease) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not create lease: %v", err)
+	}
+	defer tx.Rollback()
+
+	var bookmarkID int
+	err = tx.QueryRow("SELECT id FROM "+bookmarkTable+" where registration_id=? and dbname=?", registrationID, lease.Username).Scan(&bookmarkID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user %v is not bookmarked: %w", lease.Username, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("could not get bookmark: %v", err)
+	}
+
+	if _, err := tx.Exec("INSERT INTO "+leaseTable+" (id, bookmark_id, issued, expires, max_expires) values (?, ?, ?, ?, ?)", lease.ID, bookmarkID, lease.Issued, lease.Expires, lease.MaxExpires); err != nil {
+		return fmt.Errorf("could not store lease: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE "+bookmarkTable+" set expires=? where id=?", lease.Expires, bookmarkID); err != nil {
+		return fmt.Errorf("could not update expiry of bookmark: %v", err)
+	}
+	return tx.Commit()
+}
+
+// GetLease returns the lease with id of a user bookmarked for the registration
+// with id registrationID. It returns ErrNotFound if it has no such lease.
+func (db *DB) GetLease(registrationID int, id string) (*Lease, error) {
+	var l Lease
+	err := db.QueryRow("SELECT l.id, b.dbname, l.issued, l.expires, l.max_expires FROM "+leaseTable+" l JOIN "+bookmarkTable+" b ON l.bookmark_id=b.id where b.registration_id=? and l.id=?", registrationID, id).Scan(&l.ID, &l.Username, &l.Issued, &l.Expires, &l.MaxExpires)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get lease: %v", err)
+	}
+	return &l, nil
+}
+
+// RenewLease stores the expiry of lease and its bookmark. It returns
+// ErrNotFound if the registration with id registrationID has no such lease.
+func (db *DB) RenewLease(registrationID int, lease *Lease) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not renew lease: %v", err)
+	}
+	defer tx.Rollback()
+
+	// the lease is looked up first, as MySQL reports no affected
+	// rows for updates that do not change the expiry
+	var bookmarkID int
+	err = tx.QueryRow("SELECT l.bookmark_id FROM "+leaseTable+" l JOIN "+bookmarkTable+" b ON l.bookmark_id=b.id where b.registration_id=? and l.id=? FOR UPDATE", registrationID, lease.ID).Scan(&bookmarkID)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("could not get lease: %v", err)
+	}
+
+	if _, err := tx.Exec("UPDATE "+leaseTable+" set expires=? where id=?", lease.Expires, lease.ID); err != nil {
+		return fmt.Errorf("could not renew lease: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE "+bookmarkTable+" set expires=? where id=?", lease.Expires, bookmarkID); err != nil {
+		return fmt.Errorf("could not update expiry of bookmark: %v", err)
+	}
+	return tx.Commit()
+}
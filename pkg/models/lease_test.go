@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/internal/sqltest"
+)
+
+func TestDB_RenewLease(t *testing.T) {
+	max := time.Date(2020, 1, 1, 3, 0, 0, 0, time.UTC)
+	lease := &Lease{ID: "lease", Username: "testuser", Expires: max, MaxExpires: max}
+
+	sqldb, rec := sqltest.Open(t, "fakemodels")
+	rec.Rows = func(query string) []string {
+		if strings.Contains(query, "l.id=?") {
+			return []string{"7"}
+		}
+		return nil
+	}
+	db := &DB{sqldb}
+
+	// the second renewal at the max TTL changes no rows
+	for i := 0; i < 2; i++ {
+		if err := db.RenewLease(1, lease); err != nil {
+			t.Fatalf("renewal %v: unexpected error: %v", i+1, err)
+		}
+	}
+	want := []string{
+		"UPDATE leases set expires=? where id=?",
+		"UPDATE bookmarks set expires=? where id=?",
+	}
+	want = append(want, want...)
+	if got := rec.Statements(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected statements %q; got %q", want, got)
+	}
+}
+
+func TestDB_RenewLease_notFound(t *testing.T) {
+	sqldb, rec := sqltest.Open(t, "fakemodels")
+	db := &DB{sqldb}
+
+	err := db.RenewLease(1, &Lease{ID: "unknown"})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected error %v; got %v", ErrNotFound, err)
+	}
+	if got := rec.Statements(); len(got) != 0 {
+		t.Errorf("expected no statements; got %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ListBookmarks returns a page of the users bookmarked for the registration
+// with id registrationID, ordered by creation, and the total number of
+// bookmarked users. Users that are still being created are not listed.
+func (db *DB) ListBookmarks(registrationID int, limit, offset int) ([]*Bookmark, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT count(*) FROM "+bookmarkTable+" where registration_id=? and state<>?", registrationID, StatePending).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("could not count bookmarks: %v", err)
+	}
+
+	rows, err := db.Query("SELECT "+bookmarkColumns+" FROM "+bookmarkTable+" where registration_id=? and state<>? ORDER BY created, dbname LIMIT ? OFFSET ?", registrationID, StatePending, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not list bookmarks: %v", err)
+	}
+	defer rows.Close()
+
+	bookmarks := []*Bookmark{}
+	for rows.Next() {
+		b, err := scanBookmark(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("could not read bookmark: %v", err)
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("could not list bookmarks: %v", err)
+	}
+	return bookmarks, total, nil
+}
+
+// ListDatabases returns a page of the registered databases, ordered by id,
+// and the total number of registered databases. Tokens and passwords
+// are not read and left empty.
+func (db *DB) ListDatabases(limit, offset int) ([]*Database, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT count(*) FROM " + registrationTable).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("could not count registrations: %v", err)
+	}
+
+	rows, err := db.Query("SELECT id, type, dbaddr, dbname, username, template, quota, created_by, updated_by, team_id FROM "+registrationTable+" ORDER BY id LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not list registrations: %v", err)
+	}
+	defer rows.Close()
+
+	databases := []*Database{}
+	for rows.Next() {
+		var d Database
+		var template, quota, createdBy, updatedBy sql.NullString
+		var teamID sql.NullInt64
+		if err := rows.Scan(&d.ID, &d.Type, &d.DBAddr, &d.DBName, &d.Username, &template, &quota, &createdBy, &updatedBy, &teamID); err != nil {
+			return nil, 0, fmt.Errorf("could not read registration: %v", err)
+		}
+		d.CreatedBy, d.UpdatedBy, d.TeamID = createdBy.String, updatedBy.String, int(teamID.Int64)
+		if d.Template, err = decodeTemplate(template); err != nil {
+			return nil, 0, err
+		}
+		if d.Quota, err = decodeQuota(quota); err != nil {
+			return nil, 0, err
+		}
+		databases = append(databases, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("could not list registrations: %v", err)
+	}
+	return databases, total, nil
+}
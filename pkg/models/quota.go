@@ -0,0 +1,256 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrQuotaUsers is returned if a quota allows no more users
+	ErrQuotaUsers = errors.New("user quota exceeded")
+	// ErrQuotaUserSize is returned if the tablespace of a user
+	// would be larger than a quota allows for one user
+	ErrQuotaUserSize = errors.New("user size quota exceeded")
+	// ErrQuotaTotalSize is returned if the tablespace of a user would
+	// exceed the size a quota allows for all users together
+	ErrQuotaTotalSize = errors.New("total size quota exceeded")
+)
+
+// Quota limits the users created for a registration or with a token.
+// Sizes have the format of the sizes of UserTemplate, e.g. "500M".
+// Empty fields are not limited.
+type Quota struct {
+	// MaxUsers is the number of bookmarked users
+	MaxUsers int `json:"maxUsers,omitempty"`
+	// MaxUserSize is the size the tablespace of one user can grow to
+	MaxUserSize string `json:"maxUserSize,omitempty"`
+	// MaxTotalSize is the size the tablespaces of all users can grow to
+	MaxTotalSize string `json:"maxTotalSize,omitempty"`
+}
+
+// Usage is what the users counted by a quota have allocated
+type Usage struct {
+	Users int
+	// Size is the size the tablespaces of the users can grow to in bytes
+	Size int64
+}
+
+// Validate checks the limits of q
+func (q *Quota) Validate() error {
+	if q.MaxUsers < 0 {
+		return fmt.Errorf("invalid maxUsers: %v", q.MaxUsers)
+	}
+	for _, size := range []struct{ name, value string }{
+		{"maxUserSize", q.MaxUserSize},
+		{"maxTotalSize", q.MaxTotalSize},
+	} {
+		if size.value == "" {
+			continue
+		}
+		if _, err := ParseSize(size.value); err != nil {
+			return fmt.Errorf("invalid %v: %q", size.name, size.value)
+		}
+	}
+	return nil
+}
+
+// Check returns an error wrapping ErrQuotaUsers, ErrQuotaUserSize or
+// ErrQuotaTotalSize if q does not allow to create a user whose tablespace
+// can grow to size bytes in addition to usage. A size of -1 is unlimited.
+func (q *Quota) Check(usage *Usage, size int64) error {
+	if q.MaxUsers > 0 && usage.Users >= q.MaxUsers {
+		return fmt.Errorf("%w: at most %v users are allowed", ErrQuotaUsers, q.MaxUsers)
+	}
+	if q.MaxUserSize == "" && q.MaxTotalSize == "" {
+		return nil
+	}
+	if size < 0 {
+		return fmt.Errorf("%w: tablespaces can grow without limit, their template needs a maxSize", ErrQuotaUserSize)
+	}
+	if q.MaxUserSize != "" {
+		max, err := ParseSize(q.MaxUserSize)
+		if err != nil {
+			return err
+		}
+		if size > max {
+			return fmt.Errorf("%w: a tablespace of %v is larger than %v", ErrQuotaUserSize, FormatSize(size), q.MaxUserSize)
+		}
+	}
+	if q.MaxTotalSize != "" {
+		max, err := ParseSize(q.MaxTotalSize)
+		if err != nil {
+			return err
+		}
+		if usage.Size+size > max {
+			return fmt.Errorf("%w: %v of %v are allocated, a tablespace of %v does not fit", ErrQuotaTotalSize, FormatSize(usage.Size), q.MaxTotalSize, FormatSize(size))
+		}
+	}
+	return nil
+}
+
+// sizeUnits are the units of sizes by their suffix
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// ParseSize returns the bytes of a size like "100M",
+// sizes without a unit are bytes as in Oracle.
+func ParseSize(s string) (int64, error) {
+	if !validSize.MatchString(s) {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSuffix(s, u.suffix), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n * unit, nil
+}
+
+// FormatSize formats bytes in the largest unit that divides them
+func FormatSize(bytes int64) string {
+	for _, u := range sizeUnits {
+		if bytes >= u.bytes && bytes%u.bytes == 0 {
+			return strconv.FormatInt(bytes/u.bytes, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
+
+// encodeQuota returns the JSON representation of q to be stored
+// with a registration or token or nil if there is no quota.
+func encodeQuota(q *Quota) (interface{}, error) {
+	if q == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(q)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode quota: %v", err)
+	}
+	return string(b), nil
+}
+
+// decodeQuota decodes a quota stored by encodeQuota
+func decodeQuota(s sql.NullString) (*Quota, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	var q Quota
+	if err := json.Unmarshal([]byte(s.String), &q); err != nil {
+		return nil, fmt.Errorf("could not decode quota: %v", err)
+	}
+	return &q, nil
+}
+
+// Limit is a quota and the users it counts
+type Limit struct {
+	// Name identifies the owner of the quota in errors, e.g. "token 9"
+	Name  string
+	Quota *Quota
+	// Principal limits the counted users to those it created,
+	// all users of the registration are counted if it is empty
+	Principal string
+}
+
+// ReserveUser checks that limits allow to create the user of bookmark and
+// bookmarks it with StatePending, so that it counts for the quotas of
+// concurrent reservations. The registration with id registrationID is locked
+// while the usage is counted. A Size of -1 is a tablespace that can grow
+// without limit, it is stored as 0.
+// It returns ErrExists if the user is already bookmarked or reserved.
+// If a quota is exceeded, the returned error wraps ErrQuotaUsers,
+// ErrQuotaUserSize or ErrQuotaTotalSize.
+func (db *DB) ReserveUser(registrationID int, bookmark *Bookmark, limits []Limit) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not reserve user: %v", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow("SELECT id FROM "+registrationTable+" where id=? FOR UPDATE", registrationID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("registration %v: %w", registrationID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("could not lock registration: %v", err)
+	}
+
+	var n int
+	if err := tx.QueryRow("SELECT count(*) FROM "+bookmarkTable+" where registration_id=? and dbname=?", registrationID, bookmark.Username).Scan(&n); err != nil {
+		return fmt.Errorf("could not get bookmark: %v", err)
+	}
+	if n > 0 {
+		return fmt.Errorf("user %v: %w", bookmark.Username, ErrExists)
+	}
+
+	for _, l := range limits {
+		if l.Quota == nil {
+			continue
+		}
+		usage, err := usage(tx, registrationID, l.Principal)
+		if err != nil {
+			return err
+		}
+		if err := l.Quota.Check(usage, bookmark.Size); err != nil {
+			return fmt.Errorf("quota of %v: %w", l.Name, err)
+		}
+	}
+
+	var size interface{}
+	if bookmark.Size > 0 {
+		size = bookmark.Size
+	}
+	if _, err := tx.Exec("INSERT INTO "+bookmarkTable+" (registration_id, dbname, tablespace, state, expires, created_by, size) values (?, ?, ?, ?, ?, ?, ?)", registrationID, bookmark.Username, bookmark.Username, StatePending, bookmark.Expires, bookmark.CreatedBy, size); err != nil {
+		return fmt.Errorf("could not reserve user: %v", err)
+	}
+	return tx.Commit()
+}
+
+// ReleaseUser removes the bookmark of username reserved by ReserveUser
+// if it is still pending. Bookmarks of created users are kept.
+func (db *DB) ReleaseUser(registrationID int, username string) error {
+	_, err := db.Exec("DELETE FROM "+bookmarkTable+" where registration_id=? and dbname=? and state=?", registrationID, username, StatePending)
+	if err != nil {
+		return fmt.Errorf("could not release user: %v", err)
+	}
+	return nil
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// usage returns the number of users bookmarked for the registration with id
+// registrationID and the size their tablespaces can grow to. If principal is
+// not empty, only the users created by principal are counted.
+func usage(db queryRower, registrationID int, principal string) (*Usage, error) {
+	query := "SELECT count(*), COALESCE(SUM(size), 0) FROM " + bookmarkTable + " where registration_id=?"
+	args := []interface{}{registrationID}
+	if principal != "" {
+		query += " and created_by=?"
+		args = append(args, principal)
+	}
+	var u Usage
+	if err := db.QueryRow(query, args...).Scan(&u.Users, &u.Size); err != nil {
+		return nil, fmt.Errorf("could not get usage: %v", err)
+	}
+	return &u, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuota_Check(t *testing.T) {
+	quota := &Quota{MaxUsers: 3, MaxUserSize: "1G", MaxTotalSize: "2G"}
+
+	tests := []struct {
+		name    string
+		quota   *Quota
+		usage   *Usage
+		size    int64
+		wantErr error
+	}{
+		{name: "no limits", quota: &Quota{}, usage: &Usage{Users: 100, Size: 1 << 40}, size: -1},
+		{name: "within quota", quota: quota, usage: &Usage{Users: 2, Size: 1 << 30}, size: 1 << 30},
+		{name: "too many users", quota: quota, usage: &Usage{Users: 3}, size: 1 << 20, wantErr: ErrQuotaUsers},
+		{name: "user too large", quota: quota, usage: &Usage{}, size: 1<<30 + 1, wantErr: ErrQuotaUserSize},
+		{name: "unlimited user", quota: quota, usage: &Usage{}, size: -1, wantErr: ErrQuotaUserSize},
+		{name: "unlimited user without size limits", quota: &Quota{MaxUsers: 1}, usage: &Usage{}, size: -1},
+		{name: "total size exceeded", quota: quota, usage: &Usage{Users: 1, Size: 1536 << 20}, size: 1 << 30, wantErr: ErrQuotaTotalSize},
+		{name: "total size reached exactly", quota: &Quota{MaxTotalSize: "2G"}, usage: &Usage{Size: 1 << 30}, size: 1 << 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.quota.Check(tt.usage, tt.size)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected no error; got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v; got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "512", want: 512},
+		{size: "100K", want: 100 << 10},
+		{size: "500M", want: 500 << 20},
+		{size: "2G", want: 2 << 30},
+		{size: "1T", want: 1 << 40},
+		{size: "", wantErr: true},
+		{size: "0M", wantErr: true},
+		{size: "-1G", wantErr: true},
+		{size: "1g", wantErr: true},
+		{size: "1.5G", wantErr: true},
+		{size: "UNLIMITED", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.size)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) = %v; want error %v", tt.size, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %v; want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  string
+	}{
+		{bytes: 0, want: "0"},
+		{bytes: 1000, want: "1000"},
+		{bytes: 1 << 10, want: "1K"},
+		{bytes: 1536 << 20, want: "1536M"},
+		{bytes: 2 << 30, want: "2G"},
+	}
+	for _, tt := range tests {
+		if got := FormatSize(tt.bytes); got != tt.want {
+			t.Errorf("FormatSize(%v) = %q; want %q", tt.bytes, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Roles of the members of a team on the registrations owned by the team
+const (
+	// RoleViewer allows to list users and read their details and leases
+	RoleViewer = "viewer"
+	// RoleProvisioner allows to create, change and drop users
+	RoleProvisioner = "provisioner"
+	// RoleAdmin allows everything a token of the registration can be granted
+	RoleAdmin = "admin"
+)
+
+// RoleScopes are the scopes granted by the roles
+var RoleScopes = map[string][]string{
+	RoleViewer:      {ScopeUsersRead},
+	RoleProvisioner: {ScopeUsersCreate, ScopeUsersRead, ScopeUsersUpdate, ScopeUsersDrop},
+	RoleAdmin:       AllScopes,
+}
+
+// ErrExists is returned if a record to create already exists.
+var ErrExists = errors.New("already exists")
+
+// Team owns registrations. Its members have a role
+// on the databases of these registrations.
+type Team struct {
+	ID      int       `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+}
+
+// Member binds Principal, e.g. "jwt:alice", to Role in a team
+type Member struct {
+	TeamID    int    `json:"teamId"`
+	Principal string `json:"principal"`
+	Role      string `json:"role"`
+}
+
+// ValidateRole checks that role is a known role
+func ValidateRole(role string) error {
+	if _, ok := RoleScopes[role]; !ok {
+		return fmt.Errorf("unknown role: %q", role)
+	}
+	return nil
+}
+
+// CreateTeam stores a new team with the name of t and sets its id and creation time.
+// It returns ErrExists if a team with the name exists.
+func (db *DB) CreateTeam(t *Team) error {
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM "+teamTable+" where name=?", t.Name).Scan(&count); err != nil {
+		return fmt.Errorf("could not check team: %v", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("team %v: %w", t.Name, ErrExists)
+	}
+
+	created := time.Now().UTC().Truncate(time.Second)
+	res, err := db.Exec("INSERT INTO "+teamTable+" (name, created) values (?, ?)", t.Name, created)
+	if err != nil {
+		return fmt.Errorf("could not create team: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("could not get id of team: %v", err)
+	}
+	t.ID, t.Created = int(id), created
+	return nil
+}
+
+// ListTeams returns all teams ordered by id
+func (db *DB) ListTeams() ([]*Team, error) {
+	rows, err := db.Query("SELECT id, name, created FROM " + teamTable + " ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("could not list teams: %v", err)
+	}
+	defer rows.Close()
+
+	teams := []*Team{}
+	for rows.Next() {
+		var t Team
+		if err := rows.Scan(&t.ID, &t.Name, &t.Created); err != nil {
+			return nil, fmt.Errorf("could not read team: %v", err)
+		}
+		teams = append(teams, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list teams: %v", err)
+	}
+	return teams, nil
+}
+
+// DeleteTeam removes the team with id and its members. Its registrations
+// are kept without a team. It returns ErrNotFound if there is no such team.
+func (db *DB) DeleteTeam(id int) error {
+	res, err := db.Exec("DELETE FROM "+teamTable+" where id=?", id)
+	if err != nil {
+		return fmt.Errorf("could not delete team: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("team %v: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// teamExists returns ErrNotFound if there is no team with id
+func (db *DB) teamExists(id int) error {
+	var count int
+	if err := db.QueryRow("SELECT count(*) FROM "+teamTable+" where id=?", id).Scan(&count); err != nil {
+		return fmt.Errorf("could not get team: %v", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("team %v: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// ListMembers returns the members of the team with id ordered by principal.
+// It returns ErrNotFound if there is no such team.
+func (db *DB) ListMembers(teamID int) ([]*Member, error) {
+	if err := db.teamExists(teamID); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT team_id, principal, role FROM "+memberTable+" where team_id=? ORDER BY principal", teamID)
+	if err != nil {
+		return nil, fmt.Errorf("could not list members: %v", err)
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.TeamID, &m.Principal, &m.Role); err != nil {
+			return nil, fmt.Errorf("could not read member: %v", err)
+		}
+		members = append(members, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list members: %v", err)
+	}
+	return members, nil
+}
+
+// SetMember binds the principal of m to its role in its team, replacing
+// a role the principal had. It returns ErrNotFound if there is no such team.
+func (db *DB) SetMember(m *Member) error {
+	if err := db.teamExists(m.TeamID); err != nil {
+		return err
+	}
+	if _, err := db.Exec("INSERT INTO "+memberTable+" (team_id, principal, role) values (?, ?, ?) ON DUPLICATE KEY UPDATE role=VALUES(role)", m.TeamID, m.Principal, m.Role); err != nil {
+		return fmt.Errorf("could not set member: %v", err)
+	}
+	return nil
+}
+
+// RemoveMember removes principal from the team with id teamID.
+// It returns ErrNotFound if principal is no member of the team.
+func (db *DB) RemoveMember(teamID int, principal string) error {
+	res, err := db.Exec("DELETE FROM "+memberTable+" where team_id=? and principal=?", teamID, principal)
+	if err != nil {
+		return fmt.Errorf("could not remove member: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("member %v of team %v: %w", principal, teamID, ErrNotFound)
+	}
+	return nil
+}
+
+// SetRegistrationTeam makes the team with id teamID the owner of the
+// registration with id registrationID, a teamID of 0 removes its owner.
+// It returns ErrNotFound if there is no such team or registration.
+func (db *DB) SetRegistrationTeam(registrationID, teamID int) error {
+	var team interface{}
+	if teamID > 0 {
+		if err := db.teamExists(teamID); err != nil {
+			return err
+		}
+		team = teamID
+	}
+	res, err := db.Exec("UPDATE "+registrationTable+" set team_id=? where id=?", team, registrationID)
+	if err != nil {
+		return fmt.Errorf("could not set team of registration: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		var count int
+		if err := db.QueryRow("SELECT count(*) FROM "+registrationTable+" where id=?", registrationID).Scan(&count); err != nil {
+			return fmt.Errorf("could not get registration: %v", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("registration %v: %w", registrationID, ErrNotFound)
+		}
+	}
+	return nil
+}
+
+// MemberRole returns the role of principal in the team owning the registration
+// with id registrationID. It returns ErrNotFound if the registration has no
+// team or principal is no member of it.
+func (db *DB) MemberRole(principal string, registrationID int) (string, error) {
+	var role string
+	err := db.QueryRow("SELECT m.role FROM "+memberTable+" m JOIN "+registrationTable+" r ON r.team_id=m.team_id where r.id=? and m.principal=?", registrationID, principal).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("role of %v on registration %v: %w", principal, registrationID, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get role: %v", err)
+	}
+	return role, nil
+}
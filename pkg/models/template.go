@@ -0,0 +1,99 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	validName      = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]{0,29}$`)
+	validPrivilege = regexp.MustCompile(`^[A-Za-z]+( [A-Za-z]+)*$`)
+	validSize      = regexp.MustCompile(`^[1-9][0-9]{0,9}[KMGT]?$`)
+)
+
+// UserTemplate describes how users are created in a registered database.
+// Empty fields are left out of the generated statements, so the
+// database defaults apply, except for the sizes which default to
+// the values of DefaultUserTemplate.
+type UserTemplate struct {
+	Profile             string   `json:"profile,omitempty"`
+	Roles               []string `json:"roles,omitempty"`
+	Privileges          []string `json:"privileges,omitempty"`
+	InitialSize         string   `json:"initialSize,omitempty"`
+	Increment           string   `json:"increment,omitempty"`
+	MaxSize             string   `json:"maxSize,omitempty"`
+	Quota               string   `json:"quota,omitempty"`
+	TemporaryTablespace string   `json:"temporaryTablespace,omitempty"`
+}
+
+// DefaultUserTemplate returns the template used for
+// registrations that were stored without one.
+func DefaultUserTemplate() *UserTemplate {
+	return &UserTemplate{
+		Profile:     "APPUSERS",
+		Roles:       []string{"GSB"},
+		InitialSize: "100M",
+		Increment:   "100M",
+		Quota:       "UNLIMITED",
+	}
+}
+
+// Size returns the bytes the tablespace of a user created with t can
+// grow to, or -1 if it autoextends without a maxSize.
+func (t *UserTemplate) Size() (int64, error) {
+	if t.Increment == "" {
+		size := t.InitialSize
+		if size == "" {
+			size = DefaultUserTemplate().InitialSize
+		}
+		return ParseSize(size)
+	}
+	if t.MaxSize == "" || strings.EqualFold(t.MaxSize, "UNLIMITED") {
+		return -1, nil
+	}
+	return ParseSize(t.MaxSize)
+}
+
+// Validate checks that all values of the template can be
+// used in DDL statements without further quoting.
+func (t *UserTemplate) Validate() error {
+	if t.Profile != "" && !validName.MatchString(t.Profile) {
+		return fmt.Errorf("invalid profile: %q", t.Profile)
+	}
+	if t.TemporaryTablespace != "" && !validName.MatchString(t.TemporaryTablespace) {
+		return fmt.Errorf("invalid temporary tablespace: %q", t.TemporaryTablespace)
+	}
+	for _, role := range t.Roles {
+		if !validName.MatchString(role) {
+			return fmt.Errorf("invalid role: %q", role)
+		}
+	}
+	for _, priv := range t.Privileges {
+		if !validPrivilege.MatchString(priv) {
+			return fmt.Errorf("invalid privilege: %q", priv)
+		}
+	}
+
+	sizes := []struct {
+		name, value string
+		unlimited   bool
+	}{
+		{"initialSize", t.InitialSize, false},
+		{"increment", t.Increment, false},
+		{"maxSize", t.MaxSize, true},
+		{"quota", t.Quota, true},
+	}
+	for _, size := range sizes {
+		if size.value == "" || (size.unlimited && strings.EqualFold(size.value, "UNLIMITED")) {
+			continue
+		}
+		if !validSize.MatchString(size.value) {
+			return fmt.Errorf("invalid %v: %q", size.name, size.value)
+		}
+	}
+	if t.MaxSize != "" && t.Increment == "" {
+		return fmt.Errorf("maxSize requires an increment")
+	}
+	return nil
+}
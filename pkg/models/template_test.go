@@ -0,0 +1,30 @@
+package models
+
+import "testing"
+
+func TestUserTemplate_Size(t *testing.T) {
+	tests := []struct {
+		name     string
+		template *UserTemplate
+		want     int64
+		wantErr  bool
+	}{
+		{name: "default", template: DefaultUserTemplate(), want: -1},
+		{name: "fixed size", template: &UserTemplate{InitialSize: "200M"}, want: 200 << 20},
+		{name: "fixed default size", template: &UserTemplate{}, want: 100 << 20},
+		{name: "max size", template: &UserTemplate{InitialSize: "100M", Increment: "100M", MaxSize: "1G"}, want: 1 << 30},
+		{name: "unlimited max size", template: &UserTemplate{Increment: "100M", MaxSize: "unlimited"}, want: -1},
+		{name: "invalid size", template: &UserTemplate{InitialSize: "lots"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.template.Size()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v; got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected size %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/secrets"
+)
+
+// Scopes limit what a token can be used for
+const (
+	// ScopeUsersCreate allows to create users
+	ScopeUsersCreate = "users:create"
+	// ScopeUsersRead allows to list users and read their details and leases
+	ScopeUsersRead = "users:read"
+	// ScopeUsersUpdate allows to change passwords, lock users and renew leases
+	ScopeUsersUpdate = "users:update"
+	// ScopeUsersDrop allows to drop users and revoke their leases
+	ScopeUsersDrop = "users:drop"
+	// ScopeRegistrationAdmin allows to change and remove the registration,
+	// to repair drift and to mint and revoke its tokens
+	ScopeRegistrationAdmin = "registration:admin"
+)
+
+// AllScopes are the scopes of the token returned by RegisterDatabase
+var AllScopes = []string{ScopeUsersCreate, ScopeUsersRead, ScopeUsersUpdate, ScopeUsersDrop, ScopeRegistrationAdmin}
+
+var (
+	// ErrTokenExpired is returned for tokens used after their expiry
+	ErrTokenExpired = errors.New("token expired")
+	// ErrTokenRevoked is returned for revoked tokens
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// Token grants access with its scopes to the database of a registration
+type Token struct {
+	ID             int `json:"id"`
+	RegistrationID int `json:"-"`
+	// Token is only set when a token is created, only its hash is stored
+	Token     string     `json:"token,omitempty"`
+	Scopes    []string   `json:"scopes"`
+	Created   time.Time  `json:"created"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	// LastUsedAt and LastUsedIP record the last authenticated call
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP string     `json:"lastUsedIp,omitempty"`
+	// Quota limits the users created with the token
+	Quota *Quota `json:"quota,omitempty"`
+}
+
+// tokenColumns are the columns read by scanToken
+const tokenColumns = "id, registration_id, scopes, created, expires_at, revoked_at, last_used_at, last_used_ip, quota"
+
+// scanToken reads the tokenColumns of a row
+func scanToken(row interface{ Scan(...interface{}) error }) (*Token, error) {
+	var t Token
+	var scopes string
+	var ip, quota sql.NullString
+	if err := row.Scan(&t.ID, &t.RegistrationID, &scopes, &t.Created, &t.ExpiresAt, &t.RevokedAt, &t.LastUsedAt, &ip, &quota); err != nil {
+		return nil, err
+	}
+	t.Scopes = splitScopes(scopes)
+	t.LastUsedIP = ip.String
+	var err error
+	if t.Quota, err = decodeQuota(quota); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Check returns ErrTokenRevoked or ErrTokenExpired
+// if t cannot be used at now
+func (t *Token) Check(now time.Time) error {
+	if t.RevokedAt != nil {
+		return ErrTokenRevoked
+	}
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return ErrTokenExpired
+	}
+	return nil
+}
+
+// ValidateScopes checks that scopes is a non empty list of known scopes
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("scopes are missing")
+	}
+	for _, s := range scopes {
+		known := false
+		for _, k := range AllScopes {
+			known = known || s == k
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+// GetToken returns the stored token. It returns ErrNotFound if token is unknown.
+// Revoked and expired tokens are returned too, see Token.Check.
+func (db *DB) GetToken(token string) (*Token, error) {
+	t, err := scanToken(db.QueryRow("SELECT "+tokenColumns+" FROM "+tokenTable+" where token_hash=?", hashToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("unknown token: %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get token: %v", err)
+	}
+	return t, nil
+}
+
+// CreateToken generates and stores a new token with the scopes, expiry
+// and quota of t for the registration of t. The token is set on t.
+func (db *DB) CreateToken(t *Token) error {
+	return createToken(db, t)
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func createToken(db execer, t *Token) error {
+	token, err := secrets.GenerateToken()
+	if err != nil {
+		return fmt.Errorf("could not generate token: %v", err)
+	}
+	quota, err := encodeQuota(t.Quota)
+	if err != nil {
+		return err
+	}
+	created := time.Now().UTC().Truncate(time.Second)
+	res, err := db.Exec("INSERT INTO "+tokenTable+" (registration_id, token_hash, scopes, created, expires_at, quota) values (?, ?, ?, ?, ?, ?)", t.RegistrationID, hashToken(token), strings.Join(t.Scopes, ","), created, t.ExpiresAt, quota)
+	if err != nil {
+		return fmt.Errorf("could not store token: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("could not get id of token: %v", err)
+	}
+	t.ID = int(id)
+	t.Token = token
+	t.Created = created
+	return nil
+}
+
+// ListTokens returns the tokens of the registration with id registrationID,
+// including revoked tokens
+func (db *DB) ListTokens(registrationID int) ([]*Token, error) {
+	return db.listTokens("SELECT "+tokenColumns+" FROM "+tokenTable+" where registration_id=? ORDER BY id", registrationID)
+}
+
+// StaleTokens returns the tokens of all registrations that are not revoked,
+// but expired at now or not used since unusedSince.
+func (db *DB) StaleTokens(unusedSince, now time.Time) ([]*Token, error) {
+	return db.listTokens("SELECT "+tokenColumns+" FROM "+tokenTable+" where revoked_at IS NULL and (expires_at <= ? or COALESCE(last_used_at, created) < ?) ORDER BY registration_id, id", now, unusedSince)
+}
+
+func (db *DB) listTokens(query string, args ...interface{}) ([]*Token, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list tokens: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not read token: %v", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list tokens: %v", err)
+	}
+	return tokens, nil
+}
+
+// RevokeToken revokes the token with id of the registration with id
+// registrationID at time at. The registration and its users are kept.
+// It returns ErrNotFound if the registration has no such unrevoked token.
+func (db *DB) RevokeToken(registrationID, id int, at time.Time) error {
+	res, err := db.Exec("UPDATE "+tokenTable+" set revoked_at=? where registration_id=? and id=? and revoked_at IS NULL", at, registrationID, id)
+	if err != nil {
+		return fmt.Errorf("could not revoke token: %v", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("token %v: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// TouchToken records a call authenticated with the token with id from ip at time at
+func (db *DB) TouchToken(id int, ip string, at time.Time) error {
+	if _, err := db.Exec("UPDATE "+tokenTable+" set last_used_at=?, last_used_ip=? where id=?", at, ip, id); err != nil {
+		return fmt.Errorf("could not record use of token %v: %v", id, err)
+	}
+	return nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,199 @@
+// Package oidc verifies JWTs issued by an OpenID Connect identity provider
+// and maps their claims to the registrations and scopes a caller may use.
+//
+// Only RS256 and ES256 signed JWTs are accepted. The public keys are read
+// from a JSON Web Key Set (JWKS) in a file or served by the provider.
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KeySource returns the public key with a key id
+type KeySource interface {
+	Key(kid string) (crypto.PublicKey, error)
+}
+
+// KeySet maps key ids to the public keys of a JWKS
+type KeySet map[string]crypto.PublicKey
+
+// Key returns the key with kid
+func (s KeySet) Key(kid string) (crypto.PublicKey, error) {
+	k, ok := s[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q: %w", kid, ErrInvalidToken)
+	}
+	return k, nil
+}
+
+// jwk is a JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X and Y are the curve and point of EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseKeySet parses a JWKS. Keys that are not RSA or P-256 signing keys are skipped.
+func ParseKeySet(data []byte) (KeySet, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("could not decode jwks: %v", err)
+	}
+
+	set := KeySet{}
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch {
+		case k.Kty == "RSA":
+			key, err = rsaKey(k)
+		case k.Kty == "EC" && k.Crv == "P-256":
+			key, err = ecKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %v", k.Kid, err)
+		}
+		set[k.Kid] = key
+	}
+	if len(set) == 0 {
+		return nil, fmt.Errorf("jwks has no usable keys")
+	}
+	return set, nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %v", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %v", err)
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if key.N.BitLen() < 2048 || key.E < 3 {
+		return nil, fmt.Errorf("rsa key too weak")
+	}
+	return key, nil
+}
+
+func ecKey(k jwk) (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x: %v", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y: %v", err)
+	}
+	key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		return nil, fmt.Errorf("point is not on curve")
+	}
+	return key, nil
+}
+
+// LoadKeySet reads a JWKS from the file at path
+func LoadKeySet(path string) (KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read jwks: %v", err)
+	}
+	return ParseKeySet(data)
+}
+
+// RemoteKeySet fetches a JWKS from a URL. It is fetched again after
+// MaxAge, or for an unknown key id, e.g. after the provider rotated its
+// keys, but not more often than MinRefresh.
+type RemoteKeySet struct {
+	URL        string
+	Client     *http.Client
+	MaxAge     time.Duration
+	MinRefresh time.Duration
+
+	mu      sync.Mutex
+	keys    KeySet
+	fetched time.Time
+	tried   time.Time
+}
+
+// NewRemoteKeySet returns a RemoteKeySet for url
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		URL:        url,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		MaxAge:     time.Hour,
+		MinRefresh: time.Minute,
+	}
+}
+
+// Key returns the key with kid
+func (s *RemoteKeySet) Key(kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, known := s.keys[kid]
+	stale := time.Since(s.fetched) > s.MaxAge
+	if (!known || stale) && time.Since(s.tried) > s.MinRefresh {
+		s.tried = time.Now()
+		if err := s.fetch(); err != nil {
+			if s.keys == nil {
+				return nil, err
+			}
+			// the last keys are kept if the provider is unavailable
+			log.Printf("keeping the last jwks: %v", err)
+		}
+	}
+	if s.keys == nil {
+		return nil, fmt.Errorf("jwks of %v not available", s.URL)
+	}
+	return s.keys.Key(kid)
+}
+
+func (s *RemoteKeySet) fetch() error {
+	res, err := s.Client.Get(s.URL)
+	if err != nil {
+		return fmt.Errorf("could not fetch jwks: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not fetch jwks: %v", res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("could not fetch jwks: %v", err)
+	}
+	keys, err := ParseKeySet(data)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	s.fetched = time.Now()
+	return nil
+}
@@ -0,0 +1,177 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for JWTs that are malformed,
+// not validly signed, expired or not issued for banquette
+var ErrInvalidToken = errors.New("invalid jwt")
+
+// Claims are the claims of a verified JWT
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Values returns the values of the claim name,
+// which is a string or a list of strings, e.g. "groups"
+func (c Claims) Values(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// time returns the numeric date claim name and whether it is set
+func (c Claims) time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// Verifier verifies JWTs signed with RS256 or ES256 by a key of Keys
+type Verifier struct {
+	Keys KeySource
+	// Issuer must be the "iss" claim
+	Issuer string
+	// Audience must be the "aud" claim or one of its values
+	Audience string
+	// Leeway is the clock skew allowed checking "exp" and "nbf"
+	Leeway time.Duration
+	// Now returns the current time, it is replaced in tests
+	Now func() time.Time
+}
+
+// NewVerifier returns a Verifier of the JWTs of issuer for audience
+func NewVerifier(keys KeySource, issuer, audience string) *Verifier {
+	return &Verifier{Keys: keys, Issuer: issuer, Audience: audience, Leeway: time.Minute, Now: time.Now}
+}
+
+// header is the JOSE header of a JWT
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature, expiry, issuer and audience of token and
+// returns its claims. Errors wrapping ErrInvalidToken are caused by token,
+// other errors by getting the key.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token: %w", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("malformed header: %w", ErrInvalidToken)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %w", ErrInvalidToken)
+	}
+	key, err := v.Keys.Key(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(h.Alg, key, digest[:], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %w", ErrInvalidToken)
+	}
+	if err := v.check(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifySignature verifies the signature sig of digest with key for alg
+func verifySignature(alg string, key crypto.PublicKey, digest, sig []byte) error {
+	switch alg {
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match %v: %w", alg, ErrInvalidToken)
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("invalid signature: %w", ErrInvalidToken)
+		}
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match %v: %w", alg, ErrInvalidToken)
+		}
+		if len(sig) != 64 {
+			return fmt.Errorf("invalid signature: %w", ErrInvalidToken)
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid signature: %w", ErrInvalidToken)
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q: %w", alg, ErrInvalidToken)
+	}
+	return nil
+}
+
+// check checks the registered claims of a verified token
+func (v *Verifier) check(claims Claims) error {
+	now := v.Now()
+	exp, ok := claims.time("exp")
+	if !ok {
+		return fmt.Errorf("token has no expiry: %w", ErrInvalidToken)
+	}
+	if !now.Before(exp.Add(v.Leeway)) {
+		return fmt.Errorf("token expired: %w", ErrInvalidToken)
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(v.Leeway).Before(nbf) {
+		return fmt.Errorf("token not valid yet: %w", ErrInvalidToken)
+	}
+	if iss, _ := claims["iss"].(string); iss != v.Issuer {
+		return fmt.Errorf("unexpected issuer %q: %w", iss, ErrInvalidToken)
+	}
+	for _, aud := range claims.Values("aud") {
+		if aud == v.Audience {
+			return nil
+		}
+	}
+	return fmt.Errorf("token is not issued for %v: %w", v.Audience, ErrInvalidToken)
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT into v
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubIssuer is an identity provider serving its JWKS at /jwks.json.
+// It signs with the RSA key "rsa" and the EC key "ec".
+type stubIssuer struct {
+	*httptest.Server
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	// requests counts the requests of the JWKS
+	requests int
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubIssuer{rsa: rsaKey, ec: ecKey}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/jwks.json" {
+			http.NotFound(w, r)
+			return
+		}
+		s.requests++
+		w.Write(s.jwks())
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwks returns the JWKS of the public keys of s
+func (s *stubIssuer) jwks() []byte {
+	b, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(s.rsa.N.Bytes()), "e": b64(big.NewInt(int64(s.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(s.ec.X.FillBytes(make([]byte, 32))), "y": b64(s.ec.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}})
+	return b
+}
+
+// sign returns a JWT of claims signed with alg and the key kid
+func (s *stubIssuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	h, _ := json.Marshal(header{Alg: alg, Kid: kid})
+	c, _ := json.Marshal(claims)
+	input := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, s.rsa, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, ss *big.Int
+		r, ss, err = ecdsa.Sign(rand.Reader, s.ec, digest[:])
+		if err == nil {
+			sig = append(r.FillBytes(make([]byte, 32)), ss.FillBytes(make([]byte, 32))...)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + b64(sig)
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	issuer := newStubIssuer(t)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"iss": issuer.URL, "aud": "banquette", "sub": "alice", "exp": now.Add(time.Hour).Unix(), "groups": []string{"dba"}}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "RS256", token: issuer.sign(t, "RS256", "rsa", claims(nil))},
+		{name: "ES256", token: issuer.sign(t, "ES256", "ec", claims(nil))},
+		{name: "audience list", token: issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"aud": []string{"other", "banquette"}}))},
+		{name: "expired within leeway", token: issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}))},
+		{name: "expired", token: issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})), wantErr: true},
+		{name: "no expiry", token: issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"exp": nil})), wantErr: true},
+		{name: "not valid yet", token: issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()})), wantErr: true},
+		{name: "other issuer", token: issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"iss": "https://evil.example.com"})), wantErr: true},
+		{name: "other audience", token: issuer.sign(t, "RS256", "rsa", claims(map[string]interface{}{"aud": "other"})), wantErr: true},
+		{name: "unknown key", token: issuer.sign(t, "RS256", "other", claims(nil)), wantErr: true},
+		{name: "algorithm does not match key", token: strings.Replace(issuer.sign(t, "RS256", "rsa", claims(nil)), b64([]byte(`{"alg":"RS256","kid":"rsa"}`)), b64([]byte(`{"alg":"ES256","kid":"rsa"}`)), 1), wantErr: true},
+		{name: "alg none", token: b64([]byte(`{"alg":"none","kid":"rsa"}`)) + "." + b64([]byte(`{"sub":"alice"}`)) + ".", wantErr: true},
+		{name: "tampered claims", token: func() string {
+			parts := strings.Split(issuer.sign(t, "ES256", "ec", claims(nil)), ".")
+			c, _ := json.Marshal(claims(map[string]interface{}{"sub": "mallory"}))
+			return parts[0] + "." + b64(c) + "." + parts[2]
+		}(), wantErr: true},
+		{name: "malformed", token: "not.a.jwt", wantErr: true},
+		{name: "database token", token: "0123456789abcdef", wantErr: true},
+	}
+
+	v := NewVerifier(NewRemoteKeySet(issuer.URL+"/jwks.json"), issuer.URL, "banquette")
+	v.Now = func() time.Time { return now }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("expected invalid token; got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Subject() != "alice" {
+				t.Errorf("expected subject alice; got %q", got.Subject())
+			}
+		})
+	}
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	issuer := newStubIssuer(t)
+	keys := NewRemoteKeySet(issuer.URL + "/jwks.json")
+
+	if _, err := keys.Key("rsa"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := keys.Key("ec"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if issuer.requests != 1 {
+		t.Errorf("expected 1 request; got %v", issuer.requests)
+	}
+
+	// unknown keys are fetched again, but not more often than MinRefresh
+	if _, err := keys.Key("rotated"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected invalid token; got %v", err)
+	}
+	if issuer.requests != 1 {
+		t.Errorf("expected 1 request within MinRefresh; got %v", issuer.requests)
+	}
+	keys.MinRefresh = 0
+	keys.Key("rotated")
+	if issuer.requests != 2 {
+		t.Errorf("expected 2 requests; got %v", issuer.requests)
+	}
+
+	// the last keys are kept if the issuer is unavailable
+	issuer.Close()
+	keys.MaxAge = 0
+	if _, err := keys.Key("rsa"); err != nil {
+		t.Errorf("expected the last keys; got %v", err)
+	}
+
+	unavailable := NewRemoteKeySet(issuer.URL + "/jwks.json")
+	if _, err := unavailable.Key("rsa"); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected an error fetching the keys; got %v", err)
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	issuer := newStubIssuer(t)
+	keys, err := ParseKeySet(issuer.jwks())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("expected the rsa and ec key; got %v keys", len(keys))
+	}
+
+	for _, jwks := range []string{
+		`{"keys":[]}`,
+		`{"keys":[{"kty":"oct","kid":"hmac","k":"c2VjcmV0"}]}`,
+		`{"keys":[{"kty":"RSA","kid":"short","n":"AQAB","e":"AQAB"}]}`,
+		`{"keys":[{"kty":"EC","kid":"off","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+		`keys`,
+	} {
+		if _, err := ParseKeySet([]byte(jwks)); err == nil {
+			t.Errorf("ParseKeySet(%v) succeeded; want error", jwks)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// Rule grants Scopes on Registrations to callers whose claim
+// Claim has one of Values, e.g. the group "dba" of "groups".
+type Rule struct {
+	Claim         string   `json:"claim"`
+	Values        []string `json:"values"`
+	Registrations []int    `json:"registrations"`
+	Scopes        []string `json:"scopes"`
+}
+
+// Rules map the claims of callers to the scopes they have on registrations.
+// Rules only grant scopes, a caller has the scopes of all matching rules.
+type Rules struct {
+	Rules []Rule `json:"rules"`
+}
+
+// ParseRules parses and validates rules in JSON, e.g.
+//
+//	{"rules": [
+//	  {"claim": "groups", "values": ["dba"], "registrations": [1, 2],
+//	   "scopes": ["users:create", "users:read", "users:update", "users:drop"]},
+//	  {"claim": "sub", "values": ["alice"], "registrations": [3], "scopes": ["users:read"]}
+//	]}
+func ParseRules(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("could not decode rules: %v", err)
+	}
+	for i, r := range rules.Rules {
+		if r.Claim == "" || len(r.Values) == 0 {
+			return nil, fmt.Errorf("rule %v: claim and values are required", i+1)
+		}
+		if len(r.Registrations) == 0 {
+			return nil, fmt.Errorf("rule %v: registrations are missing", i+1)
+		}
+		if err := models.ValidateScopes(r.Scopes); err != nil {
+			return nil, fmt.Errorf("rule %v: %v", i+1, err)
+		}
+	}
+	return &rules, nil
+}
+
+// LoadRules reads the rules from the file at path, see ParseRules
+func LoadRules(path string) (*Rules, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read rules: %v", err)
+	}
+	return ParseRules(data)
+}
+
+// Scopes returns the scopes of a caller with claims
+// on the registration with id registrationID
+func (rs *Rules) Scopes(claims Claims, registrationID int) []string {
+	var scopes []string
+	seen := map[string]bool{}
+	for _, r := range rs.Rules {
+		if !r.matches(claims, registrationID) {
+			continue
+		}
+		for _, s := range r.Scopes {
+			if !seen[s] {
+				seen[s] = true
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+func (r *Rule) matches(claims Claims, registrationID int) bool {
+	registered := false
+	for _, id := range r.Registrations {
+		registered = registered || id == registrationID
+	}
+	if !registered {
+		return false
+	}
+	for _, v := range claims.Values(r.Claim) {
+		for _, want := range r.Values {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
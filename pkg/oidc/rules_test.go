@@ -0,0 +1,53 @@
+package oidc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRules_Scopes(t *testing.T) {
+	rules, err := ParseRules([]byte(`{"rules": [
+		{"claim": "groups", "values": ["dba"], "registrations": [1, 2], "scopes": ["users:create", "users:read"]},
+		{"claim": "groups", "values": ["ops", "dba"], "registrations": [2], "scopes": ["users:read", "users:drop"]},
+		{"claim": "sub", "values": ["alice"], "registrations": [3], "scopes": ["users:read"]}
+	]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		claims         Claims
+		registrationID int
+		want           []string
+	}{
+		{name: "group", claims: Claims{"groups": []interface{}{"dev", "dba"}}, registrationID: 1, want: []string{"users:create", "users:read"}},
+		{name: "several rules", claims: Claims{"groups": []interface{}{"dba"}}, registrationID: 2, want: []string{"users:create", "users:read", "users:drop"}},
+		{name: "other registration", claims: Claims{"groups": []interface{}{"dba"}}, registrationID: 3},
+		{name: "subject", claims: Claims{"sub": "alice"}, registrationID: 3, want: []string{"users:read"}},
+		{name: "string claim", claims: Claims{"groups": "ops"}, registrationID: 2, want: []string{"users:read", "users:drop"}},
+		{name: "no match", claims: Claims{"sub": "bob", "groups": []interface{}{"dev"}}, registrationID: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules.Scopes(tt.claims, tt.registrationID); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected scopes %v; got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	for _, rules := range []string{
+		`{"rules": [{"values": ["dba"], "registrations": [1], "scopes": ["users:read"]}]}`,
+		`{"rules": [{"claim": "groups", "registrations": [1], "scopes": ["users:read"]}]}`,
+		`{"rules": [{"claim": "groups", "values": ["dba"], "scopes": ["users:read"]}]}`,
+		`{"rules": [{"claim": "groups", "values": ["dba"], "registrations": [1]}]}`,
+		`{"rules": [{"claim": "groups", "values": ["dba"], "registrations": [1], "scopes": ["root"]}]}`,
+		`rules`,
+	} {
+		if _, err := ParseRules([]byte(rules)); err == nil {
+			t.Errorf("ParseRules(%v) succeeded; want error", rules)
+		}
+	}
+}
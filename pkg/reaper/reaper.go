@@ -0,0 +1,173 @@
+// Package reaper drops users whose bookmark has expired.
+package reaper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// Store is the part of models.Datastore used by the reaper.
+type Store interface {
+	ExpiredBookmarks(now time.Time) ([]*models.Bookmark, error)
+	GetDatabase(id int) (*models.Database, error)
+	UnBookmarkUser(registrationID int, username string) error
+}
+
+// Clock tells the time. It is replaced by tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Reaper periodically drops expired users through the
+// provisioner of their registered database and removes
+// their bookmarks. Failed users are retried with an
+// exponential backoff between MinBackoff and MaxBackoff.
+type Reaper struct {
+	Store Store
+	// Open connects to a registered database, it defaults to databases.Open
+	Open       func(data *models.Database) (databases.Provisioner, error)
+	Clock      Clock
+	Interval   time.Duration
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Logger     *log.Logger
+
+	mu       sync.Mutex
+	failures map[key]*failure
+}
+
+// key identifies a bookmark
+type key struct {
+	registrationID int
+	username       string
+}
+
+// failure tracks the retries of a bookmark that could not be reaped
+type failure struct {
+	attempts int
+	next     time.Time
+}
+
+// New returns a Reaper for store with default settings.
+func New(store Store) *Reaper {
+	return &Reaper{
+		Store:      store,
+		Open:       databases.Open,
+		Clock:      realClock{},
+		Interval:   time.Minute,
+		MinBackoff: time.Minute,
+		MaxBackoff: time.Hour,
+		Logger:     log.New(os.Stderr, "reaper: ", log.LstdFlags),
+		failures:   make(map[key]*failure),
+	}
+}
+
+// Run reaps expired users every Interval until ctx is done.
+func (r *Reaper) Run(ctx context.Context) {
+	for {
+		r.Reap()
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.Clock.After(r.Interval):
+		}
+	}
+}
+
+// Reap drops all expired users once and returns the number of dropped users.
+// Users that failed before are skipped until their backoff has passed.
+func (r *Reaper) Reap() int {
+	now := r.Clock.Now()
+	bookmarks, err := r.Store.ExpiredBookmarks(now)
+	if err != nil {
+		r.Logger.Printf("could not list expired users: %v", err)
+		return 0
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// forget the failures of bookmarks that are gone or no longer expired
+	expired := make(map[key]bool, len(bookmarks))
+	for _, b := range bookmarks {
+		expired[key{b.RegistrationID, b.Username}] = true
+	}
+	for k := range r.failures {
+		if !expired[k] {
+			delete(r.failures, k)
+		}
+	}
+
+	dropped := 0
+	for _, b := range bookmarks {
+		k := key{b.RegistrationID, b.Username}
+		if f, ok := r.failures[k]; ok && now.Before(f.next) {
+			continue
+		}
+
+		if err := r.reap(b); err != nil {
+			f, ok := r.failures[k]
+			if !ok {
+				f = &failure{}
+				r.failures[k] = f
+			}
+			f.attempts++
+			backoff := r.backoff(f.attempts)
+			f.next = now.Add(backoff)
+			r.Logger.Printf("could not drop expired user %v (registration %v), attempt %v, retrying in %v: %v", b.Username, b.RegistrationID, f.attempts, backoff, err)
+			continue
+		}
+
+		delete(r.failures, k)
+		dropped++
+		r.Logger.Printf("dropped user %v (registration %v), expired at %v", b.Username, b.RegistrationID, b.Expires)
+	}
+	return dropped
+}
+
+// reap drops the user of b and deletes b
+func (r *Reaper) reap(b *models.Bookmark) error {
+	data, err := r.Store.GetDatabase(b.RegistrationID)
+	if err != nil {
+		return fmt.Errorf("could not get registered database: %v", err)
+	}
+
+	db, err := r.Open(data)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// users dropped by hand or by an attempt that could not delete
+	// the bookmark are gone, only their bookmark is left to delete
+	if err := db.DropUser(b.Username); err != nil && !errors.Is(err, databases.ErrNotFound) {
+		return err
+	}
+	return r.Store.UnBookmarkUser(b.RegistrationID, b.Username)
+}
+
+// backoff returns the wait time after the given number of failed attempts
+func (r *Reaper) backoff(attempts int) time.Duration {
+	d := r.MinBackoff
+	for i := 1; i < attempts && d < r.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return d
+}
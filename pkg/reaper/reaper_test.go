@@ -0,0 +1,275 @@
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+	// ticks receives a value whenever After is called
+	ticks chan time.Duration
+	after chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, ticks: make(chan time.Duration, 10), after: make(chan time.Time)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.ticks <- d
+	return c.after
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type fakeStore struct {
+	mu        sync.Mutex
+	bookmarks []*models.Bookmark
+	deleted   []string
+	failList  bool
+}
+
+func (s *fakeStore) ExpiredBookmarks(now time.Time) ([]*models.Bookmark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failList {
+		return nil, fmt.Errorf("simulated internal server error")
+	}
+	var expired []*models.Bookmark
+	for _, b := range s.bookmarks {
+		if b.Expires != nil && !b.Expires.After(now) {
+			expired = append(expired, b)
+		}
+	}
+	return expired, nil
+}
+
+func (s *fakeStore) GetDatabase(id int) (*models.Database, error) {
+	if id == 404 {
+		return nil, models.ErrNotFound
+	}
+	return &models.Database{ID: id, Type: "fake"}, nil
+}
+
+func (s *fakeStore) UnBookmarkUser(registrationID int, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, b := range s.bookmarks {
+		if b.RegistrationID == registrationID && b.Username == username {
+			s.bookmarks = append(s.bookmarks[:i], s.bookmarks[i+1:]...)
+			s.deleted = append(s.deleted, username)
+			return nil
+		}
+	}
+	return models.ErrNotFound
+}
+
+type fakeProvisioner struct {
+	dropped []string
+	// fail is the number of times DropUser fails per user
+	fail map[string]int
+	// gone are users that do not exist
+	gone map[string]bool
+}
+
+func (p *fakeProvisioner) Close()                                     {}
+func (p *fakeProvisioner) CreateUser(username, password string) error { return nil }
+func (p *fakeProvisioner) DropUser(username string) error {
+	if p.gone[username] {
+		return fmt.Errorf("user %v: %w", username, databases.ErrNotFound)
+	}
+	if p.fail[username] > 0 {
+		p.fail[username]--
+		return fmt.Errorf("could not drop user (%v)", username)
+	}
+	p.dropped = append(p.dropped, username)
+	return nil
+}
+
+func newTestReaper(store *fakeStore, p *fakeProvisioner, clock Clock) *Reaper {
+	r := New(store)
+	r.Open = func(data *models.Database) (databases.Provisioner, error) {
+		return p, nil
+	}
+	r.Clock = clock
+	r.Logger = log.New(ioutil.Discard, "", 0)
+	return r
+}
+
+func at(t time.Time) *time.Time {
+	return &t
+}
+
+var start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestReaper_Reap(t *testing.T) {
+	store := &fakeStore{bookmarks: []*models.Bookmark{
+		{RegistrationID: 1, Username: "expired", Expires: at(start.Add(-time.Minute))},
+		{RegistrationID: 1, Username: "forever"},
+		{RegistrationID: 2, Username: "later", Expires: at(start.Add(time.Hour))},
+	}}
+	p := &fakeProvisioner{}
+	clock := newFakeClock(start)
+	r := newTestReaper(store, p, clock)
+
+	if n := r.Reap(); n != 1 {
+		t.Fatalf("expected 1 dropped user; got %v", n)
+	}
+	if fmt.Sprint(p.dropped) != "[expired]" || fmt.Sprint(store.deleted) != "[expired]" {
+		t.Fatalf("expected expired to be dropped and deleted; got %v, %v", p.dropped, store.deleted)
+	}
+
+	clock.Advance(time.Hour)
+	if n := r.Reap(); n != 1 {
+		t.Fatalf("expected 1 dropped user; got %v", n)
+	}
+	if fmt.Sprint(p.dropped) != "[expired later]" {
+		t.Fatalf("expected later to be dropped; got %v", p.dropped)
+	}
+	if len(store.bookmarks) != 1 || store.bookmarks[0].Username != "forever" {
+		t.Fatalf("expected only forever to be left; got %v", store.bookmarks)
+	}
+}
+
+func TestReaper_Reap_backoff(t *testing.T) {
+	store := &fakeStore{bookmarks: []*models.Bookmark{
+		{RegistrationID: 1, Username: "flaky", Expires: at(start)},
+	}}
+	p := &fakeProvisioner{fail: map[string]int{"flaky": 3}}
+	clock := newFakeClock(start)
+	r := newTestReaper(store, p, clock)
+	r.MinBackoff = time.Minute
+	r.MaxBackoff = 3 * time.Minute
+
+	// fails and waits 1m, 2m and 3m (capped) before the next attempt
+	for i, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		if n := r.Reap(); n != 0 {
+			t.Fatalf("expected no dropped user; got %v", n)
+		}
+		clock.Advance(backoff - time.Second)
+		r.Reap()
+		if left := p.fail["flaky"]; left != 2-i {
+			t.Fatalf("expected flaky not to be retried before %v; %v failures left", backoff, left)
+		}
+		clock.Advance(time.Second)
+	}
+
+	if n := r.Reap(); n != 1 {
+		t.Fatalf("expected 1 dropped user; got %v", n)
+	}
+	if len(store.bookmarks) != 0 {
+		t.Fatalf("expected bookmark to be deleted; got %v", store.bookmarks)
+	}
+	if len(r.failures) != 0 {
+		t.Fatalf("expected failures to be reset; got %v", r.failures)
+	}
+}
+
+func TestReaper_Reap_errors(t *testing.T) {
+	store := &fakeStore{failList: true}
+	p := &fakeProvisioner{}
+	r := newTestReaper(store, p, newFakeClock(start))
+	if n := r.Reap(); n != 0 {
+		t.Fatalf("expected no dropped user; got %v", n)
+	}
+
+	store = &fakeStore{bookmarks: []*models.Bookmark{
+		{RegistrationID: 404, Username: "unregistered", Expires: at(start)},
+	}}
+	r = newTestReaper(store, p, newFakeClock(start))
+	if n := r.Reap(); n != 0 {
+		t.Fatalf("expected no dropped user; got %v", n)
+	}
+	if len(r.failures) != 1 {
+		t.Fatalf("expected unregistered to be retried; got %v", r.failures)
+	}
+}
+
+func TestReaper_Reap_gone(t *testing.T) {
+	store := &fakeStore{bookmarks: []*models.Bookmark{
+		{RegistrationID: 1, Username: "dropped_by_hand", Expires: at(start)},
+	}}
+	p := &fakeProvisioner{gone: map[string]bool{"dropped_by_hand": true}}
+	r := newTestReaper(store, p, newFakeClock(start))
+
+	if n := r.Reap(); n != 1 {
+		t.Fatalf("expected 1 dropped user; got %v", n)
+	}
+	if fmt.Sprint(store.deleted) != "[dropped_by_hand]" {
+		t.Fatalf("expected the bookmark of a missing user to be deleted; got %v", store.deleted)
+	}
+	if len(r.failures) != 0 {
+		t.Fatalf("expected no failures; got %v", r.failures)
+	}
+}
+
+func TestReaper_Reap_pruneFailures(t *testing.T) {
+	store := &fakeStore{bookmarks: []*models.Bookmark{
+		{RegistrationID: 1, Username: "flaky", Expires: at(start)},
+	}}
+	p := &fakeProvisioner{fail: map[string]int{"flaky": 1}}
+	r := newTestReaper(store, p, newFakeClock(start))
+
+	r.Reap()
+	if len(r.failures) != 1 {
+		t.Fatalf("expected flaky to be retried; got %v", r.failures)
+	}
+
+	// the bookmark was removed elsewhere, e.g. by dropping the user
+	store.UnBookmarkUser(1, "flaky")
+	r.Reap()
+	if len(r.failures) != 0 {
+		t.Fatalf("expected the failure of a deleted bookmark to be forgotten; got %v", r.failures)
+	}
+}
+
+func TestReaper_Run(t *testing.T) {
+	store := &fakeStore{bookmarks: []*models.Bookmark{
+		{RegistrationID: 1, Username: "expired", Expires: at(start.Add(30 * time.Second))},
+	}}
+	p := &fakeProvisioner{}
+	clock := newFakeClock(start)
+	r := newTestReaper(store, p, clock)
+	r.Interval = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+
+	if d := <-clock.ticks; d != time.Minute {
+		t.Fatalf("expected to wait %v; got %v", time.Minute, d)
+	}
+	clock.Advance(time.Minute)
+	clock.after <- clock.Now()
+	<-clock.ticks
+
+	cancel()
+	<-done
+
+	if fmt.Sprint(store.deleted) != "[expired]" {
+		t.Fatalf("expected expired to be reaped; got %v", store.deleted)
+	}
+}
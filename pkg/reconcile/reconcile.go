@@ -0,0 +1,224 @@
+// Package reconcile compares the users bookmarked for a registration with
+// the users that exist in its database and repairs drift.
+//
+// Names are compared case-insensitively, since Oracle reports
+// the upper case names of users created with lower case names.
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+// Status of a drifted user
+const (
+	// Missing is a bookmarked user that does not exist in the database
+	Missing = "missing"
+	// Unbookmarked is a user in the database without a bookmark
+	Unbookmarked = "unbookmarked"
+	// Orphaned are objects named after a user that exists nowhere.
+	// They are reported but never repaired.
+	Orphaned = "orphaned"
+)
+
+// Repair actions
+const (
+	// Forget removes the bookmark of a missing user
+	Forget = "forget"
+	// Bookmark bookmarks an unbookmarked user
+	Bookmark = "bookmark"
+	// Drop drops an unbookmarked user listed in Repairs.Drop
+	Drop = "drop"
+)
+
+// ErrNotUnbookmarked is returned by Plan for users to drop
+// that are not unbookmarked users of the database.
+var ErrNotUnbookmarked = errors.New("not an unbookmarked user of the database")
+
+// Drift is a user whose bookmark does not match the database
+type Drift struct {
+	Username string `json:"username"`
+	Status   string `json:"status"`
+	// Objects exist in the database for the user
+	Objects []databases.Object `json:"objects,omitempty"`
+	// Action repairs the drift
+	Action   string `json:"action,omitempty"`
+	Repaired bool   `json:"repaired,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report is the result of a reconciliation
+type Report struct {
+	// Bookmarks is the number of bookmarked users
+	Bookmarks int `json:"bookmarks"`
+	// InSync is the number of bookmarked users that exist
+	InSync int      `json:"inSync"`
+	Drift  []*Drift `json:"drift"`
+	// Failed is the number of repairs that failed
+	Failed int `json:"failed,omitempty"`
+}
+
+// Repairs select the action taken for drifted users by status.
+// An empty action leaves users of that status alone.
+//
+// Unbookmarked users are never dropped by status, since the inventory of
+// a database can include users created by hand or for other registrations.
+// Only the users listed in Drop, as named by a previous report, are dropped.
+type Repairs struct {
+	Missing      string   `json:"missing"`
+	Unbookmarked string   `json:"unbookmarked"`
+	Drop         []string `json:"drop"`
+}
+
+// Empty reports whether no repair is selected
+func (r Repairs) Empty() bool {
+	return r.Missing == "" && r.Unbookmarked == "" && len(r.Drop) == 0
+}
+
+// Validate checks that the actions are valid for their status
+func (r Repairs) Validate() error {
+	if r.Missing != "" && r.Missing != Forget {
+		return fmt.Errorf("invalid repair for missing users: %q, must be %q", r.Missing, Forget)
+	}
+	if r.Unbookmarked == Drop {
+		return fmt.Errorf("unbookmarked users are only dropped if they are listed in drop")
+	}
+	if r.Unbookmarked != "" && r.Unbookmarked != Bookmark {
+		return fmt.Errorf("invalid repair for unbookmarked users: %q, must be %q", r.Unbookmarked, Bookmark)
+	}
+	for _, name := range r.Drop {
+		if name == "" {
+			return fmt.Errorf("invalid user to drop: %q", name)
+		}
+	}
+	return nil
+}
+
+// Compare reports the drift between bookmarks and the objects
+// returned by the inventory of their database, ordered by username.
+func Compare(bookmarks []*models.Bookmark, objects []databases.Object) *Report {
+	type entry struct {
+		name       string
+		bookmarked bool
+		user       bool
+		objects    []databases.Object
+	}
+	entries := make(map[string]*entry)
+	get := func(name string) *entry {
+		key := strings.ToLower(name)
+		e, ok := entries[key]
+		if !ok {
+			e = &entry{name: name}
+			entries[key] = e
+		}
+		return e
+	}
+
+	for _, b := range bookmarks {
+		e := get(b.Username)
+		e.name = b.Username
+		e.bookmarked = true
+	}
+	for _, o := range objects {
+		e := get(o.Name)
+		if o.Kind == "user" {
+			e.user = true
+		}
+		e.objects = append(e.objects, o)
+	}
+
+	report := &Report{Bookmarks: len(bookmarks), Drift: []*Drift{}}
+	for _, e := range entries {
+		d := &Drift{Username: e.name, Objects: e.objects}
+		switch {
+		case e.bookmarked && e.user:
+			report.InSync++
+			continue
+		case e.bookmarked:
+			d.Status = Missing
+		case e.user:
+			d.Status = Unbookmarked
+		default:
+			d.Status = Orphaned
+		}
+		report.Drift = append(report.Drift, d)
+	}
+	sort.Slice(report.Drift, func(i, j int) bool {
+		return strings.ToLower(report.Drift[i].Username) < strings.ToLower(report.Drift[j].Username)
+	})
+	return report
+}
+
+// Plan sets the action of every drifted user as selected by repairs.
+// It returns an error and plans nothing if a user listed in repairs.Drop
+// is not an unbookmarked user of the report.
+func (r *Report) Plan(repairs Repairs) error {
+	unbookmarked := make(map[string]bool)
+	for _, d := range r.Drift {
+		if d.Status == Unbookmarked {
+			unbookmarked[strings.ToLower(d.Username)] = false
+		}
+	}
+	var unknown []string
+	for _, name := range repairs.Drop {
+		key := strings.ToLower(name)
+		if _, ok := unbookmarked[key]; !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		unbookmarked[key] = true
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%w: %v", ErrNotUnbookmarked, strings.Join(unknown, ", "))
+	}
+
+	for _, d := range r.Drift {
+		switch d.Status {
+		case Missing:
+			d.Action = repairs.Missing
+		case Unbookmarked:
+			d.Action = repairs.Unbookmarked
+			if unbookmarked[strings.ToLower(d.Username)] {
+				d.Action = Drop
+			}
+		}
+	}
+	return nil
+}
+
+// Store is the part of models.Datastore used to repair bookmarks.
+type Store interface {
+	BookmarkUser(registrationID int, bookmark *models.Bookmark) error
+	UnBookmarkUser(registrationID int, username string) error
+}
+
+// Repair runs the planned actions for the users bookmarked for the
+// registration with id registrationID in db. Users bookmarked by a repair
+// are recorded as created by principal. Failed repairs are recorded in
+// the report and do not stop the remaining repairs.
+func (r *Report) Repair(store Store, registrationID int, principal string, db databases.Provisioner) {
+	for _, d := range r.Drift {
+		var err error
+		switch d.Action {
+		case "":
+			continue
+		case Forget:
+			err = store.UnBookmarkUser(registrationID, d.Username)
+		case Bookmark:
+			err = store.BookmarkUser(registrationID, &models.Bookmark{Username: d.Username, CreatedBy: principal})
+		case Drop:
+			err = db.DropUser(d.Username)
+		}
+		if err != nil {
+			d.Error = err.Error()
+			r.Failed++
+			continue
+		}
+		d.Repaired = true
+	}
+}
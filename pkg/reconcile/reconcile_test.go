@@ -0,0 +1,174 @@
+package reconcile
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/svenbs/banquette/pkg/databases"
+	"github.com/svenbs/banquette/pkg/models"
+)
+
+func testReport() *Report {
+	bookmarks := []*models.Bookmark{
+		{Username: "insync"},
+		{Username: "missing"},
+		{Username: "leftover"},
+	}
+	objects := []databases.Object{
+		{Kind: "user", Name: "INSYNC"},
+		{Kind: "tablespace", Name: "INSYNC"},
+		{Kind: "tablespace", Name: "LEFTOVER"},
+		{Kind: "user", Name: "MANUAL"},
+		{Kind: "tablespace", Name: "MANUAL"},
+		{Kind: "tablespace", Name: "ORPHAN"},
+	}
+	return Compare(bookmarks, objects)
+}
+
+func TestCompare(t *testing.T) {
+	want := &Report{
+		Bookmarks: 3,
+		InSync:    1,
+		Drift: []*Drift{
+			{Username: "leftover", Status: Missing, Objects: []databases.Object{{Kind: "tablespace", Name: "LEFTOVER"}}},
+			{Username: "MANUAL", Status: Unbookmarked, Objects: []databases.Object{{Kind: "user", Name: "MANUAL"}, {Kind: "tablespace", Name: "MANUAL"}}},
+			{Username: "missing", Status: Missing},
+			{Username: "ORPHAN", Status: Orphaned, Objects: []databases.Object{{Kind: "tablespace", Name: "ORPHAN"}}},
+		},
+	}
+	if got := testReport(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected report %+v; got %+v", want, got)
+	}
+
+	if got := Compare(nil, nil); got.Drift == nil || len(got.Drift) != 0 {
+		t.Errorf("expected no drift; got %+v", got.Drift)
+	}
+}
+
+func TestRepairs_Validate(t *testing.T) {
+	tests := []struct {
+		repairs Repairs
+		wantErr bool
+	}{
+		{repairs: Repairs{}},
+		{repairs: Repairs{Missing: Forget, Unbookmarked: Bookmark}},
+		{repairs: Repairs{Drop: []string{"MANUAL"}}},
+		{repairs: Repairs{Unbookmarked: Drop}, wantErr: true},
+		{repairs: Repairs{Drop: []string{""}}, wantErr: true},
+		{repairs: Repairs{Missing: Drop}, wantErr: true},
+		{repairs: Repairs{Unbookmarked: Forget}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.repairs.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) = %v; want error %v", tt.repairs, err, tt.wantErr)
+		}
+	}
+}
+
+func TestReport_Plan(t *testing.T) {
+	tests := []struct {
+		name    string
+		drop    []string
+		wantErr string
+	}{
+		{name: "unbookmarked", drop: []string{"MANUAL"}},
+		{name: "bookmarked", drop: []string{"INSYNC", "MANUAL", "missing"}, wantErr: "not an unbookmarked user of the database: INSYNC, missing"},
+		{name: "orphaned", drop: []string{"ORPHAN"}, wantErr: "not an unbookmarked user of the database: ORPHAN"},
+		{name: "unknown", drop: []string{"SYSTEM"}, wantErr: "not an unbookmarked user of the database: SYSTEM"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := testReport()
+			err := report.Plan(Repairs{Drop: tt.drop})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("could not plan repairs: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr || !errors.Is(err, ErrNotUnbookmarked) {
+				t.Fatalf("expected error %q; got %v", tt.wantErr, err)
+			}
+			for _, d := range report.Drift {
+				if d.Action != "" {
+					t.Errorf("expected no action for %v; got %q", d.Username, d.Action)
+				}
+			}
+		})
+	}
+}
+
+type fakeStore struct {
+	bookmarked []string
+	forgotten  []string
+}
+
+func (s *fakeStore) BookmarkUser(registrationID int, bookmark *models.Bookmark) error {
+	s.bookmarked = append(s.bookmarked, bookmark.Username+" by "+bookmark.CreatedBy)
+	return nil
+}
+
+func (s *fakeStore) UnBookmarkUser(registrationID int, username string) error {
+	if username == "leftover" {
+		return errors.New("simulated failure")
+	}
+	s.forgotten = append(s.forgotten, username)
+	return nil
+}
+
+type fakeProvisioner struct {
+	dropped []string
+}
+
+func (p *fakeProvisioner) Close()                                     {}
+func (p *fakeProvisioner) CreateUser(username, password string) error { return nil }
+func (p *fakeProvisioner) DropUser(username string) error {
+	p.dropped = append(p.dropped, username)
+	return nil
+}
+
+func TestReport_Repair(t *testing.T) {
+	tests := []struct {
+		name           string
+		repairs        Repairs
+		wantBookmarked []string
+		wantForgotten  []string
+		wantDropped    []string
+		wantFailed     int
+	}{
+		{name: "no repairs"},
+		{name: "forget and bookmark", repairs: Repairs{Missing: Forget, Unbookmarked: Bookmark}, wantBookmarked: []string{"MANUAL by token:1"}, wantForgotten: []string{"missing"}, wantFailed: 1},
+		{name: "drop listed", repairs: Repairs{Drop: []string{"manual"}}, wantDropped: []string{"MANUAL"}},
+		{name: "drop listed instead of bookmark", repairs: Repairs{Unbookmarked: Bookmark, Drop: []string{"MANUAL"}}, wantDropped: []string{"MANUAL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{}
+			p := &fakeProvisioner{}
+			report := testReport()
+			if err := report.Plan(tt.repairs); err != nil {
+				t.Fatalf("could not plan repairs: %v", err)
+			}
+			report.Repair(store, 1, "token:1", p)
+
+			if !reflect.DeepEqual(store.bookmarked, tt.wantBookmarked) {
+				t.Errorf("expected bookmarked %v; got %v", tt.wantBookmarked, store.bookmarked)
+			}
+			if !reflect.DeepEqual(store.forgotten, tt.wantForgotten) {
+				t.Errorf("expected forgotten %v; got %v", tt.wantForgotten, store.forgotten)
+			}
+			if !reflect.DeepEqual(p.dropped, tt.wantDropped) {
+				t.Errorf("expected dropped %v; got %v", tt.wantDropped, p.dropped)
+			}
+			if report.Failed != tt.wantFailed {
+				t.Errorf("expected %v failed repairs; got %v", tt.wantFailed, report.Failed)
+			}
+			for _, d := range report.Drift {
+				if d.Status == Orphaned && (d.Action != "" || d.Repaired) {
+					t.Errorf("expected orphaned %v to be left alone; got %+v", d.Username, d)
+				}
+			}
+		})
+	}
+}
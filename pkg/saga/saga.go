@@ -0,0 +1,84 @@
+// Package saga runs a sequence of steps that each declare how to undo
+// themselves. If a step fails, the steps that already ran are undone
+// in reverse order.
+package saga
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Step is a single action of a saga.
+type Step struct {
+	Name string
+	Do   func() error
+	// Undo reverts Do. Steps without Undo are skipped during rollback.
+	Undo func() error
+}
+
+// Result reports which steps of a saga ran and how they were rolled back.
+type Result struct {
+	Ran            []string      `json:"ran"`
+	Failed         string        `json:"failed,omitempty"`
+	RolledBack     []string      `json:"rolledBack,omitempty"`
+	RollbackFailed []StepFailure `json:"rollbackFailed,omitempty"`
+}
+
+// StepFailure is a step whose undo action failed.
+type StepFailure struct {
+	Step  string `json:"step"`
+	Error string `json:"error"`
+}
+
+// Error is returned by Run if a step failed.
+type Error struct {
+	Step   string
+	Err    error
+	Result *Result
+}
+
+func (e *Error) Error() string {
+	if len(e.Result.RollbackFailed) == 0 {
+		return e.Err.Error()
+	}
+	failed := make([]string, len(e.Result.RollbackFailed))
+	for i, f := range e.Result.RollbackFailed {
+		failed[i] = f.Step
+	}
+	return fmt.Sprintf("%v (rollback failed for: %v)", e.Err, strings.Join(failed, ", "))
+}
+
+// Unwrap returns the error of the failed step.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Run runs steps in order. If a step fails, the undo actions of all steps
+// that ran before it are called in reverse order and an *Error is returned.
+// A failing undo action does not stop the rollback of the remaining steps.
+func Run(steps []Step) (*Result, error) {
+	result := &Result{Ran: []string{}}
+	for i, step := range steps {
+		if err := step.Do(); err != nil {
+			result.Failed = step.Name
+			rollback(steps[:i], result)
+			return result, &Error{Step: step.Name, Err: err, Result: result}
+		}
+		result.Ran = append(result.Ran, step.Name)
+	}
+	return result, nil
+}
+
+func rollback(steps []Step, result *Result) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		if step.Undo == nil {
+			continue
+		}
+		if err := step.Undo(); err != nil {
+			result.RollbackFailed = append(result.RollbackFailed, StepFailure{Step: step.Name, Error: err.Error()})
+			continue
+		}
+		result.RolledBack = append(result.RolledBack, step.Name)
+	}
+}
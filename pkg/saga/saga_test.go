@@ -0,0 +1,105 @@
+package saga
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name       string
+		fail       string
+		failUndo   string
+		noUndo     string
+		wantCalls  []string
+		wantResult *Result
+		wantErr    string
+	}{
+		{
+			name:       "all steps succeed",
+			wantCalls:  []string{"do a", "do b", "do c"},
+			wantResult: &Result{Ran: []string{"a", "b", "c"}},
+		},
+		{
+			name:       "first step fails",
+			fail:       "a",
+			wantCalls:  []string{"do a"},
+			wantResult: &Result{Ran: []string{}, Failed: "a"},
+			wantErr:    "failed",
+		},
+		{
+			name:       "last step fails",
+			fail:       "c",
+			wantCalls:  []string{"do a", "do b", "do c", "undo b", "undo a"},
+			wantResult: &Result{Ran: []string{"a", "b"}, Failed: "c", RolledBack: []string{"b", "a"}},
+			wantErr:    "failed",
+		},
+		{
+			name:      "undo fails",
+			fail:      "c",
+			failUndo:  "b",
+			wantCalls: []string{"do a", "do b", "do c", "undo b", "undo a"},
+			wantResult: &Result{Ran: []string{"a", "b"}, Failed: "c", RolledBack: []string{"a"},
+				RollbackFailed: []StepFailure{{Step: "b", Error: "failed"}}},
+			wantErr: "failed (rollback failed for: b)",
+		},
+		{
+			name:       "step without undo",
+			fail:       "c",
+			noUndo:     "b",
+			wantCalls:  []string{"do a", "do b", "do c", "undo a"},
+			wantResult: &Result{Ran: []string{"a", "b"}, Failed: "c", RolledBack: []string{"a"}},
+			wantErr:    "failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			step := func(name string) Step {
+				s := Step{
+					Name: name,
+					Do: func() error {
+						calls = append(calls, "do "+name)
+						if name == tt.fail {
+							return errFailed
+						}
+						return nil
+					},
+					Undo: func() error {
+						calls = append(calls, "undo "+name)
+						if name == tt.failUndo {
+							return errFailed
+						}
+						return nil
+					},
+				}
+				if name == tt.noUndo {
+					s.Undo = nil
+				}
+				return s
+			}
+
+			result, err := Run([]Step{step("a"), step("b"), step("c")})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("expected error %q; got %v", tt.wantErr, err)
+				}
+				if !errors.Is(err, errFailed) {
+					t.Errorf("expected error to wrap the step error")
+				}
+			}
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("expected calls %q; got %q", tt.wantCalls, calls)
+			}
+			if !reflect.DeepEqual(result, tt.wantResult) {
+				t.Errorf("expected result %+v; got %+v", tt.wantResult, result)
+			}
+		})
+	}
+}
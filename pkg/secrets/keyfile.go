@@ -0,0 +1,50 @@
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// LoadKeyFile returns the keyring stored in the file at path. Every line
+// holds a version:key pair as parsed by ParseKeyring, lines starting with
+// # are ignored. The file must not be accessible by group or others.
+func LoadKeyFile(path string) (*Keyring, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing key file")
+	}
+	if err := checkPrivate(path); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key file: %v", err)
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	kr, err := ParseKeyring(strings.Join(entries, ","))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %v: %v", path, err)
+	}
+	return kr, nil
+}
+
+// checkPrivate checks that only the owner can access the file at path
+func checkPrivate(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("%v is accessible by others (%#o), restrict it to 0600", path, perm)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadKeyFile(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+	tests := []struct {
+		name         string
+		content      string
+		perm         os.FileMode
+		wantVersions []int
+		wantErr      bool
+	}{
+		{name: "keys and comments", content: "# rotated 2020-01-01\n1:" + key + "\n\n2:" + key + "\n", perm: 0600, wantVersions: []int{1, 2}},
+		{name: "readable by others", content: "1:" + key + "\n", perm: 0644, wantErr: true},
+		{name: "no keys", content: "# empty\n", perm: 0600, wantErr: true},
+		{name: "invalid key", content: "1:short\n", perm: 0600, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.perm); err != nil {
+				t.Fatal(err)
+			}
+
+			kr, err := LoadKeyFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeyFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(kr.Versions(), tt.wantVersions) {
+				t.Errorf("expected versions %v; got %v", tt.wantVersions, kr.Versions())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Keyring holds the active versions of the master key. Records are
+// sealed with the current key, the newest version, and opened with
+// the version they were sealed with.
+type Keyring struct {
+	keys    map[int]*MasterKey
+	current *MasterKey
+}
+
+// NewKeyring returns a keyring of keys. The key with the
+// highest version becomes the current key.
+func NewKeyring(keys ...*MasterKey) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("missing master key")
+	}
+	kr := &Keyring{keys: make(map[int]*MasterKey)}
+	for _, k := range keys {
+		if _, ok := kr.keys[k.Version]; ok {
+			return nil, fmt.Errorf("duplicate master key version %v", k.Version)
+		}
+		kr.keys[k.Version] = k
+		if kr.current == nil || k.Version > kr.current.Version {
+			kr.current = k
+		}
+	}
+	return kr, nil
+}
+
+// ParseKeyring parses a comma separated list of version:key pairs
+// with base64 encoded keys, e.g. "1:<key>,2:<key>".
+func ParseKeyring(s string) (*Keyring, error) {
+	var keys []*MasterKey
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid master key entry, expected version:key")
+		}
+		version, err := strconv.Atoi(kv[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key version %q", kv[0])
+		}
+		k, err := ParseMasterKey(version, kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("master key version %v: %v", version, err)
+		}
+		keys = append(keys, k)
+	}
+	return NewKeyring(keys...)
+}
+
+// Current returns the key new records are sealed with
+func (kr *Keyring) Current() *MasterKey {
+	return kr.current
+}
+
+// Key returns the key of version
+func (kr *Keyring) Key(version int) (*MasterKey, error) {
+	k, ok := kr.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key version %v", version)
+	}
+	return k, nil
+}
+
+// Wrap encrypts dataKey with the current key
+func (kr *Keyring) Wrap(dataKey []byte) (int, []byte, error) {
+	wrapped, err := kr.current.Wrap(dataKey)
+	if err != nil {
+		return 0, nil, err
+	}
+	return kr.current.Version, wrapped, nil
+}
+
+// Unwrap decrypts a data key wrapped with the key of version
+func (kr *Keyring) Unwrap(version int, wrapped []byte) ([]byte, error) {
+	k, err := kr.Key(version)
+	if err != nil {
+		return nil, err
+	}
+	return k.Unwrap(wrapped)
+}
+
+// CurrentVersion returns the version of the current key
+func (kr *Keyring) CurrentVersion() (int, error) {
+	return kr.current.Version, nil
+}
+
+// Versions returns the versions of the keys in ascending order
+func (kr *Keyring) Versions() []int {
+	versions := make([]int, 0, len(kr.keys))
+	for v := range kr.keys {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// KeyringFromEnv returns the keyring configured by the environment.
+// BANQUETTE_MASTER_KEYS holds a list as parsed by ParseKeyring,
+// otherwise BANQUETTE_MASTER_KEY holds a single base64 encoded key
+// of version BANQUETTE_MASTER_KEY_VERSION, which defaults to 1.
+func KeyringFromEnv() (*Keyring, error) {
+	if keys := os.Getenv("BANQUETTE_MASTER_KEYS"); keys != "" {
+		return ParseKeyring(keys)
+	}
+
+	key := os.Getenv("BANQUETTE_MASTER_KEY")
+	if key == "" {
+		return nil, fmt.Errorf("missing master key, set BANQUETTE_MASTER_KEY or BANQUETTE_MASTER_KEYS")
+	}
+	version := 1
+	if v := os.Getenv("BANQUETTE_MASTER_KEY_VERSION"); v != "" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid master key version %q", v)
+		}
+	}
+	k, err := ParseMasterKey(version, key)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(k)
+}
@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestKeyring_rotation(t *testing.T) {
+	v1 := testKey(t, 1, 1)
+	old, err := Seal(testKeyring(t, v1), []byte("old password"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	keys := testKeyring(t, testKey(t, 2, 2), v1)
+	if v := keys.Current().Version; v != 2 {
+		t.Fatalf("expected current version 2; got %v", v)
+	}
+	if got, err := Open(keys, old, nil); err != nil || string(got) != "old password" {
+		t.Errorf("expected to open a record of version 1; got %q, %v", got, err)
+	}
+
+	r, err := Seal(keys, []byte("new password"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.KeyVersion != 2 {
+		t.Errorf("expected new records to use version 2; got %v", r.KeyVersion)
+	}
+	if _, err := Open(testKeyring(t, v1), r, nil); err == nil {
+		t.Errorf("expected an error opening a record of version 2 without its key")
+	}
+}
+
+func TestNewKeyring_errors(t *testing.T) {
+	if _, err := NewKeyring(); err == nil {
+		t.Errorf("expected an error for an empty keyring")
+	}
+	if _, err := NewKeyring(testKey(t, 1, 1), testKey(t, 1, 2)); err == nil {
+		t.Errorf("expected an error for duplicate versions")
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	key := func(b byte) string {
+		return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, KeySize))
+	}
+
+	tests := []struct {
+		name         string
+		s            string
+		wantVersions []int
+		wantErr      bool
+	}{
+		{name: "single key", s: "1:" + key(1), wantVersions: []int{1}},
+		{name: "several keys", s: "3:" + key(3) + ", 1:" + key(1) + ",", wantVersions: []int{1, 3}},
+		{name: "empty", s: "", wantErr: true},
+		{name: "missing version", s: key(1), wantErr: true},
+		{name: "invalid version", s: "one:" + key(1), wantErr: true},
+		{name: "invalid key", s: "1:short", wantErr: true},
+		{name: "duplicate version", s: "1:" + key(1) + ",1:" + key(2), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := ParseKeyring(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v; got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := kr.Versions(); !reflect.DeepEqual(got, tt.wantVersions) {
+				t.Errorf("expected versions %v; got %v", tt.wantVersions, got)
+			}
+		})
+	}
+}
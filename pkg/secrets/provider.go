@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+)
+
+// Provider manages the master keys that wrap data keys.
+type Provider interface {
+	// Wrap encrypts dataKey with the current master key
+	// and returns the version of that key.
+	Wrap(dataKey []byte) (version int, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped with the master key of version.
+	Unwrap(version int, wrapped []byte) ([]byte, error)
+	// CurrentVersion returns the version of the master key used by Wrap.
+	CurrentVersion() (int, error)
+}
+
+// ProviderFromEnv returns the provider selected by BANQUETTE_KMS:
+//
+//	env        keys from the environment, see KeyringFromEnv (default)
+//	file       keys from the file BANQUETTE_KEY_FILE, see LoadKeyFile
+//	softtoken  keys from the soft token BANQUETTE_SOFTTOKEN unlocked
+//	           with BANQUETTE_SOFTTOKEN_PIN, see OpenSoftToken
+//	vault      the transit key BANQUETTE_VAULT_KEY (default "banquette")
+//	           of the engine mounted at BANQUETTE_VAULT_MOUNT (default
+//	           "transit") of the Vault at VAULT_ADDR using VAULT_TOKEN
+func ProviderFromEnv() (Provider, error) {
+	switch kms := os.Getenv("BANQUETTE_KMS"); kms {
+	case "", "env":
+		return KeyringFromEnv()
+	case "file":
+		return LoadKeyFile(os.Getenv("BANQUETTE_KEY_FILE"))
+	case "softtoken":
+		return OpenSoftToken(os.Getenv("BANQUETTE_SOFTTOKEN"), os.Getenv("BANQUETTE_SOFTTOKEN_PIN"))
+	case "vault":
+		v := NewVault(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"), os.Getenv("BANQUETTE_VAULT_MOUNT"), os.Getenv("BANQUETTE_VAULT_KEY"))
+		if _, err := v.CurrentVersion(); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unknown key management provider %q", kms)
+	}
+}
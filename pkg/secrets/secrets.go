@@ -0,0 +1,147 @@
+// Package secrets encrypts stored credentials with envelope encryption.
+//
+// Every record is encrypted with its own random data key using AES-GCM.
+// The data key is wrapped by a versioned master key and stored with the
+// record, so the master key never leaves banquette and records name the
+// version of the key they need. Records are bound to additional data,
+// e.g. the id of the row storing them, so they cannot be moved to
+// another row without failing to decrypt. Several versions can be active in a
+// Keyring while records are re-encrypted with a new master key.
+//
+// Master keys are managed by a Provider. Keyrings are loaded from the
+// environment, a key file or a soft token, or the keys stay in a Vault
+// transit secrets engine. ProviderFromEnv selects the configured one.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the size of master and data keys in bytes (AES-256).
+const KeySize = 32
+
+// ErrDecrypt is returned if a record or data key cannot be decrypted,
+// because it was modified or encrypted with a different key.
+var ErrDecrypt = errors.New("could not decrypt, wrong key or modified data")
+
+// MasterKey wraps the data keys of records
+type MasterKey struct {
+	// Version is stored with every record wrapped by the key
+	Version int
+	aead    cipher.AEAD
+}
+
+// NewMasterKey returns a master key of version with the raw key,
+// which has to be KeySize bytes long.
+func NewMasterKey(version int, key []byte) (*MasterKey, error) {
+	if version < 1 {
+		return nil, fmt.Errorf("invalid key version %v, must be positive", version)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &MasterKey{Version: version, aead: aead}, nil
+}
+
+// ParseMasterKey returns a master key of version from its base64 encoding
+func ParseMasterKey(version int, encoded string) (*MasterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode master key: %v", err)
+	}
+	return NewMasterKey(version, key)
+}
+
+// Wrap encrypts a data key
+func (k *MasterKey) Wrap(dataKey []byte) ([]byte, error) {
+	return seal(k.aead, dataKey, nil)
+}
+
+// Unwrap decrypts a data key encrypted by Wrap
+func (k *MasterKey) Unwrap(wrapped []byte) ([]byte, error) {
+	return open(k.aead, wrapped, nil)
+}
+
+// Record is an encrypted value
+type Record struct {
+	// KeyVersion is the version of the master key that wrapped DataKey
+	KeyVersion int
+	// DataKey is the wrapped key of Ciphertext
+	DataKey    []byte
+	Ciphertext []byte
+}
+
+// Seal encrypts plaintext with a new data key wrapped by p.
+// The record can only be opened with the same additional data.
+func Seal(p Provider, plaintext, additionalData []byte) (*Record, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("could not generate data key: %v", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(aead, plaintext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	version, wrapped, err := p.Wrap(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not wrap data key: %v", err)
+	}
+	return &Record{KeyVersion: version, DataKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts a record sealed by Seal with the master key of its version.
+// additionalData has to be the one passed to Seal.
+func Open(p Provider, r *Record, additionalData []byte) ([]byte, error) {
+	dataKey, err := p.Unwrap(r.KeyVersion, r.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, r.Ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("invalid key size %v, must be %v bytes", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce prepended to the ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %v", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts a ciphertext returned by seal
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
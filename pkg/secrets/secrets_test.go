@@ -0,0 +1,117 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func testKey(t *testing.T, version int, b byte) *MasterKey {
+	k, err := NewMasterKey(version, bytes.Repeat([]byte{b}, KeySize))
+	if err != nil {
+		t.Fatalf("could not create master key: %v", err)
+	}
+	return k
+}
+
+func testKeyring(t *testing.T, keys ...*MasterKey) *Keyring {
+	kr, err := NewKeyring(keys...)
+	if err != nil {
+		t.Fatalf("could not create keyring: %v", err)
+	}
+	return kr
+}
+
+func TestSeal(t *testing.T) {
+	master := testKeyring(t, testKey(t, 1, 1))
+	plaintext := []byte("admin password")
+
+	r, err := Seal(master, plaintext, []byte("1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.KeyVersion != 1 {
+		t.Errorf("expected key version 1; got %v", r.KeyVersion)
+	}
+	if bytes.Contains(r.Ciphertext, plaintext) {
+		t.Errorf("expected ciphertext not to contain the plaintext")
+	}
+
+	other, err := Seal(master, plaintext, []byte("1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if bytes.Equal(r.Ciphertext, other.Ciphertext) || bytes.Equal(r.DataKey, other.DataKey) {
+		t.Errorf("expected every record to have its own data key and nonce")
+	}
+
+	got, err := Open(master, r, []byte("1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("expected %q; got %q", plaintext, got)
+	}
+}
+
+func TestOpen_errors(t *testing.T) {
+	master := testKeyring(t, testKey(t, 1, 1))
+	r, err := Seal(master, []byte("admin password"), []byte("1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := Open(testKeyring(t, testKey(t, 1, 2)), r, []byte("1")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected %v for a wrong key; got %v", ErrDecrypt, err)
+	}
+	if _, err := Open(testKeyring(t, testKey(t, 2, 1)), r, []byte("1")); err == nil {
+		t.Errorf("expected an error for a different key version")
+	}
+
+	modified := *r
+	modified.Ciphertext = append([]byte(nil), r.Ciphertext...)
+	modified.Ciphertext[len(modified.Ciphertext)-1] ^= 1
+	if _, err := Open(master, &modified, []byte("1")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected %v for a modified ciphertext; got %v", ErrDecrypt, err)
+	}
+
+	truncated := *r
+	truncated.Ciphertext = r.Ciphertext[:4]
+	if _, err := Open(master, &truncated, []byte("1")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected %v for a truncated ciphertext; got %v", ErrDecrypt, err)
+	}
+
+	// a record moved to another row does not decrypt
+	if _, err := Open(master, r, []byte("2")); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected %v for other additional data; got %v", ErrDecrypt, err)
+	}
+	if _, err := Open(master, r, nil); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected %v without additional data; got %v", ErrDecrypt, err)
+	}
+}
+
+func TestParseMasterKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		encoded string
+		wantErr bool
+	}{
+		{name: "valid", version: 1, encoded: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))},
+		{name: "not base64", version: 1, encoded: "not a key!", wantErr: true},
+		{name: "too short", version: 1, encoded: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "invalid version", version: 0, encoded: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := ParseMasterKey(tt.version, tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v; got %v", tt.wantErr, err)
+			}
+			if err == nil && k.Version != tt.version {
+				t.Errorf("expected version %v; got %v", tt.version, k.Version)
+			}
+		})
+	}
+}
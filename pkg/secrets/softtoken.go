@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// softTokenIterations is the PBKDF2 iteration count of new soft tokens
+const softTokenIterations = 600000
+
+// ErrWrongPIN is returned if a soft token cannot be unlocked with a PIN.
+var ErrWrongPIN = errors.New("wrong soft token PIN")
+
+// softToken is the file format of a soft token. Like a PKCS#11 soft
+// token, it keeps master keys encrypted under a key derived from a PIN.
+type softToken struct {
+	Salt       []byte         `json:"salt"`
+	Iterations int            `json:"iterations"`
+	Keys       []softTokenKey `json:"keys"`
+}
+
+type softTokenKey struct {
+	Version int `json:"version"`
+	// Key is the master key encrypted with the PIN
+	Key []byte `json:"key"`
+}
+
+// OpenSoftToken unlocks the soft token at path with pin
+// and returns the keyring of its master keys.
+func OpenSoftToken(path, pin string) (*Keyring, error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing soft token")
+	}
+	if err := checkPrivate(path); err != nil {
+		return nil, err
+	}
+	t, err := readSoftToken(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pinKey, err := t.unlock(pin)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*MasterKey, len(t.Keys))
+	for i, k := range t.Keys {
+		raw, err := pinKey.Unwrap(k.Key)
+		if err != nil {
+			return nil, ErrWrongPIN
+		}
+		if keys[i], err = NewMasterKey(k.Version, raw); err != nil {
+			return nil, err
+		}
+	}
+	return NewKeyring(keys...)
+}
+
+// AddSoftTokenKey generates a new master key in the soft token at path,
+// which is created if it does not exist. The new key gets the next
+// version and becomes the current key of the token.
+func AddSoftTokenKey(path, pin string) (int, error) {
+	if pin == "" {
+		return 0, fmt.Errorf("missing soft token PIN")
+	}
+
+	t := &softToken{Iterations: softTokenIterations}
+	if _, err := os.Stat(path); err == nil {
+		if t, err = readSoftToken(path); err != nil {
+			return 0, err
+		}
+		if _, err := OpenSoftToken(path, pin); err != nil {
+			return 0, err
+		}
+	} else {
+		t.Salt = make([]byte, 16)
+		if _, err := rand.Read(t.Salt); err != nil {
+			return 0, fmt.Errorf("could not generate salt: %v", err)
+		}
+	}
+
+	pinKey, err := t.unlock(pin)
+	if err != nil {
+		return 0, err
+	}
+	raw := make([]byte, KeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return 0, fmt.Errorf("could not generate master key: %v", err)
+	}
+	wrapped, err := pinKey.Wrap(raw)
+	if err != nil {
+		return 0, err
+	}
+	version := 1
+	for _, k := range t.Keys {
+		if k.Version >= version {
+			version = k.Version + 1
+		}
+	}
+	t.Keys = append(t.Keys, softTokenKey{Version: version, Key: wrapped})
+
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return 0, fmt.Errorf("could not write soft token: %v", err)
+	}
+	return version, nil
+}
+
+func readSoftToken(path string) (*softToken, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read soft token: %v", err)
+	}
+	var t softToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("invalid soft token %v: %v", path, err)
+	}
+	return &t, nil
+}
+
+// unlock derives the key encrypting the master keys of t from pin
+func (t *softToken) unlock(pin string) (*MasterKey, error) {
+	if pin == "" {
+		return nil, fmt.Errorf("missing soft token PIN")
+	}
+	if len(t.Salt) == 0 || t.Iterations < 1 {
+		return nil, fmt.Errorf("invalid soft token, missing salt or iterations")
+	}
+	return NewMasterKey(1, pbkdf2.Key([]byte(pin), t.Salt, t.Iterations, KeySize, sha256.New))
+}
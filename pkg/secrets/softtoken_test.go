@@ -0,0 +1,51 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSoftToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.json")
+	for want := 1; want <= 2; want++ {
+		v, err := AddSoftTokenKey(path, "1234")
+		if err != nil {
+			t.Fatalf("could not add key: %v", err)
+		}
+		if v != want {
+			t.Errorf("expected new key version %v; got %v", want, v)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected a soft token readable only by its owner; got %v, %v", info.Mode(), err)
+	}
+
+	kr, err := OpenSoftToken(path, "1234")
+	if err != nil {
+		t.Fatalf("could not open soft token: %v", err)
+	}
+	if !reflect.DeepEqual(kr.Versions(), []int{1, 2}) {
+		t.Errorf("expected versions [1 2]; got %v", kr.Versions())
+	}
+	r, err := Seal(kr, []byte("password"), nil)
+	if err != nil || r.KeyVersion != 2 {
+		t.Fatalf("expected to seal with version 2; got %v, %v", r, err)
+	}
+
+	reopened, err := OpenSoftToken(path, "1234")
+	if err != nil {
+		t.Fatalf("could not reopen soft token: %v", err)
+	}
+	if got, err := Open(reopened, r, nil); err != nil || string(got) != "password" {
+		t.Errorf("expected the same keys after reopening; got %q, %v", got, err)
+	}
+
+	if _, err := OpenSoftToken(path, "4321"); err != ErrWrongPIN {
+		t.Errorf("expected ErrWrongPIN; got %v", err)
+	}
+	if _, err := AddSoftTokenKey(path, "4321"); err != ErrWrongPIN {
+		t.Errorf("expected adding a key with a wrong PIN to fail with ErrWrongPIN; got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// TokenSize is the number of random bytes of an API token
+const TokenSize = 32
+
+// GenerateToken returns a new random API token
+func GenerateToken() (string, error) {
+	b := make([]byte, TokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not read random bytes: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the HMAC-SHA256 of token keyed with key. Only the
+// hash of a token is stored, so stored hashes cannot be used as tokens
+// and cannot be checked against guessed tokens without key.
+func HashToken(key []byte, token string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TokenKeyFromEnv returns the base64 encoded key of BANQUETTE_TOKEN_KEY
+// that API tokens are hashed with. It must have at least KeySize bytes.
+func TokenKeyFromEnv() ([]byte, error) {
+	s := os.Getenv("BANQUETTE_TOKEN_KEY")
+	if s == "" {
+		return nil, fmt.Errorf("missing token key, set BANQUETTE_TOKEN_KEY")
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token key: %v", err)
+	}
+	if len(key) < KeySize {
+		return nil, fmt.Errorf("token key must have at least %v bytes; got %v", KeySize, len(key))
+	}
+	return key, nil
+}
@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestGenerateToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := GenerateToken()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(token) != 2*TokenSize {
+			t.Fatalf("expected a token of %v characters; got %q", 2*TokenSize, token)
+		}
+		if seen[token] {
+			t.Fatalf("token %v generated twice", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, KeySize)
+	h := HashToken(key, "token")
+	if h == "token" || len(h) != 64 {
+		t.Fatalf("expected a hex encoded HMAC-SHA256; got %q", h)
+	}
+	if HashToken(key, "token") != h {
+		t.Errorf("expected the same hash for the same token")
+	}
+	if HashToken(key, "other") == h {
+		t.Errorf("expected different hashes for different tokens")
+	}
+	if HashToken(bytes.Repeat([]byte{2}, KeySize), "token") == h {
+		t.Errorf("expected different hashes for different keys")
+	}
+}
+
+func TestTokenKeyFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "valid", value: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))},
+		{name: "missing", value: "", wantErr: true},
+		{name: "not base64", value: "not base64!", wantErr: true},
+		{name: "too short", value: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BANQUETTE_TOKEN_KEY", tt.value)
+			if _, err := TokenKeyFromEnv(); (err != nil) != tt.wantErr {
+				t.Errorf("TokenKeyFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
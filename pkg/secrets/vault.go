@@ -0,0 +1,144 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Vault wraps data keys with a key of a Vault transit secrets engine,
+// so master keys never leave Vault. Key versions are those of the
+// transit key and rotating it in Vault starts a new version.
+type Vault struct {
+	// Addr is the address of Vault, e.g. https://vault:8200
+	Addr  string
+	Token string
+	// Mount is the path the transit engine is mounted at
+	Mount string
+	// Key is the name of the transit key
+	Key    string
+	Client *http.Client
+}
+
+// NewVault returns a provider for the transit key of the engine mounted
+// at mount of the Vault at addr. mount and key default to "transit"
+// and "banquette".
+func NewVault(addr, token, mount, key string) *Vault {
+	if mount == "" {
+		mount = "transit"
+	}
+	if key == "" {
+		key = "banquette"
+	}
+	return &Vault{
+		Addr:   strings.TrimSuffix(addr, "/"),
+		Token:  token,
+		Mount:  strings.Trim(mount, "/"),
+		Key:    key,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Wrap encrypts dataKey with the latest version of the transit key
+func (v *Vault) Wrap(dataKey []byte) (int, []byte, error) {
+	var res struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	err := v.do("POST", "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}, &res)
+	if err != nil {
+		return 0, nil, err
+	}
+	version, err := vaultVersion(res.Data.Ciphertext)
+	if err != nil {
+		return 0, nil, err
+	}
+	return version, []byte(res.Data.Ciphertext), nil
+}
+
+// Unwrap decrypts a data key wrapped with the transit key of version
+func (v *Vault) Unwrap(version int, wrapped []byte) ([]byte, error) {
+	if got, err := vaultVersion(string(wrapped)); err != nil || got != version {
+		return nil, fmt.Errorf("data key was not wrapped by version %v of the transit key", version)
+	}
+	var res struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.do("POST", "decrypt", map[string]string{"ciphertext": string(wrapped)}, &res); err != nil {
+		return nil, err
+	}
+	dataKey, err := base64.StdEncoding.DecodeString(res.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plaintext from vault: %v", err)
+	}
+	return dataKey, nil
+}
+
+// CurrentVersion returns the latest version of the transit key
+func (v *Vault) CurrentVersion() (int, error) {
+	var res struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+		} `json:"data"`
+	}
+	if err := v.do("GET", "keys", nil, &res); err != nil {
+		return 0, err
+	}
+	return res.Data.LatestVersion, nil
+}
+
+// do sends a request with body to the endpoint op of the transit key
+// and decodes the response into v
+func (v *Vault) do(method, op string, body interface{}, res interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, v.Addr+"/v1/"+v.Mount+"/"+op+"/"+v.Key, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach vault: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("vault %v of transit key %v failed (%v): %v", op, v.Key, resp.Status, strings.Join(e.Errors, ", "))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return fmt.Errorf("invalid response from vault: %v", err)
+	}
+	return nil
+}
+
+// vaultVersion returns the key version of a ciphertext like vault:v1:...
+func vaultVersion(ciphertext string) (int, error) {
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return 0, fmt.Errorf("invalid vault ciphertext")
+	}
+	version, err := strconv.Atoi(parts[1][1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid vault ciphertext version %q", parts[1])
+	}
+	return version, nil
+}
@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeTransit is a Vault transit secrets engine with a single key
+// "banquette" backed by a local keyring
+type fakeTransit struct {
+	t    *testing.T
+	keys *Keyring
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fail := func(status int, msg string) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+	}
+	if r.Header.Get("X-Vault-Token") != "root" {
+		fail(http.StatusForbidden, "permission denied")
+		return
+	}
+	var req struct{ Plaintext, Ciphertext string }
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&req)
+	}
+	var data map[string]interface{}
+
+	switch r.URL.Path {
+	case "/v1/transit/keys/banquette":
+		data = map[string]interface{}{"latest_version": f.keys.Current().Version}
+	case "/v1/transit/encrypt/banquette":
+		plain, _ := base64.StdEncoding.DecodeString(req.Plaintext)
+		v, wrapped, err := f.keys.Wrap(plain)
+		if err != nil {
+			fail(http.StatusInternalServerError, err.Error())
+			return
+		}
+		data = map[string]interface{}{"ciphertext": fmt.Sprintf("vault:v%v:%v", v, base64.StdEncoding.EncodeToString(wrapped))}
+	case "/v1/transit/decrypt/banquette":
+		parts := strings.SplitN(req.Ciphertext, ":", 3)
+		v, _ := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+		wrapped, _ := base64.StdEncoding.DecodeString(parts[2])
+		plain, err := f.keys.Unwrap(v, wrapped)
+		if err != nil {
+			fail(http.StatusBadRequest, "cipher: message authentication failed")
+			return
+		}
+		data = map[string]interface{}{"plaintext": base64.StdEncoding.EncodeToString(plain)}
+	default:
+		fail(http.StatusNotFound, "no handler for route "+r.URL.Path)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func TestVault(t *testing.T) {
+	transit := &fakeTransit{t: t, keys: testKeyring(t, testKey(t, 1, 1))}
+	srv := httptest.NewServer(transit)
+	defer srv.Close()
+
+	v := NewVault(srv.URL+"/", "root", "", "")
+	if current, err := v.CurrentVersion(); err != nil || current != 1 {
+		t.Fatalf("expected current version 1; got %v, %v", current, err)
+	}
+	r, err := Seal(v, []byte("password"), nil)
+	if err != nil {
+		t.Fatalf("could not seal: %v", err)
+	}
+	if r.KeyVersion != 1 || !bytes.HasPrefix(r.DataKey, []byte("vault:v1:")) {
+		t.Errorf("expected a data key wrapped by version 1; got %v, %q", r.KeyVersion, r.DataKey)
+	}
+
+	// rotate the transit key
+	transit.keys = testKeyring(t, testKey(t, 2, 2), testKey(t, 1, 1))
+	if got, err := Open(v, r, nil); err != nil || string(got) != "password" {
+		t.Errorf("expected to open a record of version 1 after rotation; got %q, %v", got, err)
+	}
+	if r, err := Seal(v, []byte("password"), nil); err != nil || r.KeyVersion != 2 {
+		t.Errorf("expected new records to use version 2; got %v, %v", r, err)
+	}
+
+	r.KeyVersion = 2
+	if _, err := Open(v, r, nil); err == nil {
+		t.Errorf("expected an error opening a data key with the wrong version")
+	}
+
+	v.Token = "wrong"
+	if _, err := v.CurrentVersion(); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected the vault error; got %v", err)
+	}
+}